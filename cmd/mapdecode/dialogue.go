@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fkgi/gsmap"
+	"github.com/fkgi/gsmap/tcap"
+	"github.com/fkgi/gsmap/xua"
+)
+
+// dialogue is TCAP dialogue that is correlated by OTID and DTID.
+type dialogue struct {
+	start, last time.Time
+	// otid is TID of originating side and dtid is TID of destination side.
+	otid, dtid uint32
+	peer       bool
+	partial    bool
+	cgpa, cdpa xua.SCCPAddr
+	context    gsmap.AppContext
+	operation  []string
+	result     []string
+	errs       []string
+	state      string
+	messages   int
+	hits       uint8
+}
+
+/*
+correlator correlates messages to dialogues.
+Both TIDs of each dialogue are stored in same map,
+so TIDs must be unique in the capture.
+*/
+type correlator struct {
+	dialogues map[uint32]*dialogue
+}
+
+func newCorrelator() *correlator {
+	return &correlator{dialogues: map[uint32]*dialogue{}}
+}
+
+func (c *correlator) add(r *record) {
+	var d *dialogue
+	switch m := r.msg.(type) {
+	case *tcap.Unidirectional:
+		d = newDialogue(r, false)
+		d.state = "unidirectional"
+	case *tcap.TcBegin:
+		if old := c.dialogues[m.OTID()]; old != nil {
+			// TID is reused before the end of old dialogue
+			c.remove(old)
+			c.emit(old)
+		}
+		d = newDialogue(r, false)
+		d.otid = m.OTID()
+		c.dialogues[d.otid] = d
+	case *tcap.TcContinue:
+		if d = c.dialogues[m.DTID()]; d == nil {
+			d = newDialogue(r, true)
+			d.otid = m.DTID()
+			c.dialogues[d.otid] = d
+		}
+		if !d.peer && d.otid == m.DTID() {
+			d.dtid, d.peer = m.OTID(), true
+			c.dialogues[d.dtid] = d
+		}
+	case *tcap.TcEnd:
+		d = c.find(r, m.DTID())
+		d.state = "end"
+	case *tcap.TcAbort:
+		d = c.find(r, m.DTID())
+		d.state = "abort"
+	default:
+		return
+	}
+
+	d.update(r)
+	if !*summary && d.hits == filter.mask() {
+		printRecord(r)
+	}
+	if d.state != "open" {
+		c.remove(d)
+		c.emit(d)
+	}
+}
+
+func (c *correlator) remove(d *dialogue) {
+	if c.dialogues[d.otid] == d {
+		delete(c.dialogues, d.otid)
+	}
+	if d.peer && c.dialogues[d.dtid] == d {
+		delete(c.dialogues, d.dtid)
+	}
+}
+
+// find returns dialogue of dtid in End or Abort.
+func (c *correlator) find(r *record, dtid uint32) *dialogue {
+	if d := c.dialogues[dtid]; d != nil {
+		return d
+	}
+	d := newDialogue(r, true)
+	d.otid = dtid
+	return d
+}
+
+// flush emits summaries of dialogues that are not finished.
+func (c *correlator) flush() {
+	ds := []*dialogue{}
+	for k, d := range c.dialogues {
+		if k == d.otid {
+			ds = append(ds, d)
+		}
+	}
+	slices.SortFunc(ds, func(a, b *dialogue) int {
+		return a.start.Compare(b.start)
+	})
+	for _, d := range ds {
+		c.emit(d)
+	}
+	c.dialogues = map[uint32]*dialogue{}
+}
+
+func (c *correlator) emit(d *dialogue) {
+	if !*summary || d.hits != filter.mask() {
+		return
+	}
+	if *jsonLines {
+		if e := out.Encode(d.summary()); e != nil {
+			log.Fatalln("[ERROR]", e)
+		}
+		return
+	}
+
+	buf := new(strings.Builder)
+	s := d.summary()
+	fmt.Fprintf(buf, "%s otid=%s", s.Time.Format(time.RFC3339Nano), s.OTID)
+	if s.DTID != "" {
+		fmt.Fprint(buf, " dtid=", s.DTID)
+	}
+	if s.Context != "" {
+		fmt.Fprint(buf, " context=", s.Context)
+	}
+	if len(s.Operation) != 0 {
+		fmt.Fprint(buf, " operation=", strings.Join(s.Operation, ","))
+	}
+	if len(s.Result) != 0 {
+		fmt.Fprint(buf, " result=", strings.Join(s.Result, ","))
+	}
+	if len(s.Error) != 0 {
+		fmt.Fprint(buf, " error=", strings.Join(s.Error, ","))
+	}
+	fmt.Fprintf(buf, " state=%s latency=%s messages=%d", s.State, s.Latency, s.Messages)
+	if s.Partial {
+		fmt.Fprint(buf, " partial")
+	}
+	fmt.Fprintf(buf, " cgpa=[%s] cdpa=[%s]", addrString(d.cgpa), addrString(d.cdpa))
+	fmt.Println(buf.String())
+}
+
+func newDialogue(r *record, partial bool) *dialogue {
+	return &dialogue{
+		start:   r.time,
+		partial: partial,
+		cgpa:    r.ud.CallingParty,
+		cdpa:    r.ud.CalledParty,
+		state:   "open"}
+}
+
+func (d *dialogue) update(r *record) {
+	d.last = r.time
+	d.messages++
+	d.hits |= filter.match(r)
+
+	var dlg tcap.Dialogue
+	switch m := r.msg.(type) {
+	case *tcap.Unidirectional:
+		dlg = m.Dialogue()
+	case *tcap.TcBegin:
+		dlg = m.Dialogue()
+	case *tcap.TcContinue:
+		dlg = m.Dialogue()
+	case *tcap.TcEnd:
+		dlg = m.Dialogue()
+	}
+	if d.context == 0 {
+		switch dlg := dlg.(type) {
+		case *tcap.AARQ:
+			d.context = dlg.Context
+		case *tcap.AARE:
+			d.context = dlg.Context
+		}
+	}
+
+	for _, c := range r.msg.Components() {
+		switch c.(type) {
+		case gsmap.Invoke:
+			d.operation = append(d.operation, c.Name())
+		case gsmap.ReturnResultLast, gsmap.ReturnResult:
+			d.result = append(d.result, c.Name())
+		default:
+			d.errs = append(d.errs, c.Name())
+		}
+	}
+}
+
+// dialogueSummary is summary of dialogue.
+type dialogueSummary struct {
+	Time      time.Time    `json:"time"`
+	OTID      string       `json:"otid"`
+	DTID      string       `json:"dtid,omitempty"`
+	CgPA      xua.SCCPAddr `json:"cgpa"`
+	CdPA      xua.SCCPAddr `json:"cdpa"`
+	Context   string       `json:"context,omitempty"`
+	Operation []string     `json:"operation,omitempty"`
+	Result    []string     `json:"result,omitempty"`
+	Error     []string     `json:"error,omitempty"`
+	State     string       `json:"state"`
+	Latency   string       `json:"latency"`
+	Messages  int          `json:"messages"`
+	Partial   bool         `json:"partial,omitempty"`
+}
+
+func (d *dialogue) summary() dialogueSummary {
+	s := dialogueSummary{
+		Time:      d.start,
+		CgPA:      d.cgpa,
+		CdPA:      d.cdpa,
+		Operation: d.operation,
+		Result:    d.result,
+		Error:     d.errs,
+		State:     d.state,
+		Latency:   d.last.Sub(d.start).String(),
+		Messages:  d.messages,
+		Partial:   d.partial}
+	if d.state != "unidirectional" {
+		s.OTID = fmt.Sprintf("%x", d.otid)
+	}
+	if d.peer {
+		s.DTID = fmt.Sprintf("%x", d.dtid)
+	}
+	if d.context != 0 {
+		s.Context = fmt.Sprintf("%d/v%d", d.context.Application(), d.context.Version())
+	}
+	return s
+}
+
+/*
+matcher is filter of messages.
+Dialogue matches if all specified conditions are satisfied
+by messages in the dialogue.
+*/
+type matcher struct {
+	imsi, msisdn, gt, op string
+}
+
+const (
+	hitIMSI uint8 = 1 << iota
+	hitMSISDN
+	hitGT
+	hitOp
+)
+
+// mask returns hits of all specified conditions.
+func (f matcher) mask() (m uint8) {
+	if f.imsi != "" {
+		m |= hitIMSI
+	}
+	if f.msisdn != "" {
+		m |= hitMSISDN
+	}
+	if f.gt != "" {
+		m |= hitGT
+	}
+	if f.op != "" {
+		m |= hitOp
+	}
+	return
+}
+
+// match returns hits of conditions in the message.
+func (f matcher) match(r *record) (m uint8) {
+	if f.gt != "" && (r.ud.CallingParty.GlobalTitle.Digits.String() == f.gt ||
+		r.ud.CalledParty.GlobalTitle.Digits.String() == f.gt) {
+		m |= hitGT
+	}
+	for _, c := range r.msg.Components() {
+		if f.op != "" && c.Name() == f.op {
+			m |= hitOp
+		}
+		if f.imsi == "" && f.msisdn == "" {
+			continue
+		}
+		b, e := json.Marshal(c)
+		if e != nil {
+			continue
+		}
+		var j any
+		if json.Unmarshal(b, &j) != nil {
+			continue
+		}
+		if f.imsi != "" && findValue(j, f.imsi, func(k string) bool {
+			return strings.EqualFold(k, "imsi")
+		}, false) {
+			m |= hitIMSI
+		}
+		if f.msisdn != "" && findValue(j, strings.TrimPrefix(f.msisdn, "+"), func(k string) bool {
+			return strings.Contains(strings.ToLower(k), "msisdn")
+		}, false) {
+			m |= hitMSISDN
+		}
+	}
+	return
+}
+
+// findValue returns true if JSON j has string value v under key.
+// The value may be nested in the key, such as digits of AddressString.
+// found is true if j is already under the key.
+func findValue(j any, v string, key func(string) bool, found bool) bool {
+	switch j := j.(type) {
+	case string:
+		return found && strings.TrimPrefix(j, "+") == v
+	case map[string]any:
+		for k, c := range j {
+			if findValue(c, v, key, found || key(k)) {
+				return true
+			}
+		}
+	case []any:
+		for _, c := range j {
+			if findValue(c, v, key, found) {
+				return true
+			}
+		}
+	}
+	return false
+}
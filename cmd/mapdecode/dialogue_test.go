@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFindValue(t *testing.T) {
+	var j any
+	json.Unmarshal([]byte(`{"imsi":"440101234567890","subscriberData":{
+		"msisdn":{"na":"international","np":"isdn","digits":"819012345678"}}}`), &j)
+	msisdn := func(k string) bool {
+		return strings.Contains(strings.ToLower(k), "msisdn")
+	}
+	imsi := func(k string) bool { return strings.EqualFold(k, "imsi") }
+
+	if !findValue(j, "819012345678", msisdn, false) {
+		t.Error("MSISDN in AddressString is not found")
+	}
+	if !findValue(j, "440101234567890", imsi, false) {
+		t.Error("IMSI is not found")
+	}
+	if findValue(j, "819012345678", imsi, false) {
+		t.Error("MSISDN is found as IMSI")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fkgi/gsmap"
+	_ "github.com/fkgi/gsmap/ifc"
+	_ "github.com/fkgi/gsmap/ifd"
+	_ "github.com/fkgi/gsmap/ife"
+	"github.com/fkgi/gsmap/tcap"
+	"github.com/fkgi/gsmap/xua"
+)
+
+var (
+	verbose   *bool
+	jsonLines *bool
+	summary   *bool
+	variant   xua.Variant
+	filter    matcher
+	out       = json.NewEncoder(os.Stdout)
+)
+
+// record is decoded MAP message in captured packet.
+type record struct {
+	time     time.Time
+	src, dst string
+	sid      uint16
+	ppid     uint32
+	ud       xua.Unitdata
+	msg      tcap.Message
+}
+
+func main() {
+	jsonLines = flag.Bool("j", false, "output in JSON Lines")
+	summary = flag.Bool("s", false, "output dialogue summaries")
+	sv := flag.String("V", "itu", "SCCP variant itu|ansi|ttc")
+	pcf := flag.String("P", "integer", "point code format integer|3-8-3|8-8-8|5-4-7")
+	flag.StringVar(&filter.imsi, "imsi", "", "filter by IMSI")
+	flag.StringVar(&filter.msisdn, "msisdn", "", "filter by MSISDN")
+	flag.StringVar(&filter.gt, "gt", "", "filter by global title of calling or called party")
+	flag.StringVar(&filter.op, "op", "", "filter by component name")
+	verbose = flag.Bool("v", false, "Verbose log output")
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+	switch *sv {
+	case "itu":
+		variant = xua.ITU
+	case "ansi":
+		variant = xua.ANSI
+	case "ttc":
+		variant = xua.TTC
+	default:
+		log.Fatalln("[ERROR]", "invalid SCCP variant")
+	}
+	var e error
+	if xua.PointCodeFormat, e = xua.ParsePCFormat(*pcf); e != nil {
+		log.Fatalln("[ERROR]", e)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	c := newCorrelator()
+	for _, f := range files {
+		if e = decodeFile(f, c); e != nil {
+			log.Fatalln("[ERROR]", "failed to read", f+":", e)
+		}
+	}
+	c.flush()
+}
+
+func decodeFile(name string, c *correlator) error {
+	var f io.Reader = os.Stdin
+	if name != "-" {
+		file, e := os.Open(name)
+		if e != nil {
+			return e
+		}
+		defer file.Close()
+		f = file
+	}
+
+	r, e := newReader(f)
+	if e != nil {
+		return e
+	}
+	reasm := sctpReassembler{}
+	segs := sccpReassembler{}
+	defer segs.flush()
+	for n := 1; ; n++ {
+		pkt, e := r.next()
+		if errors.Is(e, io.EOF) {
+			return nil
+		} else if errors.Is(e, io.ErrUnexpectedEOF) {
+			log.Println("[WARN]", "capture is truncated at packet", n)
+			return nil
+		} else if e != nil {
+			return e
+		}
+
+		src, dst, sctp, ok := ipPayload(pkt.link, pkt.data)
+		if !ok {
+			continue
+		}
+		for _, ch := range reasm.chunks(src, dst, sctp) {
+			switch ch.ppid {
+			case 0, 3, 4: // unspecified, M3UA, SUA
+			default:
+				continue
+			}
+			ud, e := xua.DecodeUnitdata(ch.data, variant)
+			if e != nil {
+				// non data message such as ASPSM or MGMT
+				continue
+			}
+			if ud, ok = segs.add(n, ch.src, ch.dst, ud); !ok {
+				continue
+			}
+			msg, e := tcap.Unmarshal(ud.Data)
+			if e != nil && *verbose {
+				log.Printf("[INFO] failed to decode TCAP in packet %d: %v", n, e)
+			}
+			if msg == nil {
+				continue
+			}
+			c.add(&record{
+				time: pkt.time,
+				src:  ch.src,
+				dst:  ch.dst,
+				sid:  ch.sid,
+				ppid: ch.ppid,
+				ud:   ud,
+				msg:  msg})
+		}
+	}
+}
+
+// printRecord outputs decoded message.
+func printRecord(r *record) {
+	if *jsonLines {
+		if e := out.Encode(recordJSON(r)); e != nil {
+			log.Fatalln("[ERROR]", e)
+		}
+		return
+	}
+
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "%s %s > %s stream=%d",
+		r.time.Format(time.RFC3339Nano), r.src, r.dst, r.sid)
+	if r.ppid == 3 {
+		fmt.Fprintf(buf, " opc=%s dpc=%s", r.ud.OPC, r.ud.DPC)
+	}
+	fmt.Fprintf(buf, "\n | cgpa: %s\n | cdpa: %s\n%s\n",
+		addrString(r.ud.CallingParty), addrString(r.ud.CalledParty), r.msg)
+	fmt.Println(buf.String())
+}
+
+func recordJSON(r *record) map[string]any {
+	j := map[string]any{
+		"time":   r.time,
+		"src":    r.src,
+		"dst":    r.dst,
+		"stream": r.sid,
+		"cgpa":   r.ud.CallingParty,
+		"cdpa":   r.ud.CalledParty}
+	if r.ppid == 3 {
+		j["opc"] = r.ud.OPC.String()
+		j["dpc"] = r.ud.DPC.String()
+	}
+
+	var d tcap.Dialogue
+	switch m := r.msg.(type) {
+	case *tcap.Unidirectional:
+		j["tcap"] = "Unidirectional"
+		d = m.Dialogue()
+	case *tcap.TcBegin:
+		j["tcap"] = "Begin"
+		j["otid"] = fmt.Sprintf("%x", m.OTID())
+		d = m.Dialogue()
+	case *tcap.TcContinue:
+		j["tcap"] = "Continue"
+		j["otid"] = fmt.Sprintf("%x", m.OTID())
+		j["dtid"] = fmt.Sprintf("%x", m.DTID())
+		d = m.Dialogue()
+	case *tcap.TcEnd:
+		j["tcap"] = "End"
+		j["dtid"] = fmt.Sprintf("%x", m.DTID())
+		d = m.Dialogue()
+	case *tcap.TcAbort:
+		j["tcap"] = "Abort"
+		j["dtid"] = fmt.Sprintf("%x", m.DTID())
+		c, u := m.Cause()
+		if u != nil {
+			d = u
+		} else {
+			j["cause"] = c.String()
+		}
+	}
+	if d != nil {
+		j["dialogue"] = d
+	}
+
+	cs := []map[string]gsmap.Component{}
+	for _, c := range r.msg.Components() {
+		cs = append(cs, map[string]gsmap.Component{c.Name(): c})
+	}
+	if len(cs) != 0 {
+		j["components"] = cs
+	}
+	return j
+}
+
+func addrString(a xua.SCCPAddr) string {
+	s := []string{}
+	if gt := a.GlobalTitle.Digits.String(); gt != "" {
+		s = append(s, "gt="+gt)
+	}
+	if a.PointCode != 0 {
+		s = append(s, "pc="+a.PointCode.String())
+	}
+	if a.SubsystemNumber != 0 {
+		s = append(s, fmt.Sprint("ssn=", a.SubsystemNumber))
+	}
+	return strings.Join(s, " ")
+}
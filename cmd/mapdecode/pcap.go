@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// packet is captured frame.
+type packet struct {
+	time time.Time
+	link uint16
+	data []byte
+}
+
+// reader reads packets from pcap or pcapng file.
+type reader interface {
+	next() (packet, error)
+}
+
+func newReader(r io.Reader) (reader, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, e := br.Peek(4)
+	if e != nil {
+		return nil, e
+	}
+	switch binary.LittleEndian.Uint32(magic) {
+	case 0x0A0D0D0A:
+		return &pcapngReader{r: br}, nil
+	case 0xA1B2C3D4, 0xA1B23C4D:
+		return newPcapReader(br, binary.LittleEndian)
+	}
+	switch binary.BigEndian.Uint32(magic) {
+	case 0xA1B2C3D4, 0xA1B23C4D:
+		return newPcapReader(br, binary.BigEndian)
+	}
+	return nil, errors.New("unknown file format")
+}
+
+/*
+pcapReader reads classic pcap file.
+
+	Global Header: magic(4) version(2+2) thiszone(4) sigfigs(4) snaplen(4) network(4)
+	Record Header: ts_sec(4) ts_usec(4) incl_len(4) orig_len(4)
+*/
+type pcapReader struct {
+	r    io.Reader
+	bo   binary.ByteOrder
+	link uint16
+	nano bool
+}
+
+func newPcapReader(r io.Reader, bo binary.ByteOrder) (*pcapReader, error) {
+	hdr := make([]byte, 24)
+	if _, e := io.ReadFull(r, hdr); e != nil {
+		return nil, e
+	}
+	return &pcapReader{
+		r:    r,
+		bo:   bo,
+		link: uint16(bo.Uint32(hdr[20:24])),
+		nano: bo.Uint32(hdr[0:4]) == 0xA1B23C4D}, nil
+}
+
+func (p *pcapReader) next() (packet, error) {
+	hdr := make([]byte, 16)
+	if _, e := io.ReadFull(p.r, hdr); e != nil {
+		return packet{}, e
+	}
+	frac := int64(p.bo.Uint32(hdr[4:8]))
+	if !p.nano {
+		frac *= 1000
+	}
+	pkt := packet{
+		time: time.Unix(int64(p.bo.Uint32(hdr[0:4])), frac),
+		link: p.link,
+		data: make([]byte, p.bo.Uint32(hdr[8:12]))}
+	_, e := io.ReadFull(p.r, pkt.data)
+	return pkt, e
+}
+
+/*
+pcapngReader reads pcapng file.
+Section Header, Interface Description, Enhanced Packet, Simple Packet
+and obsolete Packet block are handled and other blocks are skipped.
+*/
+type pcapngReader struct {
+	r      io.Reader
+	bo     binary.ByteOrder
+	ifaces []pcapngIface
+}
+
+type pcapngIface struct {
+	link uint16
+	// unit is time of one tick of timestamp.
+	unit float64
+}
+
+func (p *pcapngReader) next() (packet, error) {
+	for {
+		hdr := make([]byte, 8)
+		if _, e := io.ReadFull(p.r, hdr); e != nil {
+			return packet{}, e
+		}
+
+		if binary.LittleEndian.Uint32(hdr[0:4]) == 0x0A0D0D0A {
+			// byte order of new section is decided by Byte-Order Magic
+			bom := make([]byte, 4)
+			if _, e := io.ReadFull(p.r, bom); e != nil {
+				return packet{}, e
+			}
+			if binary.LittleEndian.Uint32(bom) == 0x1A2B3C4D {
+				p.bo = binary.LittleEndian
+			} else {
+				p.bo = binary.BigEndian
+			}
+			p.ifaces = nil
+			l := p.bo.Uint32(hdr[4:8])
+			if l < 16 {
+				return packet{}, fmt.Errorf("invalid block length %d", l)
+			}
+			if _, e := io.CopyN(io.Discard, p.r, int64(l-12)); e != nil {
+				return packet{}, e
+			}
+			continue
+		}
+		if p.bo == nil {
+			return packet{}, errors.New("no section header block")
+		}
+
+		typ := p.bo.Uint32(hdr[0:4])
+		l := p.bo.Uint32(hdr[4:8])
+		if l < 12 || l%4 != 0 {
+			return packet{}, fmt.Errorf("invalid block length %d", l)
+		}
+		body := make([]byte, l-8)
+		if _, e := io.ReadFull(p.r, body); e != nil {
+			return packet{}, e
+		}
+		body = body[:len(body)-4]
+
+		switch typ {
+		case 0x00000001: // Interface Description Block
+			if len(body) < 8 {
+				return packet{}, errors.New("invalid interface description block")
+			}
+			p.ifaces = append(p.ifaces, pcapngIface{
+				link: p.bo.Uint16(body[0:2]),
+				unit: p.resolution(body[8:])})
+		case 0x00000006, 0x00000002: // Enhanced Packet Block, Packet Block
+			if len(body) < 20 {
+				return packet{}, errors.New("invalid packet block")
+			}
+			var id uint32
+			if typ == 0x00000006 {
+				id = p.bo.Uint32(body[0:4])
+			} else {
+				id = uint32(p.bo.Uint16(body[0:2]))
+			}
+			if int(id) >= len(p.ifaces) {
+				return packet{}, fmt.Errorf("unknown interface %d", id)
+			}
+			ts := uint64(p.bo.Uint32(body[4:8]))<<32 | uint64(p.bo.Uint32(body[8:12]))
+			n := p.bo.Uint32(body[12:16])
+			if int(n) > len(body)-20 {
+				return packet{}, errors.New("invalid captured length")
+			}
+			sec := float64(ts) * p.ifaces[id].unit
+			return packet{
+				time: time.Unix(0, int64(sec*1e9)),
+				link: p.ifaces[id].link,
+				data: body[20 : 20+n]}, nil
+		case 0x00000003: // Simple Packet Block
+			if len(p.ifaces) == 0 || len(body) < 4 {
+				return packet{}, errors.New("invalid simple packet block")
+			}
+			n := min(int(p.bo.Uint32(body[0:4])), len(body)-4)
+			return packet{link: p.ifaces[0].link, data: body[4 : 4+n]}, nil
+		}
+	}
+}
+
+// resolution returns unit of timestamp from if_tsresol option.
+func (p *pcapngReader) resolution(opt []byte) float64 {
+	for len(opt) >= 4 {
+		code := p.bo.Uint16(opt[0:2])
+		l := int(p.bo.Uint16(opt[2:4]))
+		if code == 0 || len(opt) < 4+l {
+			break
+		}
+		if code == 9 && l == 1 { // if_tsresol
+			if v := opt[4]; v&0x80 == 0 {
+				return math.Pow10(-int(v))
+			} else {
+				return math.Pow(2, -float64(v&0x7f))
+			}
+		}
+		opt = opt[4+(l+3)/4*4:]
+	}
+	return 1e-6
+}
+
+// ipPayload returns IP addresses and payload of SCTP in frame d.
+// Fragmented IP packet is not supported.
+func ipPayload(link uint16, d []byte) (src, dst net.IP, sctp []byte, ok bool) {
+	var proto uint16
+	switch link {
+	case 1: // Ethernet
+		if len(d) < 14 {
+			return
+		}
+		proto, d = binary.BigEndian.Uint16(d[12:14]), d[14:]
+		for (proto == 0x8100 || proto == 0x88a8) && len(d) >= 4 {
+			proto, d = binary.BigEndian.Uint16(d[2:4]), d[4:]
+		}
+	case 113: // Linux cooked capture
+		if len(d) < 16 {
+			return
+		}
+		proto, d = binary.BigEndian.Uint16(d[14:16]), d[16:]
+	case 276: // Linux cooked capture v2
+		if len(d) < 20 {
+			return
+		}
+		proto, d = binary.BigEndian.Uint16(d[0:2]), d[20:]
+	case 0: // BSD loopback
+		if len(d) < 4 {
+			return
+		}
+		d = d[4:]
+	case 12, 101, 228, 229: // Raw IP
+	default:
+		return
+	}
+	if len(d) == 0 {
+		return
+	}
+	if proto == 0 {
+		if d[0]>>4 == 6 {
+			proto = 0x86dd
+		} else {
+			proto = 0x0800
+		}
+	}
+
+	switch proto {
+	case 0x0800:
+		if len(d) < 20 || d[0]>>4 != 4 {
+			return
+		}
+		hl := int(d[0]&0x0f) * 4
+		tl := int(binary.BigEndian.Uint16(d[2:4]))
+		if d[9] != 132 || hl < 20 || tl < hl || tl > len(d) ||
+			binary.BigEndian.Uint16(d[6:8])&0x3fff != 0 {
+			return
+		}
+		return net.IP(d[12:16]), net.IP(d[16:20]), d[hl:tl], true
+	case 0x86dd:
+		if len(d) < 40 || d[0]>>4 != 6 {
+			return
+		}
+		src, dst = net.IP(d[8:24]), net.IP(d[24:40])
+		next := d[6]
+		pl := int(binary.BigEndian.Uint16(d[4:6]))
+		if 40+pl > len(d) {
+			return
+		}
+		d = d[40 : 40+pl]
+		for next == 0 || next == 43 || next == 60 { // extension header
+			if len(d) < 8 || len(d) < (int(d[1])+1)*8 {
+				return
+			}
+			next, d = d[0], d[(int(d[1])+1)*8:]
+		}
+		if next != 132 {
+			return
+		}
+		return src, dst, d, true
+	}
+	return
+}
+
+// chunk is payload of SCTP DATA chunk.
+type chunk struct {
+	src, dst string
+	sid      uint16
+	ppid     uint32
+	data     []byte
+}
+
+// sctpReassembler reassembles fragmented user message in DATA chunks.
+type sctpReassembler map[string][]byte
+
+// chunks returns user messages in SCTP packet d.
+func (r sctpReassembler) chunks(src, dst net.IP, d []byte) (c []chunk) {
+	if len(d) < 12 {
+		return
+	}
+	sa := net.JoinHostPort(src.String(), fmt.Sprint(binary.BigEndian.Uint16(d[0:2])))
+	da := net.JoinHostPort(dst.String(), fmt.Sprint(binary.BigEndian.Uint16(d[2:4])))
+
+	for d = d[12:]; len(d) >= 4; {
+		typ, flags := d[0], d[1]
+		l := int(binary.BigEndian.Uint16(d[2:4]))
+		if l < 4 || l > len(d) {
+			return
+		}
+		v := d[4:l]
+		d = d[min((l+3)/4*4, len(d)):]
+		if typ != 0 || len(v) < 12 { // DATA
+			continue
+		}
+
+		sid := binary.BigEndian.Uint16(v[4:6])
+		key := fmt.Sprintf("%s>%s/%d", sa, da, sid)
+		data := v[12:]
+		switch flags & 0x03 {
+		case 0x03: // B and E
+		case 0x02: // B
+			r[key] = append([]byte{}, data...)
+			continue
+		case 0x00: // middle
+			if b, ok := r[key]; ok {
+				r[key] = append(b, data...)
+			}
+			continue
+		case 0x01: // E
+			b, ok := r[key]
+			delete(r, key)
+			if !ok {
+				continue
+			}
+			data = append(b, data...)
+		}
+		c = append(c, chunk{
+			src: sa, dst: da, sid: sid,
+			ppid: binary.BigEndian.Uint32(v[8:12]),
+			data: data})
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/fkgi/gsmap/xua"
+)
+
+// sccpReassembler reassembles segmented SCCP data in XUDT, LUDT or SUA CLDT.
+// Segments are keyed by source, destination, calling party and
+// segmentation local reference.
+type sccpReassembler map[string]*sccpSegments
+
+type sccpSegments struct {
+	ud     xua.Unitdata
+	remain uint8
+	packet int
+}
+
+// add handles unitdata ud in packet n, and returns reassembled data
+// if ud is not segmented or it is the last segment.
+func (r sccpReassembler) add(n int, src, dst string, ud xua.Unitdata) (xua.Unitdata, bool) {
+	if !ud.Segmented {
+		return ud, true
+	}
+	key := fmt.Sprintf("%s>%s/%06x:%s",
+		src, dst, ud.SegmentRef, addrString(ud.CallingParty))
+
+	buf, found := r[key]
+	switch {
+	case ud.FirstSegment:
+		if found {
+			log.Println("[WARN]", "segmented SCCP data in packet", buf.packet,
+				"is restarted by new first segment in packet", n)
+		}
+		ud.Data = append([]byte{}, ud.Data...)
+		r[key] = &sccpSegments{ud: ud, remain: ud.RemainingSegments, packet: n}
+		return ud, false
+
+	case !found || ud.RemainingSegments != buf.remain-1:
+		if found {
+			log.Println("[WARN]", "segmented SCCP data in packet", buf.packet,
+				"is not completed")
+			delete(r, key)
+		}
+		log.Println("[WARN]", "unexpected SCCP segment in packet", n)
+		return ud, false
+	}
+
+	buf.remain = ud.RemainingSegments
+	buf.ud.Data = append(buf.ud.Data, ud.Data...)
+	if buf.remain != 0 {
+		return ud, false
+	}
+	delete(r, key)
+	ud = buf.ud
+	ud.Segmented = false
+	ud.FirstSegment = false
+	ud.SegmentRef = 0
+	return ud, true
+}
+
+// flush warns segmented SCCP data that is not completed.
+func (r sccpReassembler) flush() {
+	for key, buf := range r {
+		log.Println("[WARN]", "segmented SCCP data in packet", buf.packet,
+			"is not completed")
+		delete(r, key)
+	}
+}
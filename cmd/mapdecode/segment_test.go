@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fkgi/gsmap/xua"
+)
+
+func segment(first bool, remain uint8, ref uint32, data string) xua.Unitdata {
+	return xua.Unitdata{
+		CallingParty:      xua.SCCPAddr{PointCode: 1, SubsystemNumber: 6},
+		Data:              []byte(data),
+		Segmented:         true,
+		FirstSegment:      first,
+		RemainingSegments: remain,
+		SegmentRef:        ref}
+}
+
+func TestSCCPReassembler(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		segs []xua.Unitdata
+		want []string
+	}{
+		{"not segmented", []xua.Unitdata{{Data: []byte("abc")}}, []string{"abc"}},
+		{"in order", []xua.Unitdata{
+			segment(true, 2, 1, "ab"), segment(false, 1, 1, "cd"),
+			segment(false, 0, 1, "e")}, []string{"abcde"}},
+		{"interleaved", []xua.Unitdata{
+			segment(true, 1, 1, "ab"), segment(true, 1, 2, "xy"),
+			segment(false, 0, 2, "z"), segment(false, 0, 1, "c")}, []string{"xyz", "abc"}},
+		{"out of order", []xua.Unitdata{
+			segment(true, 2, 1, "ab"), segment(false, 0, 1, "e"),
+			segment(false, 1, 1, "cd")}, nil},
+		{"missing first", []xua.Unitdata{
+			segment(false, 1, 1, "cd"), segment(false, 0, 1, "e")}, nil},
+		{"restarted", []xua.Unitdata{
+			segment(true, 1, 1, "ab"), segment(true, 1, 1, "xy"),
+			segment(false, 0, 1, "z")}, []string{"xyz"}},
+	} {
+		r := sccpReassembler{}
+		var got []string
+		for i, s := range tc.segs {
+			if ud, ok := r.add(i+1, "src", "dst", s); ok {
+				got = append(got, string(ud.Data))
+				if ud.Segmented {
+					t.Errorf("%s: reassembled data is segmented", tc.name)
+				}
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
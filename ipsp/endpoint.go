@@ -37,9 +37,9 @@ func NewSignalingEndpoint(a *SCTPAddr) (se *SignalingEndpoint, e error) {
 	var sock int
 	if a == nil || len(a.IP) == 0 {
 		e = fmt.Errorf("nil address")
-	} else if a.IP[0].To4() == nil {
+	} else if len(a.rawBytes()) == 0 {
 		e = fmt.Errorf("invalid address")
-	} else if sock, e = sockOpen(); e != nil {
+	} else if sock, e = sockOpen(a.isIPv6()); e != nil {
 	} else if e = sctpBindx(sock, a.rawBytes()); e != nil {
 		sockClose(sock)
 	} else if e = sockListen(sock); e != nil {
@@ -81,6 +81,9 @@ func NewSignalingEndpoint(a *SCTPAddr) (se *SignalingEndpoint, e error) {
 			for req, ok := <-se.sharedQ; ok; req, ok = <-se.sharedQ {
 				if se.PayloadHandler == nil {
 					c := se.selectASP()
+					if c == nil {
+						continue
+					}
 					c.msgQ <- &DATA{
 						ctx:      c.ctx,
 						cause:    SubsystemFailure,
@@ -153,12 +156,24 @@ func (se *SignalingEndpoint) selectASP() (c *ASP) {
 		}
 	}
 	se.asps <- asps
+	if len(list) == 0 {
+		return nil
+	}
 	c = list[rand.Intn(len(list))]
 	return
 }
 
-func (se *SignalingEndpoint) Write(dpc uint32, cdpa SCCPAddr, data []byte) {
+// Write sends data to cdpa via one of active ASPs.
+// Error is returned if no ASP is active or sending is failed.
+func (se *SignalingEndpoint) Write(dpc uint32, cdpa SCCPAddr, data []byte) error {
 	c := se.selectASP()
+	if c == nil {
+		e := fmt.Errorf("no active ASP")
+		if TxFailureNotify != nil {
+			TxFailureNotify(e, data)
+		}
+		return e
+	}
 	seq := <-se.sequence
 	se.sequence <- seq + 1
 
@@ -176,7 +191,9 @@ func (se *SignalingEndpoint) Write(dpc uint32, cdpa SCCPAddr, data []byte) {
 			cdpa: cdpa,
 			data: data},
 		result: r}
-	if e := <-r; e != nil && TxFailureNotify != nil {
+	e := <-r
+	if e != nil && TxFailureNotify != nil {
 		TxFailureNotify(e, data)
 	}
+	return e
 }
@@ -10,7 +10,13 @@ import (
 	"unsafe"
 )
 
-func sockOpen() (int, error) {
+// sockOpen opens one-to-many style SCTP socket.
+// AF_INET6 socket is used for IPv6 address,
+// and it also accepts IPv4 address for dual-stack multihoming.
+func sockOpen(v6 bool) (int, error) {
+	if v6 {
+		return syscall.Socket(syscall.AF_INET6, syscall.SOCK_SEQPACKET, syscall.IPPROTO_SCTP)
+	}
 	return syscall.Socket(syscall.AF_INET, syscall.SOCK_SEQPACKET, syscall.IPPROTO_SCTP)
 }
 
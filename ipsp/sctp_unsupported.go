@@ -4,7 +4,7 @@ package ipsp
 
 import "unsafe"
 
-func sockOpen() (int, error) {
+func sockOpen(bool) (int, error) {
 	return 0, nil
 }
 
@@ -39,15 +39,26 @@ func main() {
 	l := flag.String("l", "", "local address")
 	flag.Var(&peerAddrs, "p", "peer address")
 	rc := flag.Uint("r", 0, "routing context")
-	ppc := flag.Uint("c", 0, "peer point code")
-	lpc := flag.Uint("d", 0, "local point code")
+	tm := flag.String("m", "loadshare", "traffic mode loadshare|override|broadcast")
+	dyn := flag.Bool("k", false, "register routing key dynamically")
+	ppc := flag.String("c", "", "peer point code")
+	lpc := flag.String("d", "", "local point code")
+	pcf := flag.String("P", "integer", "point code format integer|3-8-3|8-8-8|5-4-7")
 	ni := flag.Uint("i", 0, "network indicator")
 	na := flag.Int("n", -1, "network appearance")
 	gt := flag.String("g", "", "global title address")
+	rt := flag.String("R", "", "GT routing file")
+	hb := flag.Int("H", 0, "Heartbeat interval [s]")
+	tp := flag.String("T", "sctp", "transport sctp|tcp")
+	up := flag.String("u", "m3ua", "xUA protocol m3ua|sua")
+	sv := flag.String("V", "itu", "SCCP variant itu|ansi|ttc")
 	ssn := flag.String("s", "", "subsystem number msc|hlr|vlr")
 	api := flag.String("a", ":8080", "local API port")
 	be := flag.String("b", "localhost:80", "backend API port")
 	to := flag.Int("t", int(tcap.Tw/time.Second), "Message timeout timer [s]")
+	pcap := flag.String("w", "", "pcapng capture file")
+	pcapSize := flag.Int64("W", 0, "rotate capture file by size [MB]")
+	drain := flag.Int("D", 0, "drain timeout of open transactions at shutdown [s]")
 	verbose = flag.Bool("v", false, "Verbose log output")
 	flag.Parse()
 
@@ -66,18 +77,38 @@ func main() {
 		pa = append(pa, p)
 	}
 
-	if *lpc == 0 || *ppc == 0 {
-		log.Fatalln("[ERROR]", "point code is not specified")
+	if xua.PointCodeFormat, e = xua.ParsePCFormat(*pcf); e != nil {
+		log.Fatalln("[ERROR]", e)
+	}
+	var localPC xua.PointCode
+	if *lpc == "" {
+	} else if localPC, e = xua.ParsePointCode(*lpc); e != nil {
+		log.Fatalln("[ERROR]", "invalid local point code:", e)
+	}
+	if *ppc == "" {
+	} else if tcap.PeerPointCode, e = xua.ParsePointCode(*ppc); e != nil {
+		log.Fatalln("[ERROR]", "invalid peer point code:", e)
+	}
+	if tcap.PeerPointCode != 0 && localPC == 0 {
+		log.Fatalln("[ERROR]", "local point code is not specified")
 	}
 	if *rc == 0 {
 		log.Fatalln("[ERROR]", "routing context is not specified")
 	}
 
-	tcap.EndPoint, e = xua.NewSignalingEndpoint(la)
+	switch *tp {
+	case "sctp":
+		tcap.EndPoint, e = xua.NewSignalingEndpoint(la)
+	case "tcp":
+		tcap.EndPoint, e = xua.NewTCPSignalingEndpoint(la)
+	default:
+		log.Fatalln("[ERROR]", "invalid transport:", *tp)
+	}
 	if e != nil {
 		log.Fatalln("[ERROR]", "failed to bind:", e)
 	}
 	tcap.EndPoint.ReturnOnError = true
+	tcap.EndPoint.HeartbeatInterval = time.Duration(*hb) * time.Second
 	if *ni > 0 && *ni < 4 {
 		tcap.EndPoint.NetIndicator = uint8(*ni)
 	}
@@ -86,6 +117,14 @@ func main() {
 		tcap.EndPoint.NetAppearance = &tmp
 	}
 	tcap.EndPoint.PayloadHandler = tcap.HandlePayload
+	tcap.EndPoint.NoticeHandler = tcap.HandleNotice
+	tcap.EndPoint.Dispatch.Key = tcap.TransactionKey
+	tcap.EndPoint.Events = make(chan xua.ASPEvent, 64)
+	go func(ev chan xua.ASPEvent) {
+		for v := range ev {
+			log.Println("[INFO]", v)
+		}
+	}(tcap.EndPoint.Events)
 
 	tcap.EndPoint.GlobalTitle.NatureOfAddress = teldata.International
 	tcap.EndPoint.GlobalTitle.NumberingPlan = teldata.ISDNTelephony
@@ -104,9 +143,57 @@ func main() {
 		log.Fatalln("[ERROR]", "invalid subsystem number")
 	}
 
-	tcap.EndPoint.PointCode = uint32(*lpc)
+	tcap.EndPoint.PointCode = localPC
 	tcap.EndPoint.Context = uint32(*rc)
-	tcap.PeerPointCode = uint32(*ppc)
+	switch *up {
+	case "m3ua":
+		tcap.EndPoint.Protocol = xua.M3UA
+	case "sua":
+		tcap.EndPoint.Protocol = xua.SUA
+	default:
+		log.Fatalln("[ERROR]", "invalid xUA protocol:", *up)
+	}
+	log.Println("[INFO]", "transport protocol is", tcap.EndPoint.Protocol)
+
+	as := &xua.AS{
+		Context:       tcap.EndPoint.Context,
+		NetAppearance: tcap.EndPoint.NetAppearance,
+		PointCode:     tcap.EndPoint.PointCode,
+		Dynamic:       *dyn}
+	switch *tm {
+	case "loadshare":
+		as.Mode = xua.Loadshare
+	case "override":
+		as.Mode = xua.Override
+	case "broadcast":
+		as.Mode = xua.Broadcast
+	default:
+		log.Fatalln("[ERROR]", "invalid traffic mode")
+	}
+	if tcap.EndPoint.SubsystemNumber != 0 {
+		as.SubsystemNumbers = []teldata.SubsystemNumber{tcap.EndPoint.SubsystemNumber}
+	}
+	tcap.EndPoint.AddAS(as)
+	log.Println("[INFO]", "traffic mode is", *tm)
+
+	switch *sv {
+	case "itu":
+		tcap.EndPoint.Variant = xua.ITU
+	case "ansi":
+		tcap.EndPoint.Variant = xua.ANSI
+	case "ttc":
+		tcap.EndPoint.Variant = xua.TTC
+	default:
+		log.Fatalln("[ERROR]", "invalid SCCP variant")
+	}
+
+	if *rt != "" {
+		if tcap.EndPoint.Router, e = xua.LoadRouter(*rt); e != nil {
+			log.Fatalln("[ERROR]", "failed to load routing file:", e)
+		}
+		tcap.EndPoint.Router.Watch(*rt, time.Second*10)
+		log.Println("[INFO]", "GT routing file is", *rt)
+	}
 
 	tcap.Tw = time.Duration(*to) * time.Second
 
@@ -156,6 +243,7 @@ func main() {
 	http.HandleFunc("POST /dialog/{id}", handleContinueDialog)
 	http.HandleFunc("DELETE /dialog/{id}", handleContinueDialog)
 	http.HandleFunc("GET /mapstate/v1/connection", conStateHandler)
+	http.HandleFunc("PUT /mapstate/v1/asp/{id}/{state}", aspControlHandler)
 	http.HandleFunc("GET /mapstate/v1/statistics", statsHandler)
 	go func() {
 		log.Fatalln(http.ListenAndServe(*api, nil))
@@ -167,10 +255,36 @@ func main() {
 			log.Fatalln("ERROR", "failed to connect ASP:", e)
 		}
 	}
+	capture := xua.Capture{Path: *pcap, MaxSize: *pcapSize << 20}
+	if capture.Path != "" {
+		if e = xua.StartCapture(capture); e != nil {
+			log.Fatalln("[ERROR]", "failed to start capture:", e)
+		}
+	}
+
 	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sigc
-	tcap.EndPoint.Close()
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGUSR1)
+	for s := <-sigc; s == syscall.SIGUSR1; s = <-sigc {
+		switch {
+		case capture.Path == "":
+			log.Println("[INFO]", "capture file is not specified")
+		case xua.Capturing():
+			xua.StopCapture()
+			log.Println("[INFO]", "capture is stopped")
+		default:
+			if e = xua.StartCapture(capture); e != nil {
+				log.Println("[ERROR]", "failed to start capture:", e)
+			}
+		}
+	}
+	if *drain > 0 {
+		s := tcap.Drain(time.Duration(*drain) * time.Second)
+		log.Printf("[INFO] drained: open=%d, rejected=%d, aborted=%d, elapsed=%s",
+			s.Open, s.Rejected, s.Aborted, s.Elapsed)
+	} else {
+		tcap.EndPoint.Close()
+	}
+	xua.StopCapture()
 }
 
 func readFromJSON(d []byte, defaultID int8) (cdpa xua.SCCPAddr, cgpa *xua.SCCPAddr, cpnt []gsmap.Component, e error) {
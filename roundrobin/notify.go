@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/fkgi/gsmap"
 	"github.com/fkgi/gsmap/tcap"
@@ -18,6 +19,19 @@ func init() {
 	xua.SctpNotify = func(id byte, s string) {
 		log.Printf("[INFO] SCTP: id=0x%2x, %s", id, s)
 	}
+	xua.AssociationNotify = func(ev xua.AssociationEvent) {
+		if *verbose {
+			log.Printf("[INFO] association: %s", ev)
+		}
+	}
+	xua.HeartbeatNotify = func(id byte, rtt time.Duration) {
+		if *verbose {
+			log.Printf("[INFO] heartbeat: id=0x%2x, RTT=%s", id, rtt)
+		}
+	}
+	xua.DrainNotify = func(p xua.DrainPhase, pending int) {
+		log.Printf("[INFO] drain: phase=%s, pending=%d", p, pending)
+	}
 
 	tcap.TraceMessage = func(m tcap.Message, d tcap.Direction, err error) {
 		log.Printf("[INFO] %s MAP message handling: error=%v\n%s", d, err, m.String())
@@ -61,23 +75,47 @@ func init() {
 		}
 	}
 
-	xua.DunaNotify = func(pc []xua.PointCode) {
+	xua.DunaNotify = func(pc []xua.AffectedPointCode) {
 		log.Printf("[INFO] Rx DUNA for PC=%v", pc)
 	}
-	xua.DavaNotify = func(pc []xua.PointCode) {
+	xua.DavaNotify = func(pc []xua.AffectedPointCode) {
 		log.Printf("[INFO] Rx DAVA for PC=%v", pc)
 	}
-	xua.DaudNotify = func(pc []xua.PointCode) {
+	xua.DaudNotify = func(pc []xua.AffectedPointCode) {
 		log.Printf("[INFO] Tx DAUD for PC=%v", pc)
 	}
-	xua.SconNotify = func(pc []xua.PointCode, con uint32) {
+	xua.SconNotify = func(pc []xua.AffectedPointCode, con uint32) {
 		log.Printf("[INFO] Rx SCON for PC=%v, congestion level=%d", pc, con)
 	}
-	xua.DupuNotify = func(pc []xua.PointCode, cause uint16) {
+	xua.DupuNotify = func(pc []xua.AffectedPointCode, cause uint16) {
 		log.Printf("[INFO] Rx DUPU for PC=%v, cause=%d", pc, cause)
 	}
-	xua.DrstNotify = func(pc []xua.PointCode) {
+	xua.DrstNotify = func(pc []xua.AffectedPointCode) {
 		log.Printf("[INFO] Rx DRST for PC=%v", pc)
 	}
+	xua.DestinationNotify = func(d xua.Destination) {
+		log.Printf("[INFO] destination %s", d)
+	}
+	xua.SubsystemNotify = func(s xua.Subsystem, allowed bool) {
+		if allowed {
+			log.Printf("[INFO] subsystem %s is allowed", s)
+		} else {
+			log.Printf("[INFO] subsystem %s is prohibited", s)
+		}
+	}
+	xua.RoutingNotify = func(path string, e error) {
+		if e != nil {
+			log.Printf("[ERROR] failed to reload routing file %s: %v", path, e)
+		} else {
+			log.Printf("[INFO] routing file %s is reloaded", path)
+		}
+	}
+	xua.CaptureNotify = func(path string, e error) {
+		if e != nil {
+			log.Printf("[ERROR] capture is stopped: %s %v", path, e)
+		} else {
+			log.Printf("[INFO] capture file %s is opened", path)
+		}
+	}
 
 }
@@ -1,26 +1,80 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/fkgi/gsmap/tcap"
+	"github.com/fkgi/gsmap/xua"
 )
 
-const constatFmt = `{
-	"state": "%s",
-	"local": {
-		"address": "%s",
-		"gt": "%s"
-	},
-	"peer": {
-		"address": "%s"
-	}
-}`
+type aspState struct {
+	ID         byte   `json:"id"`
+	State      string `json:"state"`
+	Local      string `json:"local"`
+	Peer       string `json:"peer"`
+	TxTransfer uint64 `json:"tx_transfer"`
+	RxTransfer uint64 `json:"rx_transfer"`
+	TxResponse uint64 `json:"tx_response"`
+	RxResponse uint64 `json:"rx_response"`
+	RTT        string `json:"rtt"`
+}
 
 func conStateHandler(w http.ResponseWriter, r *http.Request) {
+	list := []aspState{}
+	for _, c := range tcap.EndPoint.ASPs() {
+		list = append(list, aspState{
+			ID:         c.ID,
+			State:      c.State.String(),
+			Local:      fmt.Sprint(c.LocalAddr),
+			Peer:       fmt.Sprint(c.PeerAddr),
+			TxTransfer: c.TxTransfer,
+			RxTransfer: c.RxTransfer,
+			TxResponse: c.TxResponse,
+			RxResponse: c.RxResponse,
+			RTT:        c.RTT.String()})
+	}
+	data, _ := json.Marshal(struct {
+		GT   string     `json:"gt"`
+		ASPs []aspState `json:"asp"`
+	}{GT: tcap.EndPoint.GlobalTitle.Digits.String(), ASPs: list})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf(constatFmt, "", "", "", "")))
-	//	asp.State(), asp.LocalAddr(), xua.LocalAddr.GlobalTitle, asp.RemoteAddr())))
+	w.Write(data)
+}
+
+// aspControlHandler changes state of ASP to active, inactive or down.
+func aspControlHandler(w http.ResponseWriter, r *http.Request) {
+	id, e := strconv.ParseUint(r.PathValue("id"), 10, 8)
+	if e != nil {
+		httpErr("invalid ASP ID", e.Error(), http.StatusBadRequest, w)
+		return
+	}
+	switch r.PathValue("state") {
+	case "active":
+		e = tcap.EndPoint.ActivateASP(byte(id))
+	case "inactive":
+		e = tcap.EndPoint.InactivateASP(byte(id))
+	case "down":
+		e = tcap.EndPoint.DownASP(byte(id))
+	default:
+		httpErr("invalid ASP state", r.PathValue("state"), http.StatusNotFound, w)
+		return
+	}
+
+	if e == xua.ErrUnknownASP {
+		httpErr("unknown ASP", r.PathValue("id"), http.StatusNotFound, w)
+	} else if e != nil {
+		log.Println("[ERROR]", "failed to change ASP state:", e)
+		httpErr("failed to change ASP state", e.Error(),
+			http.StatusInternalServerError, w)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
 var (
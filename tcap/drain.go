@@ -0,0 +1,89 @@
+package tcap
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/fkgi/gsmap/xua"
+)
+
+var (
+	draining atomic.Bool
+	rejected atomic.Uint64
+)
+
+// DrainStats is result of Drain.
+type DrainStats struct {
+	xua.DrainStats
+	// Open is number of transactions that are open at the start of Drain.
+	Open int
+	// Rejected is number of TC-BEGIN that is aborted while draining.
+	Rejected uint64
+	// Aborted is number of transactions that are aborted at the deadline.
+	Aborted int
+}
+
+// ActiveTransactions returns number of open transactions.
+func ActiveTransactions() int {
+	tcs := <-activeTC
+	defer func() { activeTC <- tcs }()
+	return len(tcs)
+}
+
+/*
+Drain closes EndPoint gracefully.
+Received TC-BEGIN is aborted with resourceLimitation while draining,
+and open transactions are continued until timeout.
+Transactions that are still open at the timeout are aborted
+with resourceLimitation to the peer before EndPoint is closed,
+and with TcShutdown locally.
+Progress is reported with xua.DrainNotify.
+*/
+func Drain(timeout time.Duration) (s DrainStats) {
+	draining.Store(true)
+	rejected.Store(0)
+	defer draining.Store(false)
+
+	s.Open = ActiveTransactions()
+	if EndPoint != nil {
+		s.DrainStats = EndPoint.Drain(timeout, ActiveTransactions, func() {
+			s.Aborted += abortAll()
+		})
+	}
+	s.Rejected = rejected.Load()
+	s.Aborted += abortAll()
+	return
+}
+
+// abortAll aborts all open transactions and returns number of them.
+// Unread message of the transaction is replaced with the local abort,
+// so that the user is always notified of the shutdown.
+func abortAll() int {
+	tcs := <-activeTC
+	list := make([]*Transaction, 0, len(tcs))
+	for id, t := range tcs {
+		list = append(list, t)
+		delete(tcs, id)
+	}
+	activeTC <- tcs
+
+	for _, t := range list {
+		if t.dtid != 0 {
+			send(t.CdPA, &TcAbort{dtid: t.dtid, pCause: TcResourceLimitation}, t.sls())
+		}
+
+		m := &TcAbort{dtid: t.otid, pCause: TcShutdown}
+		for sent := false; !sent; {
+			select {
+			case t.rxStack <- m:
+				sent = true
+			default:
+				select {
+				case <-t.rxStack:
+				default:
+				}
+			}
+		}
+	}
+	return len(list)
+}
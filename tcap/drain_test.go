@@ -0,0 +1,114 @@
+package tcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fkgi/gsmap/xua"
+)
+
+func TestDrainAbort(t *testing.T) {
+	tc := &Transaction{rxStack: make(chan Message, 1)}
+	tc.register()
+
+	s := Drain(0)
+	if s.Open != 1 || s.Aborted != 1 || ActiveTransactions() != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if m, ok := (<-tc.rxStack).(*TcAbort); !ok || m.pCause != TcShutdown {
+		t.Fatalf("unexpected message %v", m)
+	}
+}
+
+// drainEndPoint sets EndPoint that is not connected to any SGP.
+func drainEndPoint(t *testing.T, port int) {
+	var e error
+	EndPoint, e = xua.NewPipeSignalingEndpoint(pipeAddr(2, port))
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() {
+		EndPoint = nil
+		xua.DrainNotify = nil
+		TraceMessage = nil
+	})
+}
+
+func TestDrainComplete(t *testing.T) {
+	drainEndPoint(t, 2906)
+	peer := xua.SCCPAddr{PointCode: 1, SubsystemNumber: 6}
+
+	tc := &Transaction{CdPA: peer, dtid: 0x1234, rxStack: make(chan Message, 1)}
+	tc.register()
+
+	xua.DrainNotify = func(p xua.DrainPhase, _ int) {
+		if p == xua.DrainInactive {
+			// peer ends the transaction while draining
+			go func() {
+				time.Sleep(time.Millisecond * 200)
+				HandlePayload(peer, xua.SCCPAddr{},
+					(&TcEnd{dtid: tc.otid}).marshalTc())
+			}()
+		}
+	}
+
+	s := Drain(time.Second * 5)
+	if s.Open != 1 || s.Pending != 0 || s.Aborted != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if m, ok := (<-tc.rxStack).(*TcEnd); !ok {
+		t.Fatalf("unexpected message %v", m)
+	}
+}
+
+func TestDrainReject(t *testing.T) {
+	drainEndPoint(t, 2907)
+	peer := xua.SCCPAddr{PointCode: 1, SubsystemNumber: 6}
+
+	tc := &Transaction{CdPA: peer, dtid: 0x1234, rxStack: make(chan Message, 1)}
+	tc.register()
+	// unread message is replaced with local abort
+	tc.rxStack <- &TcContinue{otid: tc.dtid, dtid: tc.otid}
+
+	var events []any
+	TraceMessage = func(m Message, d Direction, _ error) {
+		if d == Tx {
+			events = append(events, m)
+		}
+	}
+	xua.DrainNotify = func(p xua.DrainPhase, _ int) {
+		if p == xua.DrainInactive {
+			HandlePayload(peer, xua.SCCPAddr{},
+				(&TcBegin{otid: 0x5678}).marshalTc())
+		}
+		events = append(events, p)
+	}
+
+	s := Drain(time.Millisecond * 300)
+	if s.Open != 1 || s.Rejected != 1 || s.Aborted != 1 || s.Pending != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if m, ok := (<-tc.rxStack).(*TcAbort); !ok || m.pCause != TcShutdown {
+		t.Fatalf("unexpected message %v", m)
+	}
+
+	// TC-BEGIN is rejected, and open transaction is aborted before closing
+	begin, abort, closing := -1, -1, -1
+	for i, ev := range events {
+		switch ev := ev.(type) {
+		case *TcAbort:
+			if ev.dtid == 0x5678 && ev.pCause == TcResourceLimitation {
+				begin = i
+			} else if ev.dtid == tc.dtid && ev.pCause == TcResourceLimitation {
+				abort = i
+			}
+		case xua.DrainPhase:
+			if ev == xua.DrainClosing {
+				closing = i
+			}
+		}
+	}
+	if begin < 0 || abort < 0 || closing < abort {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
@@ -0,0 +1,54 @@
+package tcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/fkgi/gsmap"
+	"github.com/fkgi/gsmap/ifd"
+	"github.com/fkgi/gsmap/xua"
+	"github.com/fkgi/teldata"
+)
+
+func TestLoopbackM3UA(t *testing.T) {
+	hlr := xua.SCCPAddr{PointCode: 1, SubsystemNumber: 6}
+	pipePair(t, 2905, xua.M3UA, func(sgp *xua.SignalingEndpoint) {
+		sgp.PayloadHandler = func(cgpa, _ xua.SCCPAddr, data []byte) {
+			_, v, e := gsmap.ReadTLV(bytes.NewBuffer(data), 0x62)
+			if e != nil {
+				t.Error(e)
+				return
+			}
+			m, e := unmarshalTcBegin(v)
+			if e != nil {
+				t.Error(e)
+				return
+			}
+			res := &TcEnd{dtid: m.otid}
+			for _, c := range m.component {
+				if inv, ok := c.(gsmap.Invoke); ok {
+					res.component = append(res.component,
+						EmptyResult{InvokeID: inv.GetInvokeID()})
+				}
+			}
+			sgp.Write(cgpa.PointCode, cgpa, res.marshalTc())
+		}
+	})
+
+	arg := ifd.ResetArg{InvokeID: 1}
+	arg.HlrNumber.NatureOfAddress = teldata.International
+	arg.HlrNumber.NumberingPlan = teldata.ISDNTelephony
+	arg.HlrNumber.Digits, _ = teldata.ParseTBCD("819012345678")
+
+	_, c, e := DialTC(ifd.Reset1, hlr, arg)
+	if e != io.EOF {
+		t.Fatalf("unexpected result: %v", e)
+	}
+	if len(c) != 1 {
+		t.Fatalf("unexpected components: %v", c)
+	}
+	if r, ok := c[0].(EmptyResult); !ok || r.InvokeID != 1 {
+		t.Fatalf("unexpected component: %v", c[0])
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/fkgi/gsmap"
+	"github.com/fkgi/gsmap/xua"
 )
 
 /*
@@ -28,6 +29,56 @@ type Message interface {
 	fmt.Stringer
 }
 
+/*
+Unmarshal decodes TCAP message in data, for offline analysis of captured data.
+Decoded part of the message is returned with error.
+*/
+func Unmarshal(data []byte) (Message, error) {
+	t, v, e := gsmap.ReadTLV(bytes.NewBuffer(data), 0x00)
+	if e != nil {
+		return nil, e
+	}
+	switch t {
+	case 0x61: // Unidirectional
+		return unmarshalUnidirectional(v)
+	case 0x62: // Begin
+		return unmarshalTcBegin(v)
+	case 0x64: // End
+		return unmarshalTcEnd(v)
+	case 0x65: // Continue
+		return unmarshalTcContinue(v)
+	case 0x67: // Abort
+		return unmarshalTcAbort(v)
+	}
+	return nil, gsmap.UnexpectedTag([]byte{0x61, 0x62, 0x64, 0x65, 0x67}, t)
+}
+
+/*
+TransactionKey returns TID of TCAP message in data as dispatch key
+for xua.DispatchOptions. DTID is used if it exists,
+so messages of a transaction after TC-BEGIN are handled in order.
+*/
+func TransactionKey(_ xua.SCCPAddr, data []byte) (tid uint32) {
+	_, v, e := gsmap.ReadTLV(bytes.NewBuffer(data), 0x00)
+	if e != nil {
+		return
+	}
+	for buf := bytes.NewBuffer(v); buf.Len() != 0; {
+		t, v, e := gsmap.ReadTLV(buf, 0x00)
+		if e != nil || (t != 0x48 && t != 0x49) {
+			break
+		}
+		tid = 0
+		for _, b := range v {
+			tid = (tid << 8) | uint32(b)
+		}
+		if t == 0x49 {
+			break
+		}
+	}
+	return
+}
+
 func marshalTid(tag byte, tid uint32) []byte {
 	return gsmap.WriteTLV(new(bytes.Buffer), tag, []byte{
 		byte(0xff & (tid >> 24)),
@@ -134,6 +185,10 @@ func (m Unidirectional) Components() []gsmap.Component {
 	return m.component
 }
 
+func (m Unidirectional) Dialogue() Dialogue {
+	return m.dialogue
+}
+
 /*
 TcBegin message.
 
@@ -191,6 +246,15 @@ func (m TcBegin) Components() []gsmap.Component {
 	return m.component
 }
 
+func (m TcBegin) Dialogue() Dialogue {
+	return m.dialogue
+}
+
+// OTID returns originating transaction ID.
+func (m TcBegin) OTID() uint32 {
+	return m.otid
+}
+
 /*
 TcEnd message.
 
@@ -248,6 +312,15 @@ func (m TcEnd) Components() []gsmap.Component {
 	return m.component
 }
 
+func (m TcEnd) Dialogue() Dialogue {
+	return m.dialogue
+}
+
+// DTID returns destination transaction ID.
+func (m TcEnd) DTID() uint32 {
+	return m.dtid
+}
+
 /*
 TcContinue
 
@@ -313,6 +386,20 @@ func (m TcContinue) Components() []gsmap.Component {
 	return m.component
 }
 
+func (m TcContinue) Dialogue() Dialogue {
+	return m.dialogue
+}
+
+// OTID returns originating transaction ID.
+func (m TcContinue) OTID() uint32 {
+	return m.otid
+}
+
+// DTID returns destination transaction ID.
+func (m TcContinue) DTID() uint32 {
+	return m.dtid
+}
+
 /*
 TcAbort
 
@@ -329,6 +416,9 @@ type TcAbort struct {
 	dtid   uint32
 	pCause Cause
 	uCause Dialogue
+
+	// rCause is return cause of SCCP, valid only if pCause is TcNotice
+	rCause xua.Cause
 }
 
 func (m TcAbort) String() string {
@@ -336,6 +426,8 @@ func (m TcAbort) String() string {
 	fmt.Fprintf(buf, "TC-ABORT (dtid=%x)", m.dtid)
 	if m.uCause != nil {
 		fmt.Fprint(buf, "\n | u-abortCause:", m.uCause)
+	} else if m.pCause == TcNotice {
+		fmt.Fprint(buf, "\n | ", m.pCause, ": ", m.rCause)
 	} else {
 		fmt.Fprint(buf, "\n | ", m.pCause)
 	}
@@ -349,6 +441,9 @@ func (m TcAbort) Error() string {
 	if m.pCause < 0x10 {
 		return fmt.Sprint("Aborted by peer with ", m.pCause)
 	}
+	if m.pCause == TcNotice {
+		return fmt.Sprint("Returned by SCCP with ", m.rCause)
+	}
 	return fmt.Sprint("Internal error with ", m.pCause)
 }
 
@@ -374,6 +469,8 @@ const (
 	TcTimeout       Cause = 0x10
 	TcNoDestination Cause = 0x11
 	TcDiscard       Cause = 0x12
+	TcNotice        Cause = 0x13
+	TcShutdown      Cause = 0x14
 )
 
 func (c Cause) String() string {
@@ -394,6 +491,10 @@ func (c Cause) String() string {
 		return "noDestinationFound(internal)"
 	case TcDiscard:
 		return "discard(internal)"
+	case TcNotice:
+		return "notice(internal)"
+	case TcShutdown:
+		return "shutdown(internal)"
 	default:
 		return fmt.Sprintf("p-abortCause: unknown(%x)", byte(c))
 	}
@@ -453,6 +554,16 @@ func (m TcAbort) Components() []gsmap.Component {
 	return nil
 }
 
+// DTID returns destination transaction ID.
+func (m TcAbort) DTID() uint32 {
+	return m.dtid
+}
+
 func (m TcAbort) Cause() (Cause, Dialogue) {
 	return m.pCause, m.uCause
 }
+
+// ReturnCause returns return cause of SCCP if the TC is aborted by TC-NOTICE.
+func (m TcAbort) ReturnCause() xua.Cause {
+	return m.rCause
+}
@@ -0,0 +1,58 @@
+package tcap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fkgi/gsmap/xua"
+)
+
+// pipeAddr returns address of 127.0.0.n for in-process pipe.
+func pipeAddr(n byte, port int) *xua.SCTPAddr {
+	return &xua.SCTPAddr{IP: []net.IP{net.IPv4(127, 0, 0, n)}, Port: port}
+}
+
+// pipePair returns SGP of proto on in-process pipe, and sets EndPoint
+// to ASP of the SGP after the ASP is activated.
+// SGP has point code 1 and ASP has point code 2.
+// setup is called before the ASP is connected.
+// EndPoint and PeerPointCode are restored when the test is finished.
+func pipePair(t *testing.T, port int, proto xua.Protocol,
+	setup ...func(sgp *xua.SignalingEndpoint)) (sgp *xua.SignalingEndpoint) {
+	sgp, _ = xua.NewPipeSignalingEndpoint(pipeAddr(1, port))
+	sgp.Protocol = proto
+	sgp.PointCode = 1
+	sgp.SCCPAddr = xua.SCCPAddr{PointCode: 1, SubsystemNumber: 6}
+	for _, f := range setup {
+		f(sgp)
+	}
+	if e := sgp.Listen(); e != nil {
+		t.Fatal(e)
+	}
+
+	pc := PeerPointCode
+	PeerPointCode = 1
+	EndPoint, _ = xua.NewPipeSignalingEndpoint(pipeAddr(2, port))
+	EndPoint.Protocol = proto
+	EndPoint.PointCode = 2
+	EndPoint.SCCPAddr = xua.SCCPAddr{PointCode: 2, SubsystemNumber: 7}
+	EndPoint.PayloadHandler = HandlePayload
+	t.Cleanup(func() {
+		EndPoint.Close()
+		sgp.Close()
+		EndPoint = nil
+		PeerPointCode = pc
+	})
+
+	if e := EndPoint.ConnectTo(pipeAddr(1, port)); e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; EndPoint.ASState(0) != xua.Active; i++ {
+		if i == 50 {
+			t.Fatal("ASP is not activated")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return
+}
@@ -25,7 +25,7 @@ var NewInvoke = func(*Transaction, []gsmap.Component) ([]gsmap.Component, gsmap.
 }
 
 var EndPoint *xua.SignalingEndpoint
-var PeerPointCode uint32
+var PeerPointCode xua.PointCode
 
 //var SelectASP = func() *xua.ASP {
 //	return nil
@@ -60,6 +60,9 @@ func HandlePayload(cgpa xua.SCCPAddr, cdpa xua.SCCPAddr, data []byte) {
 		}
 		if e != nil {
 			sendAbort(cgpa, msg.otid, TcBadlyFormattedTransactionPortion)
+		} else if draining.Load() {
+			rejected.Add(1)
+			sendAbort(cgpa, msg.otid, TcResourceLimitation)
 		} else {
 			go acceptTC(msg, cgpa)
 		}
@@ -138,6 +141,66 @@ func HandlePayload(cgpa xua.SCCPAddr, cdpa xua.SCCPAddr, data []byte) {
 	}
 }
 
+/*
+HandleNotice handles data returned by SCCP with UDTS, XUDTS, LUDTS or CLDR.
+The returned data is TCAP message sent from this node,
+so the transaction is identified by OTID and aborted with TC-NOTICE.
+*/
+func HandleNotice(cause xua.Cause, cgpa xua.SCCPAddr, cdpa xua.SCCPAddr, data []byte) {
+	t, v, e := gsmap.ReadTLV(bytes.NewBuffer(data), 0x00)
+	if e != nil {
+		if RxFailureNotify != nil {
+			RxFailureNotify(fmt.Errorf("invalid returned data: %v", e), data)
+		}
+		return
+	}
+
+	var msg Message
+	var otid uint32
+	switch t {
+	case 0x62: // Begin
+		var m *TcBegin
+		if m, e = unmarshalTcBegin(v); e == nil {
+			msg, otid = m, m.otid
+		}
+	case 0x65: // Continue
+		var m *TcContinue
+		if m, e = unmarshalTcContinue(v); e == nil {
+			msg, otid = m, m.otid
+		}
+	case 0x64: // End
+		msg, e = unmarshalTcEnd(v)
+	case 0x67: // Abort
+		msg, e = unmarshalTcAbort(v)
+	default:
+		e = fmt.Errorf("unknown message")
+	}
+	if e != nil {
+		if RxFailureNotify != nil {
+			RxFailureNotify(fmt.Errorf("invalid returned data: %v", e), data)
+		}
+		return
+	}
+
+	var tr *Transaction
+	if otid != 0 {
+		tr = GetTransaction(otid)
+	}
+	e = fmt.Errorf("returned by SCCP with %s", cause)
+	if TraceMessage != nil {
+		TraceMessage(msg, Rx, e)
+	}
+	if tr == nil {
+		return
+	}
+
+	select {
+	case tr.rxStack <- &TcAbort{dtid: tr.otid, pCause: TcNotice, rCause: cause}:
+	default:
+	}
+	tr.deregister()
+}
+
 func sendAbort(cdpa xua.SCCPAddr, tid uint32, cause Cause) {
 	msg := &TcAbort{
 		dtid:   tid,
@@ -149,18 +212,17 @@ func sendAbort(cdpa xua.SCCPAddr, tid uint32, cause Cause) {
 		}
 		return
 	}
-	send(cdpa, msg)
+	send(cdpa, msg, tid)
 }
 
-func send(cdpa xua.SCCPAddr, msg Message) (e error) {
+func send(cdpa xua.SCCPAddr, msg Message, sls uint32) (e error) {
 	if EndPoint == nil {
 		e = fmt.Errorf("failed to select destination")
+	} else {
+		e = EndPoint.WriteSLS(sls, PeerPointCode, cdpa, msg.marshalTc())
 	}
 	if TraceMessage != nil {
 		TraceMessage(msg, Tx, e)
 	}
-	if EndPoint != nil {
-		EndPoint.Write(PeerPointCode, cdpa, msg.marshalTc())
-	}
 	return
 }
@@ -30,8 +30,24 @@ func (t *Transaction) GetContext() gsmap.AppContext {
 	return t.ctx
 }
 
+// sls returns key of SLS for the transaction.
+// Local transaction ID is used so that all messages of the transaction
+// are sent with same SLS.
+func (t *Transaction) sls() uint32 {
+	if t.otid != 0 {
+		return t.otid
+	}
+	return t.dtid
+}
+
 func (t *Transaction) send(m Message) Message {
-	if send(t.CdPA, m) != nil {
+	if e := send(t.CdPA, m, t.sls()); e != nil {
+		// data is not sent, as same as returned by SCCP
+		t.deregister()
+		var we *xua.WriteError
+		if errors.As(e, &we) {
+			return &TcAbort{dtid: t.otid, pCause: TcNotice, rCause: we.Cause}
+		}
 		return &TcAbort{dtid: t.otid, pCause: TcNoDestination}
 	}
 
@@ -88,7 +104,7 @@ func GetTransaction(id uint32) (t *Transaction) {
 }
 
 func (t *Transaction) End(c ...gsmap.Component) {
-	send(t.CdPA, &TcEnd{dtid: t.dtid, component: c})
+	send(t.CdPA, &TcEnd{dtid: t.dtid, component: c}, t.sls())
 	t.deregister()
 }
 
@@ -110,7 +126,7 @@ func (t *Transaction) Continue(c ...gsmap.Component) ([]gsmap.Component, error)
 }
 
 func (t *Transaction) Reject() {
-	send(t.CdPA, &TcAbort{dtid: t.dtid, uCause: &ABRT{Source: SvcUser}})
+	send(t.CdPA, &TcAbort{dtid: t.dtid, uCause: &ABRT{Source: SvcUser}}, t.sls())
 	t.deregister()
 }
 
@@ -171,13 +187,13 @@ func acceptTC(msg *TcBegin, cgpa xua.SCCPAddr) {
 	} else if dlg, ok := msg.dialogue.(*AARQ); ok {
 		dres = DialogueHandler(*dlg)
 		if re, ok := dres.(*ABRT); ok {
-			send(cgpa, &TcAbort{dtid: t.dtid, uCause: re})
+			send(cgpa, &TcAbort{dtid: t.dtid, uCause: re}, t.sls())
 			return
 		} else if re, ok := dres.(*AARE); !ok {
-			send(cgpa, &TcAbort{dtid: t.dtid, pCause: TcUnrecognizedMessageType})
+			send(cgpa, &TcAbort{dtid: t.dtid, pCause: TcUnrecognizedMessageType}, t.sls())
 			return
 		} else if re.Result != Accept {
-			send(cgpa, &TcEnd{dtid: t.dtid, dialogue: dres})
+			send(cgpa, &TcEnd{dtid: t.dtid, dialogue: dres}, t.sls())
 			return
 		} else {
 			t.ctx = re.Context
@@ -196,7 +212,7 @@ func acceptTC(msg *TcBegin, cgpa xua.SCCPAddr) {
 			uCause: &AARE{
 				Context:   newctx,
 				Result:    RejectPermanent,
-				ResultSrc: SrcUsrACNameNotSupported}})
+				ResultSrc: SrcUsrACNameNotSupported}}, t.sls())
 		// }
 		t.deregister()
 	} else if cres == nil {
@@ -209,13 +225,13 @@ func acceptTC(msg *TcBegin, cgpa xua.SCCPAddr) {
 		send(cgpa, &TcEnd{
 			dtid:      t.dtid,
 			dialogue:  dres,
-			component: cres})
+			component: cres}, t.sls())
 		t.deregister()
 	} else if send(cgpa, &TcContinue{
 		otid:      t.otid,
 		dtid:      t.dtid,
 		dialogue:  dres,
-		component: cres}) != nil {
+		component: cres}, t.sls()) != nil {
 		t.deregister()
 	} else {
 		timer := time.AfterFunc(Tw, func() {
@@ -0,0 +1,557 @@
+package xua
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+/*
+AS is definition of Application Server that is served by SignalingEndpoint.
+ASP activates each AS with ASPAC for the Context.
+Received data is dispatched to the AS by routing context,
+or by SubsystemNumbers and GlobalTitles of called party address
+if routing context is not included.
+Handler of the AS is used instead of PayloadHandler of SignalingEndpoint
+if specified.
+
+Mode is traffic mode of the AS. In Override mode, only one ASP is activated
+and other ASPs are standby. Standby ASP is activated when active ASP is lost.
+In Loadshare mode, data is shared with all active ASPs.
+In Broadcast mode, data is sent to all active ASPs. NetAppearance and PointCode of SignalingEndpoint is used
+for sending if NetAppearance or PointCode of the AS is not specified.
+
+If Dynamic is true, routing key of the AS is registered with REG REQ
+before ASPAC, and deregistered with DEREG REQ when the endpoint is closed.
+Routing key is composed of PointCode and SI of SCCP for M3UA,
+or SubsystemNumbers and GlobalTitles for SUA.
+Context is requested as routing context and replaced with
+routing context that is assigned by SGP.
+In SGP, AS is registered dynamically with REG REQ from ASP.
+
+State of AS in SGP is as following.
+
+	             +----------+  one ASP trans ACTIVE   +-------------+
+	             |          |------------------------>|             |
+	             | AS-INACT |                         |  AS-ACTIVE  |
+	             |          |                         |             |
+	             |          |<---                     |             |
+	             +----------+    \                    +-------------+
+	                ^   |         \ Tr Expiry,            ^    |
+	                |   |          \ at least one         |    |
+	                |   |           \ ASP in ASP-INACTIVE |    |
+	                |   |            \                    |    |
+	                |   |             \                   |    |
+	                |   |              \                  |    |
+	one ASP trans   |   | all ASP       \      one ASP    |    | Last ACTIVE
+	to INACTIVE     |   | trans to       \     trans to   |    | ASP trans to
+	                |   | ASP-DOWN        -------\        |    | INACTIVE or
+	                |   |                         \       |    | DOWN
+	                |   |                          \      |    |
+	                |   |                           \     |    |
+	                |   v                            \    |    v
+	             +----------+                         +-------------+
+	             |          |                         |             |
+	             | AS-DOWN  |                         | AS-PENDING  |
+	             |          |                         |  (queueing) |
+	             |          |<------------------------|             |
+	             +----------+     Tr Expiry and no    +-------------+
+	                              ASP in ASP-INACTIVE state
+*/
+type AS struct {
+	Context          uint32
+	Mode             uint32
+	NetAppearance    *uint32
+	PointCode        PointCode
+	SubsystemNumbers []teldata.SubsystemNumber
+	// GlobalTitles is prefix of GT digits that is served by the AS.
+	GlobalTitles []string
+	Handler      func(SCCPAddr, SCCPAddr, []byte)
+	Dynamic      bool
+
+	state   Status
+	active  []*ASP
+	standby []*ASP
+	// draining is ASPs that are moved to inactive by Drain.
+	draining []*ASP
+
+	// recovery is T(r) timer that is running in pending state.
+	recovery *time.Timer
+	// ready is closed when pending state is finished.
+	ready chan any
+	// wake is closed when ASP becomes active for waiting Write.
+	wake chan any
+
+	// localID is Local-RK-Identifier of the routing key.
+	localID uint32
+	// registered is true if routing key is registered with RKM.
+	registered bool
+}
+
+// AddAS registers AS definition to the endpoint.
+// AS must be registered before ConnectTo or Listen.
+func (se *SignalingEndpoint) AddAS(as *AS) error {
+	if as == nil {
+		return fmt.Errorf("nil AS")
+	}
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	if _, ok := servers[as.Context]; ok {
+		return fmt.Errorf("routing context %d is already registered", as.Context)
+	}
+	as.state = Down
+	as.active = nil
+	as.standby = nil
+	as.draining = nil
+	as.localID = uint32(len(servers)) + 1
+	servers[as.Context] = as
+	return nil
+}
+
+// ASState returns state of AS with routing context ctx.
+func (se *SignalingEndpoint) ASState(ctx uint32) Status {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	if as, ok := servers[ctx]; ok {
+		return as.state
+	}
+	return 0
+}
+
+// defaultAS registers AS with Context of the endpoint
+// if no AS is registered.
+func (se *SignalingEndpoint) defaultAS() {
+	servers := <-se.servers
+	if len(servers) == 0 {
+		servers[se.Context] = &AS{
+			Context:       se.Context,
+			Mode:          Loadshare,
+			NetAppearance: se.NetAppearance,
+			PointCode:     se.PointCode,
+			state:         Down}
+		if se.SubsystemNumber != 0 {
+			servers[se.Context].SubsystemNumbers = []teldata.SubsystemNumber{
+				se.SubsystemNumber}
+		}
+	}
+	se.servers <- servers
+}
+
+// listAS returns all registered AS.
+func (se *SignalingEndpoint) listAS() []*AS {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	list := make([]*AS, 0, len(servers))
+	for _, as := range servers {
+		list = append(list, as)
+	}
+	return list
+}
+
+// serves returns true if cdpa is served by the AS.
+func (as *AS) serves(cdpa SCCPAddr) bool {
+	if len(as.SubsystemNumbers) == 0 && len(as.GlobalTitles) == 0 {
+		return true
+	}
+	for _, ssn := range as.SubsystemNumbers {
+		if ssn == cdpa.SubsystemNumber {
+			return true
+		}
+	}
+	if !cdpa.GlobalTitle.IsEmpty() {
+		dig := cdpa.GlobalTitle.Digits.String()
+		for _, gt := range as.GlobalTitles {
+			if strings.HasPrefix(dig, gt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serverOf returns AS with routing context ctx.
+// The only AS is returned if ctx is 0 and only one AS is registered.
+func serverOf(servers map[uint32]*AS, ctx uint32) (*AS, bool) {
+	if as, ok := servers[ctx]; ok || ctx != 0 || len(servers) != 1 {
+		return as, ok
+	}
+	for _, as := range servers {
+		return as, true
+	}
+	return nil, false
+}
+
+// lookupAS returns AS of received data with routing context ctx
+// and called party address cdpa.
+func (se *SignalingEndpoint) lookupAS(ctx uint32, cdpa SCCPAddr) *AS {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	if as, ok := serverOf(servers, ctx); ok {
+		return as
+	}
+	for _, as := range servers {
+		if as.serves(cdpa) {
+			return as
+		}
+	}
+	return nil
+}
+
+// activate adds ASP to active ASP list of AS with routing context ctx.
+func (se *SignalingEndpoint) activate(c *ASP, ctx uint32) {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	as, ok := servers[ctx]
+	if !ok {
+		return
+	}
+	for _, a := range as.active {
+		if a == c {
+			return
+		}
+	}
+	as.active = append(as.active, c)
+	if !se.sgp {
+		if as.state == Pending {
+			close(as.ready)
+		}
+		as.state = Active
+	}
+	as.wakeup()
+}
+
+// wakeup wakes Write that is waiting for active ASP.
+func (as *AS) wakeup() {
+	if as.wake != nil {
+		close(as.wake)
+		as.wake = nil
+	}
+}
+
+// standby adds ASP to standby ASP list of AS if the AS is Override mode
+// and another ASP is already active.
+func (se *SignalingEndpoint) standby(c *ASP, ctx uint32) bool {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	as, ok := servers[ctx]
+	if !ok || as.Mode != Override || len(as.active) == 0 {
+		return false
+	}
+	as.standby = append(as.standby, c)
+	return true
+}
+
+// alternate moves ASP to standby when NTFY Alternate ASP Active is received.
+// ASP of all AS in Override mode is moved if ctx is 0.
+func (se *SignalingEndpoint) alternate(c *ASP, ctx uint32) {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	for _, as := range servers {
+		if ctx != 0 && as.Context != ctx {
+			continue
+		}
+		for i, a := range as.active {
+			if a == c {
+				as.active = append(as.active[:i], as.active[i+1:]...)
+				as.standby = append(as.standby, c)
+				break
+			}
+		}
+	}
+}
+
+// switchover activates standby ASP of AS in Override mode.
+// AS is pending while the switchover is running.
+func (se *SignalingEndpoint) switchover(as *AS) {
+	for {
+		servers := <-se.servers
+		if len(as.standby) == 0 || len(as.active) != 0 {
+			if as.state == Pending {
+				as.state = Inactive
+				close(as.ready)
+			}
+			se.servers <- servers
+			return
+		}
+		c := as.standby[0]
+		as.standby = as.standby[1:]
+		se.servers <- servers
+
+		r := make(chan error, 1)
+		if e := c.request(&ASPAC{mode: Override, ctx: as.Context, result: r}, r); e == nil {
+			se.activate(c, as.Context)
+			return
+		} else if SctpNotify != nil {
+			SctpNotify(c.id, fmt.Sprintf(
+				"failed to activate AS(context=%d): %v", as.Context, e))
+		}
+	}
+}
+
+// redirect sends data that is failed to send on ASP c
+// via another active ASP of the AS.
+func (se *SignalingEndpoint) redirect(c *ASP, ctx, sls uint32, m message) bool {
+	se.deactivate(c, nil)
+	as, asps := se.selectASP(ctx, sls)
+	if as == nil || as.Mode == Broadcast {
+		return false
+	}
+	for _, a := range asps {
+		if a == c {
+			return false
+		}
+		a.send(m)
+	}
+	return len(asps) != 0
+}
+
+// deactivate removes ASP from active ASP list of as.
+// ASP is removed from all AS if as is nil.
+// In SGP, AS moves to pending state and T(r) is started
+// if no active ASP remains.
+func (se *SignalingEndpoint) deactivate(c *ASP, as *AS) {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	for _, s := range servers {
+		if as != nil && as != s {
+			continue
+		}
+		for i, a := range s.active {
+			if a == c {
+				s.active = append(s.active[:i], s.active[i+1:]...)
+				break
+			}
+		}
+		for i, a := range s.standby {
+			if a == c {
+				s.standby = append(s.standby[:i], s.standby[i+1:]...)
+				break
+			}
+		}
+		for i, a := range s.draining {
+			if a == c {
+				s.draining = append(s.draining[:i], s.draining[i+1:]...)
+				break
+			}
+		}
+		if s.state != Active || len(s.active) != 0 {
+			continue
+		}
+
+		if !se.sgp && (s.Mode != Override || len(s.standby) == 0) {
+			s.state = Inactive
+			continue
+		}
+		if !se.sgp {
+			s.state = Pending
+			s.ready = make(chan any)
+			go se.switchover(s)
+			continue
+		}
+		s.state = Pending
+		s.ready = make(chan any)
+		s.recovery = time.AfterFunc(tr, func() { se.recover(s) })
+		se.notifyAS(s)
+	}
+}
+
+// inactivate sends ASPIA via ASP c for each AS in which c is active,
+// and removes c from standby ASPs.
+// If drain is true, c is kept as draining ASP of the AS.
+// It returns number of AS that is inactivated and the last error.
+func (se *SignalingEndpoint) inactivate(c *ASP, drain bool) (n int, err error) {
+	for _, as := range se.listAS() {
+		servers := <-se.servers
+		active := slices.Contains(as.active, c)
+		standby := slices.Contains(as.standby, c)
+		se.servers <- servers
+		if standby && !drain {
+			se.deactivate(c, as)
+		}
+		if !active {
+			continue
+		}
+
+		r := make(chan error, 1)
+		if e := c.request(&ASPIA{ctx: as.Context, result: r}, r); e != nil {
+			err = fmt.Errorf("failed to inactivate AS(context=%d): %v", as.Context, e)
+			if SctpNotify != nil {
+				SctpNotify(c.id, err.Error())
+			}
+			continue
+		}
+		se.deactivate(c, as)
+		n++
+		if !drain {
+			continue
+		}
+
+		servers = <-se.servers
+		as.draining = append(as.draining, c)
+		se.servers <- servers
+	}
+	if n != 0 {
+		c.send(transition(Inactive))
+	}
+	return
+}
+
+// routingKey returns routing key of as.
+func (se *SignalingEndpoint) routingKey(as *AS) routingKey {
+	k := routingKey{
+		id:   as.localID,
+		ctx:  as.Context,
+		mode: as.Mode,
+		na:   as.NetAppearance,
+		dpc:  as.PointCode}
+	if k.na == nil {
+		k.na = se.NetAppearance
+	}
+	if k.dpc == 0 {
+		k.dpc = se.PointCode
+	}
+	if se.Protocol == M3UA {
+		k.si = []uint8{0x03}
+		return k
+	}
+	for _, ssn := range as.SubsystemNumbers {
+		k.addr = append(k.addr, SCCPAddr{PointCode: k.dpc, SubsystemNumber: ssn})
+	}
+	for _, gt := range as.GlobalTitles {
+		if d, e := teldata.ParseTBCD(gt); e == nil {
+			a := SCCPAddr{}
+			a.GlobalTitle.Digits = d
+			k.addr = append(k.addr, a)
+		}
+	}
+	return k
+}
+
+// register registers routing key of as via ASP c
+// and replaces Context of as with assigned routing context.
+func (se *SignalingEndpoint) register(c *ASP, as *AS) error {
+	r := make(chan error, 1)
+	m := &REGREQ{
+		sua:    se.Protocol == SUA,
+		keys:   []routingKey{se.routingKey(as)},
+		result: r}
+	if e := c.request(m, r); e != nil {
+		return e
+	}
+	ctx := m.keys[0].ctx
+
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+	if ctx != as.Context {
+		if _, ok := servers[ctx]; ok {
+			return fmt.Errorf("assigned routing context %d is already used", ctx)
+		}
+		delete(servers, as.Context)
+		as.Context = ctx
+		servers[ctx] = as
+	}
+	as.registered = true
+	return nil
+}
+
+// deregister deactivates and deregisters registered AS via ASP c.
+func (se *SignalingEndpoint) deregister(c *ASP) {
+	var ctx []uint32
+	for _, as := range se.listAS() {
+		if !as.Dynamic || !as.registered {
+			continue
+		}
+		r := make(chan error, 1)
+		c.request(&ASPIA{ctx: as.Context, result: r}, r)
+		se.deactivate(c, as)
+		ctx = append(ctx, as.Context)
+	}
+	if len(ctx) == 0 {
+		return
+	}
+
+	r := make(chan error, 1)
+	if e := c.request(&DEREGREQ{sua: se.Protocol == SUA, ctx: ctx, result: r}, r); e != nil && SctpNotify != nil {
+		SctpNotify(c.id, fmt.Sprintf("failed to deregister: %v", e))
+	}
+}
+
+// selectASP selects active ASP of AS with routing context ctx.
+// ASP is selected by SLS in Loadshare mode, so the mapping of SLS and ASP
+// is changed only when the set of active ASP is changed.
+// All active ASPs are selected in Broadcast mode.
+// Data is waited while the AS is pending.
+func (se *SignalingEndpoint) selectASP(ctx, sls uint32) (*AS, []*ASP) {
+	for {
+		var c []*ASP
+		var wait chan any
+
+		servers := <-se.servers
+		as, ok := serverOf(servers, ctx)
+		if !ok {
+		} else if as.state == Pending {
+			wait = as.ready
+		} else if len(as.active) == 0 && len(as.draining) != 0 {
+			// data of open transactions is sent via draining ASP
+			c = append(c, as.draining[int(sls)%len(as.draining)])
+		} else if as.state != Active || len(as.active) == 0 {
+		} else if as.Mode == Broadcast {
+			c = append(c, as.active...)
+		} else {
+			c = append(c, as.active[int(sls)%len(as.active)])
+		}
+		se.servers <- servers
+
+		if wait == nil {
+			return as, c
+		}
+		<-wait
+	}
+}
+
+// waitASP selects active ASP as same as selectASP.
+// If no ASP is active, it waits for active ASP up to timeout.
+func (se *SignalingEndpoint) waitASP(ctx, sls uint32, timeout time.Duration) (*AS, []*ASP) {
+	var expire <-chan time.Time
+	for {
+		as, asps := se.selectASP(ctx, sls)
+		if len(asps) != 0 || as == nil || timeout <= 0 {
+			return as, asps
+		}
+
+		servers := <-se.servers
+		ready := as.state == Active && len(as.active) != 0
+		if as.wake == nil {
+			as.wake = make(chan any)
+		}
+		wake := as.wake
+		se.servers <- servers
+		if ready {
+			continue
+		}
+
+		if expire == nil {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			expire = t.C
+		}
+		select {
+		case <-wake:
+		case <-expire:
+			return as, nil
+		case <-se.block:
+			return as, nil
+		}
+	}
+}
@@ -7,18 +7,32 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 var (
-	// tr    = time.Second * 2 // Pending Recovery timer
-	tack = time.Second * 2 // Wait Response timer
-	// tbeat = time.Second * 30 // Heartbeat interval
+	tr     = time.Second * 2  // Pending Recovery timer
+	tack   = time.Second * 2  // Wait Response timer
+	treass = time.Second * 10 // Reassembly timer
 
+	// SLSMask is bit mask of SLS.
+	// 0x0f for ITU 4-bit SLS, 0x1f or 0xff for ANSI 5-bit or 8-bit SLS.
 	SLSMask uint32 = 0x0000000f
 )
 
+// streamOf returns SCTP stream ID for the SLS.
+// Stream 0 is used for management messages, and data is sent
+// on other outbound streams that are agreed with the peer.
+func (c *ASP) streamOf(sls uint32) uint16 {
+	n := uint32(c.conn.streams())
+	if n < 2 {
+		return 0
+	}
+	return uint16(sls%(n-1)) + 1
+}
+
 /*
 Message of xUA
 
@@ -73,8 +87,11 @@ func getRxMessage(c, t byte) rxMessage {
 			return new(DUNA)
 		case 0x02:
 			return new(DAVA)
+		case 0x03:
+			return new(RxDAUD)
 		case 0x04:
-			return new(SCON)
+			// congestion level is 1 if Congestion Indications is not included
+			return &SCON{congestion: 1}
 		case 0x05:
 			return new(DUPU)
 		case 0x06:
@@ -82,6 +99,10 @@ func getRxMessage(c, t byte) rxMessage {
 		}
 	case 0x03:
 		switch t {
+		case 0x01:
+			return new(RxASPUP)
+		case 0x02:
+			return new(RxASPDN)
 		case 0x03:
 			return new(RxBEAT)
 		case 0x04:
@@ -93,52 +114,85 @@ func getRxMessage(c, t byte) rxMessage {
 		}
 	case 0x04:
 		switch t {
+		case 0x01:
+			return new(RxASPAC)
+		case 0x02:
+			return new(RxASPIA)
 		case 0x03:
 			return new(ASPACAck)
 		case 0x04:
 			return new(ASPIAAck)
 		}
+	case 0x09:
+		switch t {
+		case 0x01:
+			return new(RxREGREQ)
+		case 0x02:
+			return new(REGRSP)
+		case 0x03:
+			return new(RxDEREGREQ)
+		case 0x04:
+			return new(DEREGRSP)
+		}
+	case 0x07:
+		switch t {
+		case 0x01:
+			return new(RxCLDT)
+		case 0x02:
+			return new(RxCLDR)
+		}
+	case 0x08:
+		if t >= coCORE && t <= coCOIT {
+			return &RxCO{typ: t}
+		}
 	}
 	return nil
 }
 
 type ASP struct {
+	// counters are placed first to be aligned for atomic access
+	TxTransfer uint64
+	RxTransfer uint64
+	TxResponse uint64
+	RxResponse uint64
+
 	id   byte
-	sock int
+	conn association
+	se   *SignalingEndpoint
+	sgp  bool
 
 	msgQ    chan message
+	done    chan any
+	txQueue *queueCounter
 	ctrlMsg txMessage
 
 	handler func(SCCPAddr, SCCPAddr, []byte)
 
-	state     Status
+	state     atomic.Uint32
 	statNotif chan Status
-	sequence  chan uint32
 
-	TxTransfer uint64
-	RxTransfer uint64
-	TxResponse uint64
-	RxResponse uint64
+	beatAck chan time.Duration
+	rtt     atomic.Int64
+
+	closed bool
+	cause  error
+}
+
+func (c *ASP) State() Status {
+	return Status(c.state.Load())
 }
 
-func (c ASP) State() Status {
-	return c.state
+// RTT returns round trip time of the last answered BEAT.
+func (c *ASP) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
 }
 
 func (c *ASP) LocalAddr() net.Addr {
-	ptr, n, e := sctpGetladdrs(c.sock)
-	if e != nil {
-		return nil
-	}
-	return resolveFromRawAddr(ptr, n)
+	return c.conn.localAddr()
 }
 
 func (c *ASP) RemoteAddr() net.Addr {
-	ptr, n, e := sctpGetpaddrs(c.sock)
-	if e != nil {
-		return nil
-	}
-	return resolveFromRawAddr(ptr, n)
+	return c.conn.remoteAddr()
 }
 
 /*
@@ -150,96 +204,263 @@ func NewASP(gt SCCPAddr) *ASP {
 }
 */
 
-func (c *ASP) connectAndServe(ctx uint32, sharedQ chan userData) {
-	c.msgQ = make(chan message, 1024)
+func (c *ASP) connectAndServe(se *SignalingEndpoint) {
+	c.se = se
+	c.msgQ = make(chan message, se.dispatchOptions().QueueDepth)
+	c.done = make(chan any)
+	c.txQueue = &queueCounter{}
 	c.ctrlMsg = nil
-	c.state = 0
+	c.state.Store(0)
 	c.statNotif = make(chan Status, 256)
-	c.sequence = make(chan uint32, 1)
-	c.sequence <- 0
 
-	go func() { // event procedure
-		for m, ok := <-c.msgQ; ok; m, ok = <-c.msgQ {
-			m.handleMessage(c)
-		}
-	}()
+	go c.serve() // event procedure
 
 	// connect procedure
-	c.msgQ <- &NTFY{status: Down}
+	c.send(&NTFY{status: Down, local: true})
 	<-c.statNotif
 
+	go c.serveRx() // rx data procedure
+
 	// ASP up
 	r := make(chan error, 1)
-	c.msgQ <- &ASPUP{result: r}
-
-	go func() { // rx data procedure
-		for {
-			data, e := sctpRecvmsg(c.sock)
-			if eno, ok := e.(*syscall.Errno); ok && eno.Temporary() {
-				continue
-			} else if e != nil {
-				break
-			} else if data[0] != 1 || len(data) < 8 {
-				if RxFailureNotify != nil {
-					RxFailureNotify(fmt.Errorf("invalid lengh of data"), data)
-				}
-				continue
+	if e := c.request(&ASPUP{result: r}, r); e != nil {
+		c.cause = e
+		return
+	}
+
+	// ASP active for each AS
+	if e := se.activateASP(c); e != nil {
+		c.cause = e
+		return
+	}
+
+	for {
+		switch <-c.statNotif {
+		// case Inactive:
+		case 0, Down:
+			return
+		}
+	}
+}
+
+// acceptAndServe serves the ASP that is accepted in SGP mode.
+func (c *ASP) acceptAndServe(se *SignalingEndpoint) {
+	c.se = se
+	c.sgp = true
+	c.msgQ = make(chan message, se.dispatchOptions().QueueDepth)
+	c.done = make(chan any)
+	c.txQueue = &queueCounter{}
+	c.ctrlMsg = nil
+	c.state.Store(uint32(Down))
+	c.statNotif = make(chan Status, 256)
+
+	go c.serveRx() // rx data procedure
+
+	c.serve() // event procedure
+}
+
+// serve handles queued messages until done of the ASP is closed.
+// Messages that are queued before closing are handled before return.
+func (c *ASP) serve() {
+	for {
+		select {
+		case m := <-c.msgQ:
+			m.handleMessage(c)
+		case <-c.done:
+			for len(c.msgQ) != 0 {
+				(<-c.msgQ).handleMessage(c)
 			}
+			return
+		}
+	}
+}
 
-			m := getRxMessage(data[2], data[3])
-			if m == nil {
-				if RxFailureNotify != nil {
-					RxFailureNotify(fmt.Errorf("unknown message: %x-%x", data[2], data[3]), data)
-				}
-				continue
+// send queues m to the ASP.
+// It returns false if the ASP is already closed.
+func (c *ASP) send(m message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.msgQ <- m:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// stateQuery asks state of the ASP to the serve goroutine,
+// so that the answer reflects messages that are queued before it.
+type stateQuery chan Status
+
+func (m stateQuery) handleMessage(c *ASP) { m <- c.State() }
+
+// isUp returns true if the ASP is in ASP-ACTIVE or ASP-INACTIVE.
+// The state is decided by the serve goroutine of the ASP.
+func (c *ASP) isUp() bool {
+	if c.State() == 0 {
+		// not served yet
+		return false
+	}
+	q := make(stateQuery, 1)
+	if !c.send(q) {
+		return false
+	}
+	select {
+	case s := <-q:
+		return s == Active || s == Inactive
+	case <-c.done:
+		return false
+	}
+}
+
+// request queues control request m to the ASP and waits result r.
+func (c *ASP) request(m message, r chan error) error {
+	if !c.send(m) {
+		return ErrASPClosed
+	}
+	select {
+	case e := <-r:
+		return e
+	case <-c.done:
+		return ErrASPClosed
+	}
+}
+
+func (c *ASP) serveRx() {
+	done := make(chan any)
+	c.beatAck = make(chan time.Duration, 1)
+	go c.heartbeat(done)
+
+	for {
+		data, _, e := c.conn.recv()
+		if eno, ok := e.(syscall.Errno); ok && eno.Temporary() {
+			continue
+		} else if e != nil {
+			if c.cause == nil {
+				c.cause = e
 			}
+			break
+		} else if len(data) < 8 || data[0] != 1 {
+			if RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf("invalid lengh of data"), data)
+			}
+			continue
+		}
+		size := binary.BigEndian.Uint32(data[4:8])
+		if size < 8 || size > uint32(len(data)) {
+			if RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf("invalid message length: %d", size), data)
+			}
+			continue
+		}
 
-			for r := bytes.NewReader(data[8 : uint32(data[4])<<24|uint32(data[5])<<16|uint32(data[6])<<8|uint32(data[7])]); r.Len() > 4; {
-				var t, l uint16
-				binary.Read(r, binary.BigEndian, &t)
-				binary.Read(r, binary.BigEndian, &l)
-				l -= 4
+		m := getRxMessage(data[2], data[3])
+		if m == nil {
+			if RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf("unknown message: %x-%x", data[2], data[3]), data)
+			}
+			continue
+		}
 
-				if e := m.unmarshal(t, l, r); e != nil {
-					if RxFailureNotify != nil {
-						RxFailureNotify(fmt.Errorf("invalid data for tag %x: %v", t, e), data)
-					}
-				}
-				if l%4 != 0 {
-					r.Seek(int64(4-l%4), io.SeekCurrent)
+		if msg, ok := m.(*RxDATA); ok {
+			msg.variant = c.se.Variant
+		}
+		setSSNMProtocol(m, c.se.Protocol == SUA)
+		for r := bytes.NewReader(data[8:size]); r.Len() > 4; {
+			var t, l uint16
+			binary.Read(r, binary.BigEndian, &t)
+			binary.Read(r, binary.BigEndian, &l)
+			l -= 4
+
+			if e := m.unmarshal(t, l, r); e != nil {
+				if RxFailureNotify != nil {
+					RxFailureNotify(fmt.Errorf("invalid data for tag %x: %v", t, e), data)
 				}
 			}
+			if l%4 != 0 {
+				r.Seek(int64(4-l%4), io.SeekCurrent)
+			}
+		}
 
-			if msg, ok := m.(*RxDATA); ok && msg.cause == Success && msg.protocolClass == 0 {
-				c.RxTransfer++
-				sharedQ <- msg.userData
+		if msg, ok := m.(*RxDATA); ok && (msg.cause != Success || msg.protocolClass < 2) {
+			if msg.cause != Success {
+				atomic.AddUint64(&c.RxResponse, 1)
 			} else {
-				c.msgQ <- m
+				atomic.AddUint64(&c.RxTransfer, 1)
 			}
+			msg.userData.opc = msg.opc
+			msg.userData.rc = msg.ctx
+			msg.userData.sls = uint32(msg.sls)
+			c.se.receive(msg.userData)
+		} else if msg, ok := m.(*RxCLDT); ok && msg.protocolClass < 2 {
+			atomic.AddUint64(&c.RxTransfer, 1)
+			msg.userData.rc = msg.ctx
+			msg.userData.sls = msg.sequenceCtrl
+			c.se.receive(msg.userData)
+		} else if msg, ok := m.(*RxCLDR); ok {
+			atomic.AddUint64(&c.RxResponse, 1)
+			msg.userData.rc = msg.ctx
+			c.se.receive(msg.userData)
+		} else if msg, ok := m.(*RxCO); ok {
+			// CO message may be answered via this ASP
+			msg.handleMessage(c)
+		} else {
+			c.msgQ <- m
 		}
+	}
 
-		c.msgQ <- &NTFY{status: Down}
-		c.ctrlMsg = nil
-		close(c.msgQ)
-	}()
+	close(done)
+	c.se.deactivate(c, nil)
+	c.msgQ <- &NTFY{status: Down, local: true}
+	close(c.done)
+}
 
-	if <-r != nil {
+// heartbeat sends BEAT in each HeartbeatInterval of the endpoint
+// until done is closed.
+// The association is aborted if BEAT Ack is not received
+// for HeartbeatMisses times in a row.
+func (c *ASP) heartbeat(done chan any) {
+	interval := c.se.HeartbeatInterval
+	if interval <= 0 {
 		return
 	}
-
-	// ASP active
-	r = make(chan error, 1)
-	c.msgQ <- &ASPAC{mode: Loadshare, ctx: ctx, result: r}
-	if <-r != nil {
-		return
+	limit := c.se.HeartbeatMisses
+	if limit <= 0 {
+		limit = defaultHeartbeatMisses
 	}
 
-	for {
-		switch <-c.statNotif {
-		// case Inactive:
-		case 0, Down:
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for miss := 0; ; {
+		select {
+		case <-done:
+			return
+		case rtt := <-c.beatAck:
+			miss = 0
+			c.rtt.Store(int64(rtt))
+			if HeartbeatNotify != nil {
+				HeartbeatNotify(c.id, rtt)
+			}
+			continue
+		case <-t.C:
+		}
+
+		if miss >= limit {
+			if SctpNotify != nil {
+				SctpNotify(c.id, fmt.Sprintf(
+					"no BEAT Ack for %d heartbeats, aborting", miss))
+			}
+			c.cause = fmt.Errorf("no BEAT Ack for %d heartbeats", miss)
+			c.conn.abort()
 			return
 		}
+		miss++
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+		c.write(&TxBEAT{data: data})
 	}
 }
 
@@ -249,6 +470,27 @@ func (c *ASP) handleCtrlReq(m txMessage) (e error) {
 		return
 	}
 
+	if e = c.write(m); e != nil {
+		return
+	}
+
+	c.ctrlMsg = m
+	time.AfterFunc(tack, func() { c.send(ctrlTimeout{m}) })
+	return
+}
+
+// ctrlTimeout is expiry of Wait Response timer of control request.
+// It is handled as ERR if the request is still waiting answer.
+type ctrlTimeout struct{ req txMessage }
+
+func (m ctrlTimeout) handleMessage(c *ASP) {
+	if c.ctrlMsg == m.req {
+		(&ERR{code: ProtocolError}).handleMessage(c)
+	}
+}
+
+// write sends management message on stream 0.
+func (c *ASP) write(m txMessage) error {
 	cls, typ, b := m.marshal()
 	buf := new(bytes.Buffer)
 
@@ -265,17 +507,19 @@ func (c *ASP) handleCtrlReq(m txMessage) (e error) {
 	// Message Data
 	buf.Write(b)
 
-	if _, e = sctpSend(c.sock, buf.Bytes(), 0); e != nil {
+	_, e := c.conn.send(buf.Bytes(), 0)
+	return e
+}
+
+// setState updates state of the ASP in SGP.
+func (c *ASP) setState(s Status) {
+	if c.State() == s {
 		return
 	}
-
-	c.ctrlMsg = m
-	time.AfterFunc(tack, func() {
-		if c.ctrlMsg == m {
-			c.msgQ <- &ERR{code: ProtocolError}
-		}
-	})
-	return
+	if StateNotify != nil {
+		StateNotify(c.id, s)
+	}
+	c.transit(s, 0, 0)
 }
 
 func (c *ASP) handleCtrlAns(m message) {
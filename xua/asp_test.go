@@ -0,0 +1,28 @@
+package xua
+
+import "testing"
+
+// streamsAssociation is association with n outbound streams.
+type streamsAssociation struct {
+	association
+	n uint16
+}
+
+func (c streamsAssociation) streams() uint16 { return c.n }
+
+func TestStreamOf(t *testing.T) {
+	for _, tc := range []struct {
+		n    uint16
+		sls  uint32
+		want uint16
+	}{
+		{17, 0, 1}, {17, 15, 16}, {17, 16, 1},
+		{4, 2, 3}, {4, 3, 1}, {4, 255, 1},
+		{2, 7, 1}, {1, 7, 0}, {0, 7, 0},
+	} {
+		c := &ASP{conn: streamsAssociation{n: tc.n}}
+		if s := c.streamOf(tc.sls); s != tc.want {
+			t.Errorf("%d streams, SLS %d: stream %d, want %d", tc.n, tc.sls, s, tc.want)
+		}
+	}
+}
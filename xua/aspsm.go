@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 )
 
 /*
@@ -33,6 +34,7 @@ type ASPUP struct {
 	// info   string
 	result chan error
 }
+type RxASPUP ASPUP
 
 func (m *ASPUP) handleMessage(c *ASP) {
 	if e := c.handleCtrlReq(m); e != nil {
@@ -68,6 +70,17 @@ func (m *ASPUP) marshal() (uint8, uint8, []byte) {
 
 func (m *ASPUP) unmarshal(t, l uint16, r io.ReadSeeker) (e error) { return }
 
+func (m *RxASPUP) handleMessage(c *ASP) { c.se.handleASPUP(c) }
+
+func (m *RxASPUP) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	// case 0x0011: // ASP Identifier (Optional)
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
 /*
 ASPDN is ASP Down message. (Message type = 0x02)
 
@@ -84,6 +97,7 @@ type ASPDN struct {
 	// info   string
 	result chan error
 }
+type RxASPDN ASPDN
 
 func (m *ASPDN) handleMessage(c *ASP) {
 	if e := c.handleCtrlReq(m); e != nil {
@@ -110,6 +124,16 @@ func (m *ASPDN) marshal() (uint8, uint8, []byte) {
 	return 0x03, 0x02, []byte{}
 }
 
+func (m *RxASPDN) handleMessage(c *ASP) { c.se.handleASPDN(c) }
+
+func (m *RxASPDN) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
 /*
 BEAT is Heartbeat message. (Message type = 0x03)
 
@@ -128,7 +152,7 @@ type BEAT struct {
 type TxBEAT BEAT
 type RxBEAT BEAT
 
-func (m *TxBEAT) handleMessage(*ASP)   {}
+func (m *TxBEAT) handleMessage(c *ASP) { c.write(m) }
 func (m *TxBEAT) handleResult(message) {}
 
 func (m *TxBEAT) marshal() (uint8, uint8, []byte) {
@@ -146,7 +170,7 @@ func (m *TxBEAT) marshal() (uint8, uint8, []byte) {
 	return 0x03, 0x03, buf.Bytes()
 }
 
-func (m *RxBEAT) handleMessage(*ASP) {}
+func (m *RxBEAT) handleMessage(c *ASP) { c.write(&TxBEATAck{data: m.data}) }
 
 func (m *RxBEAT) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
@@ -177,9 +201,17 @@ ASPUPAck is ASP Up Ack message. (Message type = 0x04)
 type ASPUPAck struct {
 	// info   string
 }
+type TxASPUPAck ASPUPAck
 
 func (m *ASPUPAck) handleMessage(c *ASP) { c.handleCtrlAns(m) }
 
+func (m *TxASPUPAck) handleMessage(c *ASP) { c.write(m) }
+func (m *TxASPUPAck) handleResult(message) {}
+
+func (m *TxASPUPAck) marshal() (uint8, uint8, []byte) {
+	return 0x03, 0x04, []byte{}
+}
+
 func (m *ASPUPAck) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
 	// case 0x0004:	// Info String (Optional)
@@ -205,9 +237,17 @@ ASPDNAck is ASP Down Ack message. (Message type = 0x05)
 type ASPDNAck struct {
 	// info   string
 }
+type TxASPDNAck ASPDNAck
 
 func (m *ASPDNAck) handleMessage(c *ASP) { c.handleCtrlAns(m) }
 
+func (m *TxASPDNAck) handleMessage(c *ASP) { c.write(m) }
+func (m *TxASPDNAck) handleResult(message) {}
+
+func (m *TxASPDNAck) marshal() (uint8, uint8, []byte) {
+	return 0x03, 0x05, []byte{}
+}
+
 func (m *ASPDNAck) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
 	// case 0x0004:	// Info String (Optional)
@@ -236,7 +276,7 @@ type BEATAck struct {
 type TxBEATAck BEATAck
 type RxBEATAck BEATAck
 
-func (m *TxBEATAck) handleMessage(*ASP)   {}
+func (m *TxBEATAck) handleMessage(c *ASP) { c.write(m) }
 func (m *TxBEATAck) handleResult(message) {}
 
 func (m *TxBEATAck) marshal() (uint8, uint8, []byte) {
@@ -254,7 +294,16 @@ func (m *TxBEATAck) marshal() (uint8, uint8, []byte) {
 	return 0x03, 0x06, buf.Bytes()
 }
 
-func (m *RxBEATAck) handleMessage(*ASP) {}
+func (m *RxBEATAck) handleMessage(c *ASP) {
+	if len(m.data) != 8 {
+		return
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(m.data)))
+	select {
+	case c.beatAck <- time.Since(sent):
+	default:
+	}
+}
 
 func (m *RxBEATAck) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
@@ -63,6 +63,7 @@ type ASPAC struct {
 
 	result chan error
 }
+type RxASPAC ASPAC
 
 func (m *ASPAC) handleMessage(c *ASP) {
 	if e := c.handleCtrlReq(m); e != nil {
@@ -121,6 +122,20 @@ func (m *ASPAC) marshal() (uint8, uint8, []byte) {
 	return 0x04, 0x01, buf.Bytes()
 }
 
+func (m *RxASPAC) handleMessage(c *ASP) { c.se.handleASPAC(c, m.mode, m.ctx) }
+
+func (m *RxASPAC) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x000B: // Traffic Mode Type (Optional)
+		m.mode, e = readUint32(r, l)
+	case 0x0006: // Routing Context (Optional)
+		m.ctx, e = readUint32(r, l)
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
 /*
 ASPIA is ASP Inactive message. (Message type = 0x02)
 
@@ -144,6 +159,7 @@ type ASPIA struct {
 
 	result chan error
 }
+type RxASPIA ASPIA
 
 func (m *ASPIA) handleMessage(c *ASP) {
 	if e := c.handleCtrlReq(m); e != nil {
@@ -175,6 +191,18 @@ func (m *ASPIA) marshal() (uint8, uint8, []byte) {
 	return 0x04, 0x02, buf.Bytes()
 }
 
+func (m *RxASPIA) handleMessage(c *ASP) { c.se.handleASPIA(c, m.ctx) }
+
+func (m *RxASPIA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0006: // Routing Context (Optional)
+		m.ctx, e = readUint32(r, l)
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
 /*
 ASPACAck is ASP Active Ack message. (Message type = 0x03)
 
@@ -201,9 +229,25 @@ type ASPACAck struct {
 	ctx  uint32
 	// info    string
 }
+type TxASPACAck ASPACAck
 
 func (m *ASPACAck) handleMessage(c *ASP) { c.handleCtrlAns(m) }
 
+func (m *TxASPACAck) handleMessage(c *ASP) { c.write(m) }
+func (m *TxASPACAck) handleResult(message) {}
+
+func (m *TxASPACAck) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.mode != 0 {
+		writeUint32(buf, 0x000b, m.mode)
+	}
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+	return 0x04, 0x03, buf.Bytes()
+}
+
 func (m *ASPACAck) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
 	case 0x000B: // Traffic Mode Type (Optional)
@@ -239,9 +283,22 @@ type ASPIAAck struct {
 	ctx uint32
 	// info    string
 }
+type TxASPIAAck ASPIAAck
 
 func (m *ASPIAAck) handleMessage(c *ASP) { c.handleCtrlAns(m) }
 
+func (m *TxASPIAAck) handleMessage(c *ASP) { c.write(m) }
+func (m *TxASPIAAck) handleResult(message) {}
+
+func (m *TxASPIAAck) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+	return 0x04, 0x04, buf.Bytes()
+}
+
 func (m *ASPIAAck) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
 	case 0x0006: // Routing Context (Optional)
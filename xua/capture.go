@@ -0,0 +1,334 @@
+package xua
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Capture is parameters of pcapng capture by StartCapture.
+Each sent and received xUA message is written as SCTP DATA chunk
+in synthetic IPv4 or IPv6 packet (LINKTYPE_RAW), with addresses,
+ports and stream ID of the association and PPID of the endpoint.
+*/
+type Capture struct {
+	// Path is file name of the capture.
+	// Opened time is added before extension if rotation is enabled.
+	Path string
+	// MaxSize rotates the file when its size exceeds MaxSize bytes.
+	// Rotation by size is disabled if 0.
+	MaxSize int64
+	// Interval rotates the file in each Interval.
+	// Rotation by time is disabled if 0.
+	Interval time.Duration
+}
+
+type captureFile struct {
+	Capture
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+var capture = make(chan *captureFile, 1)
+
+func init() {
+	capture <- nil
+}
+
+/*
+StartCapture starts writing every sent and received xUA message
+to pcapng file. Running capture is replaced by new one.
+Capture is stopped if writing to the file is failed.
+*/
+func StartCapture(c Capture) error {
+	f := &captureFile{Capture: c}
+	if e := f.open(time.Now()); e != nil {
+		return e
+	}
+	old := <-capture
+	capture <- f
+	if old != nil {
+		old.file.Close()
+	}
+	return nil
+}
+
+// StopCapture stops running capture and closes the file.
+func StopCapture() error {
+	f := <-capture
+	capture <- nil
+	if f == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// Capturing returns true while capture is running.
+func Capturing() bool {
+	f := <-capture
+	capture <- f
+	return f != nil
+}
+
+func (f *captureFile) name(t time.Time) string {
+	if f.MaxSize <= 0 && f.Interval <= 0 {
+		return f.Path
+	}
+	ext := filepath.Ext(f.Path)
+	return strings.TrimSuffix(f.Path, ext) + t.Format("-20060102-150405.000") + ext
+}
+
+// open creates new file with Section Header Block
+// and Interface Description Block.
+func (f *captureFile) open(t time.Time) (e error) {
+	name := f.name(t)
+	if f.file, e = os.Create(name); e != nil {
+		if CaptureNotify != nil {
+			CaptureNotify(name, e)
+		}
+		return
+	}
+	f.opened = t
+	f.size = 0
+
+	b := make([]byte, 0, 48)
+	// Section Header Block
+	b = binary.LittleEndian.AppendUint32(b, 0x0A0D0D0A)
+	b = binary.LittleEndian.AppendUint32(b, 28)
+	b = binary.LittleEndian.AppendUint32(b, 0x1A2B3C4D) // Byte-Order Magic
+	b = binary.LittleEndian.AppendUint16(b, 1)          // Major Version
+	b = binary.LittleEndian.AppendUint16(b, 0)          // Minor Version
+	b = binary.LittleEndian.AppendUint64(b, 0xFFFFFFFFFFFFFFFF)
+	b = binary.LittleEndian.AppendUint32(b, 28)
+	// Interface Description Block
+	b = binary.LittleEndian.AppendUint32(b, 0x00000001)
+	b = binary.LittleEndian.AppendUint32(b, 20)
+	b = binary.LittleEndian.AppendUint16(b, 101) // LINKTYPE_RAW
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0) // SnapLen
+	b = binary.LittleEndian.AppendUint32(b, 20)
+
+	e = f.write(b)
+	if CaptureNotify != nil {
+		CaptureNotify(name, e)
+	}
+	return
+}
+
+func (f *captureFile) write(b []byte) error {
+	n, e := f.file.Write(b)
+	f.size += int64(n)
+	return e
+}
+
+// writePacket writes pkt in Enhanced Packet Block
+// after rotation of the file if required.
+func (f *captureFile) writePacket(t time.Time, pkt []byte) error {
+	if (f.MaxSize > 0 && f.size >= f.MaxSize) ||
+		(f.Interval > 0 && t.Sub(f.opened) >= f.Interval) {
+		f.file.Close()
+		if e := f.open(t); e != nil {
+			return e
+		}
+	}
+
+	pad := (4 - len(pkt)%4) % 4
+	l := uint32(32 + len(pkt) + pad)
+	ts := uint64(t.UnixMicro())
+
+	b := make([]byte, 0, l)
+	b = binary.LittleEndian.AppendUint32(b, 0x00000006)
+	b = binary.LittleEndian.AppendUint32(b, l)
+	b = binary.LittleEndian.AppendUint32(b, 0) // Interface ID
+	b = binary.LittleEndian.AppendUint32(b, uint32(ts>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(ts))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(pkt)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(pkt)))
+	b = append(b, pkt...)
+	b = append(b, make([]byte, pad)...)
+	b = binary.LittleEndian.AppendUint32(b, l)
+	return f.write(b)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+/*
+capturedAssociation is association that writes sent and received messages
+to running capture.
+*/
+type capturedAssociation struct {
+	association
+	ppid uint32
+
+	once         sync.Once
+	local, peer  net.IP
+	lport, pport uint16
+	txTSN, rxTSN uint32
+}
+
+func newCapturedAssociation(a association, ppid uint32) *capturedAssociation {
+	return &capturedAssociation{association: a, ppid: ppid}
+}
+
+func (c *capturedAssociation) send(b []byte, sid uint16) (int, error) {
+	n, e := c.association.send(b, sid)
+	if e == nil {
+		c.capture(b, sid, false)
+	}
+	return n, e
+}
+
+func (c *capturedAssociation) recv() ([]byte, uint16, error) {
+	b, sid, e := c.association.recv()
+	if e == nil {
+		c.capture(b, sid, true)
+	}
+	return b, sid, e
+}
+
+func (c *capturedAssociation) capture(b []byte, sid uint16, rx bool) {
+	f := <-capture
+	defer func() { capture <- f }()
+	if f == nil {
+		return
+	}
+
+	c.once.Do(c.resolve)
+	var tsn uint32
+	if rx {
+		c.rxTSN++
+		tsn = c.rxTSN
+	} else {
+		c.txTSN++
+		tsn = c.txTSN
+	}
+
+	if e := f.writePacket(time.Now(), c.packet(b, sid, tsn, rx)); e != nil {
+		f.file.Close()
+		f = nil
+		if CaptureNotify != nil {
+			CaptureNotify("", e)
+		}
+	}
+}
+
+// resolve decides IP addresses and ports of the packet.
+// IPv4 address is mapped to IPv6 if the other is IPv6.
+func (c *capturedAssociation) resolve() {
+	ipPort := func(a net.Addr) (net.IP, uint16) {
+		switch a := a.(type) {
+		case *SCTPAddr:
+			if a != nil && len(a.IP) != 0 {
+				return a.IP[0], uint16(a.Port)
+			} else if a != nil {
+				return nil, uint16(a.Port)
+			}
+		case *net.TCPAddr:
+			return a.IP, uint16(a.Port)
+		}
+		return nil, 0
+	}
+	c.local, c.lport = ipPort(c.localAddr())
+	c.peer, c.pport = ipPort(c.remoteAddr())
+
+	if c.local == nil {
+		c.local = net.IPv4zero
+	}
+	if c.peer == nil {
+		c.peer = net.IPv4zero
+	}
+	if c.local.To4() != nil && c.peer.To4() != nil {
+		c.local, c.peer = c.local.To4(), c.peer.To4()
+	} else {
+		c.local, c.peer = c.local.To16(), c.peer.To16()
+	}
+}
+
+/*
+packet returns IP packet of xUA message b in SCTP DATA chunk.
+
+SCTP common header and DATA chunk
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Source Port Number        |     Destination Port Number   |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                      Verification Tag                         |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                           Checksum                            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|   Type = 0    | Reserved|U|B|E|    Length                     |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                              TSN                              |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|      Stream Identifier S      |   Stream Sequence Number n    |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                  Payload Protocol Identifier                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	\                                                               \
+	/                 User Data (seq n of Stream S)                 /
+	\                                                               \
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+func (c *capturedAssociation) packet(b []byte, sid uint16, tsn uint32, rx bool) []byte {
+	src, dst := c.local, c.peer
+	sport, dport := c.lport, c.pport
+	if rx {
+		src, dst = dst, src
+		sport, dport = dport, sport
+	}
+
+	pad := (4 - len(b)%4) % 4
+	sctp := make([]byte, 0, 28+len(b)+pad)
+	sctp = binary.BigEndian.AppendUint16(sctp, sport)
+	sctp = binary.BigEndian.AppendUint16(sctp, dport)
+	sctp = binary.BigEndian.AppendUint32(sctp, 0) // Verification Tag
+	sctp = binary.BigEndian.AppendUint32(sctp, 0) // Checksum
+	sctp = append(sctp, 0x00, 0x03)               // DATA with B and E flag
+	sctp = binary.BigEndian.AppendUint16(sctp, uint16(16+len(b)))
+	sctp = binary.BigEndian.AppendUint32(sctp, tsn)
+	sctp = binary.BigEndian.AppendUint16(sctp, sid)
+	sctp = binary.BigEndian.AppendUint16(sctp, 0) // Stream Sequence Number
+	sctp = binary.BigEndian.AppendUint32(sctp, c.ppid)
+	sctp = append(sctp, b...)
+	sctp = append(sctp, make([]byte, pad)...)
+	binary.LittleEndian.PutUint32(sctp[8:12], crc32.Checksum(sctp, castagnoli))
+
+	var ip []byte
+	if len(src) == net.IPv4len {
+		ip = make([]byte, 20, 20+len(sctp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(sctp)))
+		ip[6] = 0x40 // Don't Fragment
+		ip[8] = 64   // TTL
+		ip[9] = 132  // SCTP
+		copy(ip[12:16], src)
+		copy(ip[16:20], dst)
+
+		var sum uint32
+		for i := 0; i < 20; i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(ip[i : i+2]))
+		}
+		for sum > 0xffff {
+			sum = sum&0xffff + sum>>16
+		}
+		binary.BigEndian.PutUint16(ip[10:12], ^uint16(sum))
+	} else {
+		ip = make([]byte, 40, 40+len(sctp))
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:6], uint16(len(sctp)))
+		ip[6] = 132 // SCTP
+		ip[7] = 64  // Hop Limit
+		copy(ip[8:24], src)
+		copy(ip[24:40], dst)
+	}
+	return append(ip, sctp...)
+}
@@ -0,0 +1,66 @@
+package xua
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sua.pcapng")
+	if e := StartCapture(Capture{Path: path}); e != nil {
+		t.Fatal(e)
+	}
+	sgp, asp := pipePair(t, 2912, SUA)
+	asp.Close()
+	sgp.Close()
+	if e := StopCapture(); e != nil {
+		t.Fatal(e)
+	}
+
+	b, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(b) < 48 ||
+		binary.LittleEndian.Uint32(b[0:4]) != 0x0A0D0D0A ||
+		binary.LittleEndian.Uint32(b[8:12]) != 0x1A2B3C4D ||
+		binary.LittleEndian.Uint32(b[28:32]) != 0x00000001 ||
+		binary.LittleEndian.Uint16(b[36:38]) != 101 {
+		t.Fatalf("invalid header blocks %x", b)
+	}
+
+	n := 0
+	for b = b[48:]; len(b) != 0; n++ {
+		l := binary.LittleEndian.Uint32(b[4:8])
+		if binary.LittleEndian.Uint32(b[0:4]) != 0x00000006 ||
+			binary.LittleEndian.Uint32(b[l-4:l]) != l {
+			t.Fatalf("invalid packet block %x", b[:l])
+		}
+		pkt := b[28 : 28+binary.LittleEndian.Uint32(b[20:24])]
+		b = b[l:]
+
+		if pkt[0] != 0x45 || pkt[9] != 132 {
+			t.Fatalf("invalid IP header %x", pkt[:20])
+		}
+		sctp := append([]byte{}, pkt[20:]...)
+		sum := binary.LittleEndian.Uint32(sctp[8:12])
+		binary.LittleEndian.PutUint32(sctp[8:12], 0)
+		if crc32.Checksum(sctp, castagnoli) != sum {
+			t.Fatalf("invalid checksum %x", pkt)
+		}
+		if binary.BigEndian.Uint32(sctp[24:28]) != 4 {
+			t.Fatalf("invalid PPID %x", sctp[24:28])
+		}
+		msg := sctp[28:]
+		if msg[0] != 1 || binary.BigEndian.Uint32(msg[4:8]) !=
+			uint32(binary.BigEndian.Uint16(sctp[14:16]))-16 {
+			t.Fatalf("invalid SUA message %x", msg)
+		}
+	}
+	if n == 0 {
+		t.Fatal("no packet is captured")
+	}
+}
@@ -1,5 +1,13 @@
 package xua
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
 /*
 CL: SCCP Connectionless (CL) Messages
 Message class = 0x07
@@ -59,42 +67,22 @@ CLDT is Connectionless Data Transfer message. (Message type = 0x01)
 	/                           * Data                              /
 	\                                                               \
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
 type CLDT struct {
-	ctx           uint32
-	returnOnError bool
-	protocolClass uint8
-	//cgpa          SCCPAddr
-	//cdpa          SCCPAddr
+	ctx          uint32
 	sequenceCtrl uint32
 
-	// hopCount   uint8
-	// importance *uint8
 	// priority   *uint8
 	// correlation *uint32
 
-	// first      bool
-	// remain     uint8
-	// segmentRef *uint32
-
-	//data []byte
 	userData
 }
 
-func (m CLDT) CgPA() SCCPAddr {
-	return m.cgpa
-}
-func (m CLDT) CdPA() SCCPAddr {
-	return m.cdpa
-}
-func (m CLDT) Data() []byte {
-	return m.data
-}
-
 type TxCLDT CLDT
 type RxCLDT CLDT
 
 func (m *TxCLDT) handleMessage(c *ASP) {
-	c.TxTransfer++
+	atomic.AddUint64(&c.TxTransfer, 1)
 
 	cls, typ, b := m.marshal()
 	buf := new(bytes.Buffer)
@@ -112,7 +100,10 @@ func (m *TxCLDT) handleMessage(c *ASP) {
 	// Message Data
 	buf.Write(b)
 
-	i, e := sctpSend(c.sock, buf.Bytes(), uint16(m.sequenceCtrl&SLSMask)+1, false)
+	i, e := c.conn.send(buf.Bytes(), c.streamOf(m.sequenceCtrl))
+	if e != nil && c.se.redirect(c, m.ctx, m.sequenceCtrl, m) {
+		return
+	}
 	if TxFailureNotify != nil {
 		if e != nil {
 			TxFailureNotify(e, buf.Bytes())
@@ -138,29 +129,23 @@ func (m *TxCLDT) marshal() (uint8, uint8, []byte) {
 	}
 
 	// Source Address
-	d := m.cgpa.marshalSUA()
-	binary.Write(buf, binary.BigEndian, uint16(0x0102))
-	binary.Write(buf, binary.BigEndian, uint16(4+len(d)))
-	buf.Write(d)
+	writeSUAAddr(buf, 0x0102, m.cgpa)
 
 	// Destination Address
-	d = m.cdpa.marshalSUA()
-	binary.Write(buf, binary.BigEndian, uint16(0x0103))
-	binary.Write(buf, binary.BigEndian, uint16(4+len(d)))
-	buf.Write(d)
+	writeSUAAddr(buf, 0x0103, m.cdpa)
 
 	// Sequence Control
 	writeUint32(buf, 0x0116, m.sequenceCtrl)
 
 	// SS7 Hop Count (Optional)
-	// if m.hopCount != 0 {
-	// 	writeUint8(buf, 0x0101, m.hopCount)
-	// }
+	if m.hopCount != 0 {
+		writeUint8(buf, 0x0101, m.hopCount)
+	}
 
 	// Importance (Optional)
-	// if m.importance != nil {
-	// 	writeUint8(buf, 0x0113, *m.importance)
-	// }
+	if m.importance != nil {
+		writeUint8(buf, 0x0113, *m.importance)
+	}
 
 	// Message Priority (Optional)
 	// if m.priority != nil {
@@ -173,15 +158,15 @@ func (m *TxCLDT) marshal() (uint8, uint8, []byte) {
 	// }
 
 	// Segmentation (Optional)
-	// if m.segmentRef != nil {
-	//	var v uint32
-	//	if m.first {
-	//		v |= 0x80000000
-	//	}
-	//	v |= uint32(m.remain) << 32
-	//	v |= *m.segmentRef
-	//	writeUint32(buf, 0x0117, v)
-	// }
+	if m.segment != nil {
+		var v uint32
+		if m.segment.first {
+			v |= 0x80000000
+		}
+		v |= uint32(m.segment.remain&0x7f) << 24
+		v |= m.segment.ref & 0x00ffffff
+		writeUint32(buf, 0x0117, v)
+	}
 
 	// Data
 	writeData(buf, m.data)
@@ -190,18 +175,9 @@ func (m *TxCLDT) marshal() (uint8, uint8, []byte) {
 }
 
 func (m *RxCLDT) handleMessage(c *ASP) {
-	c.RxTransfer++
-
-	if PayloadHandler != nil {
-		PayloadHandler(m.cgpa, m.cdpa, m.data)
-	} else if m.returnOnError {
-		c.msgQ <- &TxCLDR{
-			ctx:   m.ctx,
-			cause: SubsystemFailure,
-			userData: userData{
-				cgpa: LocalAddr,
-				cdpa: m.cgpa,
-				data: m.data}}
+	atomic.AddUint64(&c.RxTransfer, 1)
+	if c.handler != nil {
+		c.handler(m.cgpa, m.cdpa, m.data)
 	}
 }
 
@@ -219,18 +195,26 @@ func (m *RxCLDT) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.cdpa, e = readSUAAddr(r, l)
 	case 0x0116: // Sequence Control
 		m.sequenceCtrl, e = readUint32(r, l)
-	// case 0x0101: // SS7 Hop Count (Optional)
-	//	m.hopCount, e = readUint8(r, l)
-	// case 0x0113: // Importance (Optional)
-	//	var tmp uint8
-	//	if tmp, e = readUint8(r, l); e == nil {
-	//		m.importance = &tmp
-	//	}
+	case 0x0101: // SS7 Hop Count (Optional)
+		m.hopCount, e = readUint8(r, l)
+	case 0x0113: // Importance (Optional)
+		var tmp uint8
+		if tmp, e = readUint8(r, l); e == nil {
+			m.importance = &tmp
+		}
 	// case 0x0114: // Message Priority (Optional)
 	//	var tmp uint8
 	//	if tmp, e = readUint8(r, l); e == nil {
 	//		m.priority = &tmp
 	//	}
+	case 0x0117: // Segmentation (Optional)
+		var tmp uint32
+		if tmp, e = readUint32(r, l); e == nil {
+			m.segment = &segmentation{
+				first:  tmp&0x80000000 == 0x80000000,
+				remain: uint8(tmp>>24) & 0x7f,
+				ref:    tmp & 0x00ffffff}
+		}
 	case 0x010B: // Data
 		m.data, e = readData(r, l)
 	default:
@@ -238,7 +222,6 @@ func (m *RxCLDT) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	}
 	return
 }
-*/
 
 /*
 CLDR is Connectionless Data Response message. (Message type = 0x02)
@@ -290,50 +273,21 @@ CLDR is Connectionless Data Response message. (Message type = 0x02)
 	/                             Data                              /
 	\                                                               \
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
 type CLDR struct {
-	ctx   uint32
-	cause Cause
-	//cgpa  SCCPAddr
-	//cdpa  SCCPAddr
+	ctx uint32
 
-	// hopCount   uint8
-	// importance *uint8
 	// priority   *uint8
 	// correlation *uint32
 
-	// first      bool
-	// remain     uint8
-	// segmentRef *uint32
-
-	//data []byte
 	userData
 }
-type RxCLDR CLDR
-type TxCLDR CLDR
 
-type Cause uint32
-
-const (
-	Success                               Cause = 0x0000
-	NoTranslationForAnAddressOfSuchNature Cause = 0x0100
-	NoTranslationForThisSpecificAddress   Cause = 0x0101
-	SubsystemCongestion                   Cause = 0x0102
-	SubsystemFailure                      Cause = 0x0103
-	UnequippedUser                        Cause = 0x0104
-	MtpFailure                            Cause = 0x0105
-	NetworkCongestion                     Cause = 0x0106
-	Unqualified                           Cause = 0x0107
-	ErrorInMessageTransport               Cause = 0x0108
-	ErrorInLocalProcessing                Cause = 0x0109
-	DestinationCannotPerformReassembly    Cause = 0x010a
-	SccpFailure                           Cause = 0x010b
-	HopCounterViolation                   Cause = 0x010c
-	SegmentationNotSupported              Cause = 0x010d
-	SegmentationFailure                   Cause = 0x010e
-)
+type TxCLDR CLDR
+type RxCLDR CLDR
 
 func (m *TxCLDR) handleMessage(c *ASP) {
-	c.TxResponse++
+	atomic.AddUint64(&c.TxResponse, 1)
 
 	cls, typ, b := m.marshal()
 	buf := new(bytes.Buffer)
@@ -351,7 +305,7 @@ func (m *TxCLDR) handleMessage(c *ASP) {
 	// Message Data
 	buf.Write(b)
 
-	i, e := sctpSend(c.sock, buf.Bytes(), 0, false)
+	i, e := c.conn.send(buf.Bytes(), c.streamOf(m.sls))
 	if TxFailureNotify != nil {
 		if e != nil {
 			TxFailureNotify(e, buf.Bytes())
@@ -373,26 +327,20 @@ func (m *TxCLDR) marshal() (uint8, uint8, []byte) {
 	writeUint32(buf, 0x0106, uint32(m.cause))
 
 	// Source Address
-	d := m.cgpa.marshalSUA()
-	binary.Write(buf, binary.BigEndian, uint16(0x0102))
-	binary.Write(buf, binary.BigEndian, uint16(4+len(d)))
-	buf.Write(d)
+	writeSUAAddr(buf, 0x0102, m.cgpa)
 
 	// Destination Address
-	d = m.cdpa.marshalSUA()
-	binary.Write(buf, binary.BigEndian, uint16(0x0103))
-	binary.Write(buf, binary.BigEndian, uint16(4+len(d)))
-	buf.Write(d)
+	writeSUAAddr(buf, 0x0103, m.cdpa)
 
 	// SS7 Hop Count (Optional)
-	// if m.hopCount != 0 {
-	// 	writeUint8(buf, 0x0101, m.hopCount)
-	// }
+	if m.hopCount != 0 {
+		writeUint8(buf, 0x0101, m.hopCount)
+	}
 
 	// Importance (Optional)
-	// if m.importance != nil {
-	// 	writeUint8(buf, 0x0113, *m.importance)
-	// }
+	if m.importance != nil {
+		writeUint8(buf, 0x0113, *m.importance)
+	}
 
 	// Message Priority (Optional)
 	// if m.priority != nil {
@@ -404,18 +352,7 @@ func (m *TxCLDR) marshal() (uint8, uint8, []byte) {
 	//	writeUint32(buf, 0x0013, *m.correlation)
 	// }
 
-	// Segmentation (Optional)
-	// if m.segmentRef != nil {
-	//	var v uint32
-	//	if m.first {
-	//		v |= 0x80000000
-	//	}
-	//	v |= uint32(m.remain) << 32
-	//	v |= *m.segmentRef
-	//	writeUint32(buf, 0x0117, v)
-	// }
-
-	// Data
+	// Data (Optional)
 	if len(m.data) != 0 {
 		writeData(buf, m.data)
 	}
@@ -427,14 +364,14 @@ func (m *RxCLDR) handleMessage(c *ASP) {
 		TxFailureNotify(
 			fmt.Errorf("error response(cause=%x) from peer", m.cause), m.data)
 	}
-	c.RxResponse++
+	atomic.AddUint64(&c.RxResponse, 1)
 }
 
 func (m *RxCLDR) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	switch t {
 	case 0x0006: // Routing Context
 		m.ctx, e = readUint32(r, l)
-	case 0x0106: // Sequence Control
+	case 0x0106: // SCCP Cause
 		var tmp uint32
 		tmp, e = readUint32(r, l)
 		m.cause = Cause(tmp)
@@ -442,18 +379,26 @@ func (m *RxCLDR) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.cgpa, e = readSUAAddr(r, l)
 	case 0x0103: // Destination Address
 		m.cdpa, e = readSUAAddr(r, l)
-	// case 0x0101: // SS7 Hop Count (Optional)
-	//	m.hopCount, e = readUint8(r, l)
-	// case 0x0113: // Importance (Optional)
-	//	var tmp uint8
-	//	if tmp, e = readUint8(r, l); e == nil {
-	//		m.importance = &tmp
-	//	}
+	case 0x0101: // SS7 Hop Count (Optional)
+		m.hopCount, e = readUint8(r, l)
+	case 0x0113: // Importance (Optional)
+		var tmp uint8
+		if tmp, e = readUint8(r, l); e == nil {
+			m.importance = &tmp
+		}
 	// case 0x0114: // Message Priority (Optional)
 	//	var tmp uint8
 	//	if tmp, e = readUint8(r, l); e == nil {
 	//		m.priority = &tmp
 	//	}
+	case 0x0117: // Segmentation (Optional)
+		var tmp uint32
+		if tmp, e = readUint32(r, l); e == nil {
+			m.segment = &segmentation{
+				first:  tmp&0x80000000 == 0x80000000,
+				remain: uint8(tmp>>24) & 0x7f,
+				ref:    tmp & 0x00ffffff}
+		}
 	case 0x010B: // Data
 		m.data, e = readData(r, l)
 	default:
@@ -461,4 +406,3 @@ func (m *RxCLDR) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	}
 	return
 }
-*/
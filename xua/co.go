@@ -1,17 +1,873 @@
 package xua
 
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 /*
 CO: SCCP Connection-Oriented Messages
 Message class = 0x08
-// 0x01 Connection Request (CORE)
-// 0x02 Connection Acknowledge (COAK)
-// 0x03 Connection Refused (COREF)
-// 0x04 Release Request (RELRE)
-// 0x05 Release Complete (RELCO)
-// 0x06 Reset Confirm (RESCO)
-// 0x07 Reset Request (RESRE)
-// 0x08 Connection Oriented Data Transfer (CODT)
-// 0x09 Connection Oriented Data Acknowledge (CODA)
-// 0x0a Connection Oriented Error (COERR)
-// 0x0b Inactivity Test (COIT)
 */
+
+var (
+	tconn  = time.Minute      // Connection establishment timer
+	tias   = time.Minute * 5  // Send inactivity timer
+	tiar   = time.Minute * 11 // Receive inactivity timer
+	trel   = time.Second * 10 // Release timer
+	treset = time.Second * 10 // Reset timer
+)
+
+const (
+	coCORE  uint8 = 0x01 // Connection Request
+	coCOAK  uint8 = 0x02 // Connection Acknowledge
+	coCOREF uint8 = 0x03 // Connection Refused
+	coRELRE uint8 = 0x04 // Release Request
+	coRELCO uint8 = 0x05 // Release Complete
+	coRESCO uint8 = 0x06 // Reset Confirm
+	coRESRE uint8 = 0x07 // Reset Request
+	coCODT  uint8 = 0x08 // Connection Oriented Data Transfer
+	coCODA  uint8 = 0x09 // Connection Oriented Data Acknowledge
+	coCOERR uint8 = 0x0a // Connection Oriented Error
+	coCOIT  uint8 = 0x0b // Inactivity Test
+)
+
+const (
+	// coCredit is window size of protocol class 3 that is proposed
+	// by this side.
+	coCredit uint8 = 16
+	// coBacklog is number of incoming connections waiting Accept.
+	coBacklog = 64
+	// maxReference is mask of 24 bit local reference number.
+	maxReference = 0x00ffffff
+)
+
+// coParameters is parameter tags of each CO message
+// in order of RFC 3868, except Routing Context.
+var coParameters = map[uint8][]uint16{
+	coCORE:  {0x0115, 0x0104, 0x0103, 0x0116, 0x0102, 0x010A, 0x0113, 0x0101, 0x010B},
+	coCOAK:  {0x0115, 0x0105, 0x0104, 0x0116, 0x010A, 0x0103, 0x0113, 0x010B},
+	coCOREF: {0x0105, 0x0106, 0x0103, 0x0113, 0x010B},
+	coRELRE: {0x0105, 0x0104, 0x0106, 0x0113, 0x010B},
+	coRELCO: {0x0105, 0x0104, 0x0113},
+	coRESCO: {0x0105, 0x0104},
+	coRESRE: {0x0105, 0x0104, 0x0106},
+	coCODT:  {0x0107, 0x0105, 0x010B},
+	coCODA:  {0x0105, 0x0108, 0x010A},
+	coCOERR: {0x0105, 0x0106},
+	coCOIT:  {0x0115, 0x0104, 0x0105, 0x0107, 0x010A},
+}
+
+/*
+CO is SCCP connection-oriented message. Message type is one of following.
+
+	0x01 Connection Request (CORE)
+	0x02 Connection Acknowledge (COAK)
+	0x03 Connection Refused (COREF)
+	0x04 Release Request (RELRE)
+	0x05 Release Complete (RELCO)
+	0x06 Reset Confirm (RESCO)
+	0x07 Reset Request (RESRE)
+	0x08 Connection Oriented Data Transfer (CODT)
+	0x09 Connection Oriented Data Acknowledge (CODA)
+	0x0a Connection Oriented Error (COERR)
+	0x0b Inactivity Test (COIT)
+
+Parameters
+
+	Tag = 0x0006 Routing Context
+	Tag = 0x0115 Protocol Class
+	Tag = 0x0104 Source Reference Number
+	Tag = 0x0105 Destination Reference Number
+	Tag = 0x0106 SCCP Cause
+	Tag = 0x0102 Source Address
+	Tag = 0x0103 Destination Address
+	Tag = 0x0116 Sequence Control
+	Tag = 0x010A Credit (class 3)
+	Tag = 0x0113 Importance
+	Tag = 0x0101 SS7 Hop Count
+	Tag = 0x010B Data
+
+Sequence Number (Tag = 0x0107, class 3)
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|          Reserved             |Rcv Seq Num  |M|Sent Seq Num |0|
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+Receive Sequence Number (Tag = 0x0108, class 3)
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                  Reserved                     |Rcv Seq Num  |0|
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+type CO struct {
+	typ           uint8
+	ctx           uint32
+	protocolClass uint8
+	srcRef        uint32
+	dstRef        uint32
+	cause         Cause
+	cgpa          *SCCPAddr
+	cdpa          *SCCPAddr
+	sequenceCtrl  uint32
+	ps            uint8
+	pr            uint8
+	more          bool
+	credit        uint8
+	importance    *uint8
+	hopCount      uint8
+	data          []byte
+}
+
+type TxCO CO
+type RxCO CO
+
+func (m *TxCO) handleMessage(c *ASP) {
+	atomic.AddUint64(&c.TxTransfer, 1)
+
+	cls, typ, b := m.marshal()
+	buf := new(bytes.Buffer)
+
+	// version
+	buf.WriteByte(1)
+	// reserved
+	buf.WriteByte(0)
+	// Message Class
+	buf.WriteByte(cls)
+	// Message Type
+	buf.WriteByte(typ)
+	// Message Length
+	binary.Write(buf, binary.BigEndian, uint32(len(b)+8))
+	// Message Data
+	buf.Write(b)
+
+	i, e := c.conn.send(buf.Bytes(), c.streamOf(m.sequenceCtrl))
+	if e != nil && c.se.redirect(c, m.ctx, m.sequenceCtrl, m) {
+		return
+	}
+	if TxFailureNotify != nil {
+		if e != nil {
+			TxFailureNotify(e, buf.Bytes())
+		} else if i != len(buf.Bytes()) {
+			TxFailureNotify(fmt.Errorf("failed to send complete data"), buf.Bytes())
+		}
+	}
+}
+
+func (*TxCO) handleResult(message) {}
+
+func (m *TxCO) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	// Routing Context
+	writeUint32(buf, 0x0006, m.ctx)
+
+	for _, t := range coParameters[m.typ] {
+		switch t {
+		case 0x0115: // Protocol Class
+			writeUint8(buf, t, m.protocolClass)
+		case 0x0104: // Source Reference Number
+			writeUint32(buf, t, m.srcRef)
+		case 0x0105: // Destination Reference Number
+			writeUint32(buf, t, m.dstRef)
+		case 0x0106: // SCCP Cause
+			writeUint32(buf, t, uint32(m.cause))
+		case 0x0102: // Source Address (Optional)
+			if m.cgpa != nil {
+				writeSUAAddr(buf, t, *m.cgpa)
+			}
+		case 0x0103: // Destination Address
+			if m.cdpa != nil {
+				writeSUAAddr(buf, t, *m.cdpa)
+			}
+		case 0x0116: // Sequence Control
+			writeUint32(buf, t, m.sequenceCtrl)
+		case 0x0107: // Sequence Number (Class 3)
+			if m.protocolClass == 3 {
+				v := uint32(m.pr&0x7f)<<9 | uint32(m.ps&0x7f)<<1
+				if m.more {
+					v |= 0x0100
+				}
+				writeUint32(buf, t, v)
+			}
+		case 0x0108: // Receive Sequence Number (Class 3)
+			if m.protocolClass == 3 {
+				writeUint32(buf, t, uint32(m.pr&0x7f)<<1)
+			}
+		case 0x010A: // Credit (Class 3)
+			if m.protocolClass == 3 {
+				writeUint8(buf, t, m.credit)
+			}
+		case 0x0113: // Importance (Optional)
+			if m.importance != nil {
+				writeUint8(buf, t, *m.importance)
+			}
+		case 0x0101: // SS7 Hop Count (Optional)
+			if m.hopCount != 0 {
+				writeUint8(buf, t, m.hopCount)
+			}
+		case 0x010B: // Data
+			if len(m.data) != 0 || m.typ == coCODT {
+				writeData(buf, m.data)
+			}
+		}
+	}
+
+	return 0x08, m.typ, buf.Bytes()
+}
+
+func (m *RxCO) handleMessage(c *ASP) {
+	atomic.AddUint64(&c.RxTransfer, 1)
+	c.se.receiveCO((*CO)(m))
+}
+
+func (m *RxCO) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	var tmp uint32
+	switch t {
+	case 0x0006: // Routing Context
+		m.ctx, e = readUint32(r, l)
+	case 0x0115: // Protocol Class
+		m.protocolClass, e = readUint8(r, l)
+		m.protocolClass = m.protocolClass & 0x7F
+	case 0x0104: // Source Reference Number
+		m.srcRef, e = readUint32(r, l)
+	case 0x0105: // Destination Reference Number
+		m.dstRef, e = readUint32(r, l)
+	case 0x0106: // SCCP Cause
+		tmp, e = readUint32(r, l)
+		m.cause = Cause(tmp)
+	case 0x0102: // Source Address
+		var a SCCPAddr
+		if a, e = readSUAAddr(r, l); e == nil {
+			m.cgpa = &a
+		}
+	case 0x0103: // Destination Address
+		var a SCCPAddr
+		if a, e = readSUAAddr(r, l); e == nil {
+			m.cdpa = &a
+		}
+	case 0x0116: // Sequence Control
+		m.sequenceCtrl, e = readUint32(r, l)
+	case 0x0107: // Sequence Number
+		if tmp, e = readUint32(r, l); e == nil {
+			m.pr = uint8(tmp>>9) & 0x7f
+			m.more = tmp&0x0100 == 0x0100
+			m.ps = uint8(tmp>>1) & 0x7f
+		}
+	case 0x0108: // Receive Sequence Number
+		if tmp, e = readUint32(r, l); e == nil {
+			m.pr = uint8(tmp>>1) & 0x7f
+		}
+	case 0x010A: // Credit
+		m.credit, e = readUint8(r, l)
+	case 0x0113: // Importance (Optional)
+		var v uint8
+		if v, e = readUint8(r, l); e == nil {
+			m.importance = &v
+		}
+	case 0x0101: // SS7 Hop Count (Optional)
+		m.hopCount, e = readUint8(r, l)
+	case 0x010B: // Data
+		m.data, e = readData(r, l)
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+// ErrReleased is returned by Write to released SCCP connection.
+var ErrReleased = errors.New("SCCP connection is released")
+
+/*
+SCCPConn is SCCP connection of protocol class 2 or 3 over SUA.
+Data written by Write is sent as one CODT,
+and data of one CODT (or CODTs with more data indication) is read by Read.
+Sequence numbers and flow control window are handled in protocol class 3.
+*/
+type SCCPConn struct {
+	se     *SignalingEndpoint
+	ctx    uint32
+	sls    uint32
+	class  uint8
+	credit uint8
+	local  uint32
+	remote uint32
+	laddr  SCCPAddr
+	raddr  SCCPAddr
+
+	msgQ chan *CO
+	reqQ chan coRequest
+	rxQ  chan []byte
+	rest []byte
+	done chan any
+	err  error
+
+	// congested is closed when msgQ is overflowed
+	congested chan any
+	congest   sync.Once
+}
+
+// coRequest is request from user of SCCPConn.
+type coRequest struct {
+	typ    uint8
+	data   []byte
+	result chan error
+}
+
+// LocalAddr returns SCCP address of this side.
+func (c *SCCPConn) LocalAddr() SCCPAddr { return c.laddr }
+
+// RemoteAddr returns SCCP address of the peer.
+func (c *SCCPConn) RemoteAddr() SCCPAddr { return c.raddr }
+
+// ProtocolClass returns protocol class of the connection.
+func (c *SCCPConn) ProtocolClass() uint8 { return c.class }
+
+func (c *SCCPConn) String() string {
+	return fmt.Sprintf("SCCP connection %06x <-> %06x, class %d",
+		c.local, c.remote, c.class)
+}
+
+/*
+Read reads received data.
+If b is shorter than the data, rest of the data is read by following Read.
+io.EOF is returned after the connection is released by the peer.
+*/
+func (c *SCCPConn) Read(b []byte) (int, error) {
+	if len(c.rest) == 0 {
+		select {
+		case c.rest = <-c.rxQ:
+		case <-c.done:
+			select {
+			case c.rest = <-c.rxQ:
+			default:
+				return 0, c.err
+			}
+		}
+	}
+	n := copy(b, c.rest)
+	c.rest = c.rest[n:]
+	return n, nil
+}
+
+// Write sends b in one CODT.
+// In protocol class 3, Write is blocked while flow control window is closed
+// or the connection is reset.
+func (c *SCCPConn) Write(b []byte) (int, error) {
+	r := coRequest{
+		typ:    coCODT,
+		data:   append([]byte{}, b...),
+		result: make(chan error, 1)}
+	if e := c.request(r); e != nil {
+		return 0, e
+	}
+	return len(b), nil
+}
+
+// Reset resets sequence numbers of protocol class 3 connection
+// by RESRE and waits RESCO.
+func (c *SCCPConn) Reset() error {
+	if c.class != 3 {
+		return fmt.Errorf("reset is not available in protocol class %d", c.class)
+	}
+	return c.request(coRequest{typ: coRESRE, result: make(chan error, 1)})
+}
+
+// Close releases the connection by RELRE and waits RELCO.
+func (c *SCCPConn) Close() error {
+	c.request(coRequest{typ: coRELRE, result: make(chan error, 1)})
+	return nil
+}
+
+func (c *SCCPConn) request(r coRequest) error {
+	select {
+	case c.reqQ <- r:
+	case <-c.done:
+		return ErrReleased
+	}
+	return <-r.result
+}
+
+// seqDiff returns a - b in modulo 128.
+func seqDiff(a, b uint8) uint8 {
+	return (a - b) & 0x7f
+}
+
+// serve handles messages and requests of the established connection
+// until it is released.
+func (c *SCCPConn) serve() {
+	tx := time.NewTimer(tias)
+	rx := time.NewTimer(tiar)
+	guard := time.NewTimer(tconn)
+	guard.Stop()
+	defer func() {
+		tx.Stop()
+		rx.Stop()
+		guard.Stop()
+	}()
+
+	var (
+		ps, pr, ack uint8 // next P(S), next expected P(S) and last received P(R)
+		segment     []byte
+		pending     []coRequest
+		resetReq    []coRequest
+		closeReq    []coRequest
+		resetting   bool
+		releasing   bool
+		repeated    bool
+		relCause    Cause
+		cause       error
+		congested   = c.congested
+	)
+
+	send := func(m *CO) error {
+		m.protocolClass = c.class
+		m.srcRef, m.dstRef = c.local, c.remote
+		m.importance = c.se.Importance
+		e := c.se.sendCO(c.ctx, c.sls, m)
+		if e == nil {
+			tx.Reset(tias)
+		}
+		return e
+	}
+	reset := func(r Cause) {
+		resetting = true
+		segment = nil
+		send(&CO{typ: coRESRE, cause: r})
+		guard.Reset(treset)
+	}
+	reinit := func() {
+		ps, pr, ack = 0, 0, 0
+		resetting = false
+		guard.Stop()
+		for _, r := range resetReq {
+			r.result <- nil
+		}
+		resetReq = nil
+	}
+	release := func(r Cause, e error) {
+		if !releasing {
+			releasing = true
+			relCause = r
+			cause = e
+			send(&CO{typ: coRELRE, cause: r})
+			guard.Reset(trel)
+		}
+	}
+	validPR := func(p uint8) bool {
+		return seqDiff(p, ack) <= seqDiff(ps, ack)
+	}
+
+	for cause == nil || releasing {
+		select {
+		case m := <-c.msgQ:
+			rx.Reset(tiar)
+			switch m.typ {
+			case coCODT:
+				if releasing || resetting {
+					break
+				}
+				if c.class == 3 {
+					if m.ps != pr {
+						reset(ResetIncorrectPS)
+						break
+					} else if !validPR(m.pr) {
+						reset(ResetIncorrectPR)
+						break
+					}
+					pr = (pr + 1) & 0x7f
+					ack = m.pr
+					send(&CO{typ: coCODA, pr: pr, credit: c.credit})
+				}
+				segment = append(segment, m.data...)
+				if !m.more {
+					select {
+					case c.rxQ <- segment:
+					default:
+						// user does not read the data
+						release(ReleaseEndUserCongestion,
+							fmt.Errorf("receive queue overflow"))
+					}
+					segment = nil
+				}
+			case coCODA:
+				if c.class != 3 || releasing || resetting {
+				} else if validPR(m.pr) {
+					ack = m.pr
+				} else {
+					reset(ResetIncorrectPR)
+				}
+			case coCOIT:
+				if m.srcRef != c.remote || m.protocolClass != c.class {
+					release(ReleaseInconsistentData,
+						fmt.Errorf("inconsistent connection data in COIT"))
+				}
+			case coRESRE:
+				if c.class == 3 && !releasing {
+					send(&CO{typ: coRESCO})
+					segment = nil
+					reinit()
+				}
+			case coRESCO:
+				if resetting && !releasing {
+					reinit()
+				}
+			case coRELRE:
+				send(&CO{typ: coRELCO})
+				if cause == nil {
+					cause = io.EOF
+					if m.cause != ReleaseEndUserOriginated &&
+						m.cause != ReleaseSCCPUserOriginated {
+						cause = fmt.Errorf("released by peer (cause=%s)", m.cause)
+					}
+				}
+				releasing = false
+			case coRELCO:
+				if releasing {
+					releasing = false
+				}
+			case coCOERR:
+				if cause == nil {
+					cause = fmt.Errorf("error from peer (cause=%s)", m.cause)
+				}
+				releasing = false
+			}
+
+		case r := <-c.reqQ:
+			switch r.typ {
+			case coCODT:
+				pending = append(pending, r)
+			case coRESRE:
+				resetReq = append(resetReq, r)
+				if !resetting {
+					reset(ResetEndUserOriginated)
+				}
+			case coRELRE:
+				closeReq = append(closeReq, r)
+				release(ReleaseEndUserOriginated, net.ErrClosed)
+			}
+
+		case <-congested:
+			congested = nil
+			release(ReleaseEndUserCongestion,
+				fmt.Errorf("message queue overflow"))
+
+		case <-tx.C:
+			send(&CO{typ: coCOIT, ps: ps, pr: pr, credit: c.credit})
+
+		case <-rx.C:
+			release(ReleaseInactivityTimer,
+				fmt.Errorf("receive inactivity timer expired"))
+
+		case <-guard.C:
+			if !releasing {
+				release(ReleaseResetTimer, fmt.Errorf("reset timer expired"))
+			} else if !repeated {
+				repeated = true
+				send(&CO{typ: coRELRE, cause: relCause})
+				guard.Reset(trel)
+			} else {
+				releasing = false
+			}
+
+		case <-c.se.block:
+			if cause == nil {
+				cause = net.ErrClosed
+			}
+			releasing = false
+		}
+
+		for len(pending) != 0 && !resetting && cause == nil &&
+			(c.class != 3 || seqDiff(ps, ack) < c.credit) {
+			r := pending[0]
+			pending = pending[1:]
+			r.result <- send(&CO{typ: coCODT, ps: ps, pr: pr, data: r.data})
+			if c.class == 3 {
+				ps = (ps + 1) & 0x7f
+			}
+		}
+	}
+
+	c.err = cause
+	c.se.removeConn(c)
+	for _, q := range [][]coRequest{pending, resetReq, closeReq} {
+		for _, r := range q {
+			r.result <- ErrReleased
+		}
+	}
+	close(c.done)
+}
+
+/*
+DialSCCP establishes SCCP connection to cdpa with ProtocolClass
+of the endpoint. It is available only for SUA.
+*/
+func (se *SignalingEndpoint) DialSCCP(cdpa SCCPAddr) (*SCCPConn, error) {
+	if se.Protocol != SUA {
+		return nil, fmt.Errorf("connection-oriented service is available only for SUA")
+	}
+	class := se.ProtocolClass
+	if class == 0 {
+		class = 2
+	} else if class != 2 && class != 3 {
+		return nil, fmt.Errorf("invalid protocol class %d", class)
+	}
+
+	c := se.newConn(se.Context, se.nextSLS()&SLSMask, class)
+	c.laddr, c.raddr = se.SCCPAddr, cdpa
+	c.credit = coCredit
+
+	if e := se.sendCO(c.ctx, c.sls, &CO{
+		typ:           coCORE,
+		protocolClass: class,
+		srcRef:        c.local,
+		cdpa:          &cdpa,
+		cgpa:          &c.laddr,
+		credit:        c.credit,
+		importance:    se.Importance,
+		hopCount:      se.HopCounter}); e != nil {
+		se.removeConn(c)
+		return nil, e
+	}
+
+	t := time.NewTimer(tconn)
+	defer t.Stop()
+	for {
+		select {
+		case m := <-c.msgQ:
+			switch m.typ {
+			case coCOAK:
+				c.remote = m.srcRef
+				if m.protocolClass == 2 {
+					c.class = 2
+				}
+				if m.credit < c.credit {
+					c.credit = m.credit
+				}
+				if len(m.data) != 0 {
+					c.rxQ <- m.data
+				}
+				go c.serve()
+				return c, nil
+			case coCOREF:
+				se.removeConn(c)
+				return nil, fmt.Errorf("connection refused (cause=%s)", m.cause)
+			}
+		case <-t.C:
+			se.removeConn(c)
+			return nil, fmt.Errorf("connection establishment timer expired")
+		case <-se.block:
+			se.removeConn(c)
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// SCCPListener accepts incoming SCCP connection.
+type SCCPListener struct {
+	se *SignalingEndpoint
+	q  chan *SCCPConn
+}
+
+/*
+ListenSCCP returns listener for incoming SCCP connection.
+Only one listener is available for the endpoint at a time.
+CORE is refused while no listener is available.
+*/
+func (se *SignalingEndpoint) ListenSCCP() (*SCCPListener, error) {
+	if se.Protocol != SUA {
+		return nil, fmt.Errorf("connection-oriented service is available only for SUA")
+	}
+	l := <-se.listener
+	if l != nil {
+		se.listener <- l
+		return nil, fmt.Errorf("already listening")
+	}
+	l = &SCCPListener{se: se, q: make(chan *SCCPConn, coBacklog)}
+	se.listener <- l
+	return l, nil
+}
+
+// Accept waits incoming connection and answers it by COAK.
+func (l *SCCPListener) Accept() (*SCCPConn, error) {
+	for {
+		c, ok := <-l.q
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		if e := l.se.sendCO(c.ctx, c.sls, &CO{
+			typ:           coCOAK,
+			protocolClass: c.class,
+			dstRef:        c.remote,
+			srcRef:        c.local,
+			credit:        c.credit,
+			importance:    l.se.Importance}); e != nil {
+			l.se.removeConn(c)
+			continue
+		}
+		go c.serve()
+		return c, nil
+	}
+}
+
+// Close stops listening and refuses connections waiting Accept.
+func (l *SCCPListener) Close() error {
+	cur := <-l.se.listener
+	if cur != l {
+		l.se.listener <- cur
+		return net.ErrClosed
+	}
+	close(l.q)
+	l.se.listener <- nil
+
+	for c := range l.q {
+		l.se.refuse(c.ctx, c.sls, c.remote, RefusalEndUserOriginated)
+		l.se.removeConn(c)
+	}
+	return nil
+}
+
+func (se *SignalingEndpoint) newConn(ctx, sls uint32, class uint8) *SCCPConn {
+	c := &SCCPConn{
+		se:    se,
+		ctx:   ctx,
+		sls:   sls,
+		class: class,
+		msgQ:  make(chan *CO, coBacklog),
+		reqQ:  make(chan coRequest),
+		rxQ:   make(chan []byte, se.dispatchOptions().QueueDepth),
+		done:  make(chan any),
+
+		congested: make(chan any)}
+
+	conns := <-se.conns
+	for {
+		ref := <-se.coRef
+		se.coRef <- ref + 1
+		ref &= maxReference
+		if _, ok := conns[ref]; !ok && ref != 0 {
+			c.local = ref
+			break
+		}
+	}
+	conns[c.local] = c
+	se.conns <- conns
+	return c
+}
+
+func (se *SignalingEndpoint) removeConn(c *SCCPConn) {
+	conns := <-se.conns
+	if conns[c.local] == c {
+		delete(conns, c.local)
+	}
+	se.conns <- conns
+}
+
+// sendCO sends CO message via one of active ASPs of AS for ctx.
+// *WriteError with ErrNoActiveASP is returned if no ASP is active.
+func (se *SignalingEndpoint) sendCO(ctx, sls uint32, m *CO) error {
+	as, asps := se.selectASP(ctx, sls)
+	if len(asps) == 0 {
+		return &WriteError{Err: ErrNoActiveASP, Cause: MtpFailure}
+	}
+	m.ctx = as.Context
+	m.sequenceCtrl = sls
+	if !asps[0].send((*TxCO)(m)) {
+		return &WriteError{Err: ErrNoActiveASP, Cause: MtpFailure}
+	}
+	return nil
+}
+
+func (se *SignalingEndpoint) refuse(ctx, sls, ref uint32, cause Cause) {
+	se.sendCO(ctx, sls, &CO{typ: coCOREF, dstRef: ref, cause: cause})
+}
+
+// receiveCO dispatches received CO message to the connection
+// of the destination reference number.
+func (se *SignalingEndpoint) receiveCO(m *CO) {
+	if m.typ == coCORE {
+		se.incoming(m)
+		return
+	}
+
+	conns := <-se.conns
+	c, ok := conns[m.dstRef]
+	se.conns <- conns
+	if ok {
+		// ASP is not blocked by the connection
+		select {
+		case c.msgQ <- m:
+		case <-c.done:
+		default:
+			c.congest.Do(func() { close(c.congested) })
+		}
+		return
+	}
+
+	switch m.typ {
+	case coRELRE:
+		se.sendCO(m.ctx, m.sequenceCtrl, &CO{
+			typ: coRELCO, dstRef: m.srcRef, srcRef: m.dstRef})
+	case coCOAK:
+		se.sendCO(m.ctx, m.sequenceCtrl, &CO{
+			typ: coRELRE, dstRef: m.srcRef, srcRef: m.dstRef,
+			cause: ReleaseInconsistentData})
+	case coRESRE, coRESCO, coCOIT:
+		se.sendCO(m.ctx, m.sequenceCtrl, &CO{
+			typ: coCOERR, dstRef: m.srcRef, cause: ErrorUnassignedReference})
+	default:
+		if RxFailureNotify != nil {
+			RxFailureNotify(fmt.Errorf(
+				"unknown destination reference %06x", m.dstRef), m.data)
+		}
+	}
+}
+
+// incoming handles received CORE and queues new connection to the listener.
+func (se *SignalingEndpoint) incoming(m *CO) {
+	if m.protocolClass != 2 && m.protocolClass != 3 {
+		se.refuse(m.ctx, m.sequenceCtrl, m.srcRef, RefusalQOSNotAvailable)
+		return
+	}
+
+	l := <-se.listener
+	defer func() { se.listener <- l }()
+	if l == nil {
+		se.refuse(m.ctx, m.sequenceCtrl, m.srcRef, RefusalUnequippedUser)
+		return
+	}
+
+	c := se.newConn(m.ctx, m.sequenceCtrl, m.protocolClass)
+	c.remote = m.srcRef
+	c.credit = coCredit
+	if m.credit < c.credit {
+		c.credit = m.credit
+	}
+	if m.cdpa != nil {
+		c.laddr = *m.cdpa
+	}
+	if m.cgpa != nil {
+		c.raddr = *m.cgpa
+	}
+	if len(m.data) != 0 {
+		c.rxQ <- m.data
+	}
+
+	select {
+	case l.q <- c:
+	default:
+		se.removeConn(c)
+		se.refuse(m.ctx, m.sequenceCtrl, m.srcRef, RefusalSubsystemCongestion)
+	}
+}
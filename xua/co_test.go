@@ -0,0 +1,133 @@
+package xua
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSCCPConnClass3(t *testing.T) {
+	sgp, asp := pipePair(t, 2910, SUA)
+	defer sgp.Close()
+	defer asp.Close()
+
+	l, e := sgp.ListenSCCP()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	go func() {
+		c, e := l.Accept()
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		io.Copy(c, c)
+		c.Close()
+	}()
+
+	asp.ProtocolClass = 3
+	c, e := asp.DialSCCP(sgp.SCCPAddr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c.ProtocolClass() != 3 {
+		t.Fatalf("protocol class %d != 3", c.ProtocolClass())
+	}
+
+	buf := make([]byte, 16)
+	for i := range 200 {
+		if i == 100 {
+			if e = c.Reset(); e != nil {
+				t.Fatal(e)
+			}
+		}
+		data := []byte{byte(i), byte(i >> 8)}
+		if _, e = c.Write(data); e != nil {
+			t.Fatal(e)
+		}
+		n, e := c.Read(buf)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !bytes.Equal(buf[:n], data) {
+			t.Fatalf("%x != %x", buf[:n], data)
+		}
+	}
+
+	if e = c.Close(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = c.Write([]byte{0}); e != ErrReleased {
+		t.Fatalf("unexpected result: %v", e)
+	}
+}
+
+func TestSCCPConnRefused(t *testing.T) {
+	sgp, asp := pipePair(t, 2911, SUA)
+	defer sgp.Close()
+	defer asp.Close()
+
+	if _, e := asp.DialSCCP(sgp.SCCPAddr); e == nil {
+		t.Fatal("connection without listener is not refused")
+	}
+}
+
+func TestDialSCCPNoActiveASP(t *testing.T) {
+	se, _ := NewPipeSignalingEndpoint(pipeAddr(1, 2919))
+	se.Protocol = SUA
+	defer se.Close()
+
+	_, e := se.DialSCCP(SCCPAddr{PointCode: 1, SubsystemNumber: 254})
+	var we *WriteError
+	if !errors.Is(e, ErrNoActiveASP) || !errors.As(e, &we) || we.Cause != MtpFailure {
+		t.Fatalf("unexpected result: %v", e)
+	}
+}
+
+func TestSCCPConnCongestion(t *testing.T) {
+	sgp, asp := pipePair(t, 2920, SUA, func(sgp, _ *SignalingEndpoint) {
+		sgp.Dispatch.QueueDepth = 2
+	})
+	defer sgp.Close()
+	defer asp.Close()
+
+	l, e := sgp.ListenSCCP()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	accepted := make(chan *SCCPConn, 2)
+	go func() {
+		for {
+			c, e := l.Accept()
+			if e != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c, e := asp.DialSCCP(sgp.SCCPAddr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-accepted // data is never read
+	for range 10 {
+		c.Write([]byte{0})
+	}
+	if _, e = c.Read(make([]byte, 1)); e == nil ||
+		!strings.Contains(e.Error(), ReleaseEndUserCongestion.String()) {
+		t.Fatalf("unexpected result: %v", e)
+	}
+
+	// association is still available for other connections
+	c, e = asp.DialSCCP(sgp.SCCPAddr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-accepted
+	c.Close()
+}
@@ -0,0 +1,236 @@
+package xua
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnknownASP is error of control request for ASP that is not found.
+var ErrUnknownASP = errors.New("unknown ASP")
+
+// ErrASPClosed is error of request for ASP that is already closed.
+var ErrASPClosed = errors.New("ASP is closed")
+
+// ASPInfo is state and counters of ASP.
+type ASPInfo struct {
+	ID    byte
+	State Status
+	// SGP is true if the ASP is accepted in SGP mode.
+	SGP        bool
+	LocalAddr  net.Addr
+	PeerAddr   net.Addr
+	TxTransfer uint64
+	RxTransfer uint64
+	TxResponse uint64
+	RxResponse uint64
+	RTT        time.Duration
+}
+
+// ASPs returns state and counters of all ASPs of the endpoint
+// in order of ID.
+func (se *SignalingEndpoint) ASPs() []ASPInfo {
+	asps := <-se.asps
+	list := make([]ASPInfo, 0, len(asps))
+	for _, c := range asps {
+		list = append(list, ASPInfo{
+			ID:         c.id,
+			State:      c.State(),
+			SGP:        c.sgp,
+			LocalAddr:  c.LocalAddr(),
+			PeerAddr:   c.RemoteAddr(),
+			TxTransfer: atomic.LoadUint64(&c.TxTransfer),
+			RxTransfer: atomic.LoadUint64(&c.RxTransfer),
+			TxResponse: atomic.LoadUint64(&c.TxResponse),
+			RxResponse: atomic.LoadUint64(&c.RxResponse),
+			RTT:        c.RTT()})
+	}
+	se.asps <- asps
+
+	slices.SortFunc(list, func(a, b ASPInfo) int {
+		return int(a.ID) - int(b.ID)
+	})
+	return list
+}
+
+// ASPEvent is state transition of ASP.
+// Notify is status of NTFY from SG that causes the transition,
+// and it is 0 if the transition is caused by local procedure.
+// Context is routing context of the NTFY.
+type ASPEvent struct {
+	ID      byte
+	Old     Status
+	New     Status
+	Notify  Status
+	Context uint32
+}
+
+func (ev ASPEvent) String() string {
+	s := fmt.Sprintf("ASP(id=%d) %s -> %s", ev.ID, ev.Old, ev.New)
+	switch ev.Notify {
+	case 0:
+	case AlternateASPActive:
+		s = fmt.Sprintf("%s by NTFY(alternate ASP active, context=%d)", s, ev.Context)
+	default:
+		s = fmt.Sprintf("%s by NTFY(context=%d)", s, ev.Context)
+	}
+	return s
+}
+
+// transition is local state change of ASP in ASP mode.
+// It is queued to the ASP to be handled in order with other messages.
+type transition Status
+
+func (m transition) handleMessage(c *ASP) { c.transit(Status(m), 0, 0) }
+
+// transit changes state of the ASP to s and sends ASPEvent to Events.
+func (c *ASP) transit(s, ntfy Status, ctx uint32) {
+	old := c.State()
+	if old == s {
+		return
+	}
+	c.state.Store(uint32(s))
+	c.notifyState(old, s)
+
+	if c.se.Events == nil {
+		return
+	}
+	select {
+	case c.se.Events <- ASPEvent{ID: c.id, Old: old, New: s, Notify: ntfy, Context: ctx}:
+	default:
+	}
+}
+
+// controlASP returns ASP with id that is connected by ConnectTo.
+func (se *SignalingEndpoint) controlASP(id byte) (*ASP, error) {
+	asps := <-se.asps
+	defer func() { se.asps <- asps }()
+
+	for _, c := range asps {
+		if c.id != id {
+			continue
+		}
+		if c.sgp {
+			return nil, fmt.Errorf("ASP(id=%d) is accepted in SGP mode", id)
+		}
+		if c.closed || c.State() == 0 {
+			return nil, fmt.Errorf("ASP(id=%d) is not connected", id)
+		}
+		return c, nil
+	}
+	return nil, ErrUnknownASP
+}
+
+/*
+InactivateASP takes ASP with id out of traffic with ASPIA for each AS.
+The association is kept and the ASP is not activated again
+until ActivateASP.
+*/
+func (se *SignalingEndpoint) InactivateASP(id byte) error {
+	c, e := se.controlASP(id)
+	if e != nil {
+		return e
+	}
+	if c.State() == Down {
+		return fmt.Errorf("ASP(id=%d) is down", id)
+	}
+	_, e = se.inactivate(c, false)
+	return e
+}
+
+/*
+ActivateASP puts ASP with id into traffic with ASPAC for each AS.
+ASPUP is sent before ASPAC if the ASP is down by DownASP.
+*/
+func (se *SignalingEndpoint) ActivateASP(id byte) error {
+	c, e := se.controlASP(id)
+	if e != nil {
+		return e
+	}
+	if c.State() == Down {
+		r := make(chan error, 1)
+		if e = c.request(&ASPUP{result: r}, r); e != nil {
+			return e
+		}
+		c.send(transition(Inactive))
+	}
+	return se.activateASP(c)
+}
+
+/*
+DownASP moves ASP with id to ASP-DOWN with ASPDN
+without closing the association.
+Routing keys of dynamic AS are deregistered before ASPDN.
+ActivateASP brings the ASP up again.
+*/
+func (se *SignalingEndpoint) DownASP(id byte) error {
+	c, e := se.controlASP(id)
+	if e != nil {
+		return e
+	}
+	if c.State() == Down {
+		return nil
+	}
+	return se.downASP(c)
+}
+
+// activateASP sends ASPAC via ASP c for each AS in which c is not active.
+// Routing key of dynamic AS is registered before ASPAC.
+// ASP is added as standby ASP if the AS is Override mode and
+// another ASP is already active.
+func (se *SignalingEndpoint) activateASP(c *ASP) error {
+	active, activated := false, false
+	for _, as := range se.listAS() {
+		servers := <-se.servers
+		joined := slices.Contains(as.active, c) || slices.Contains(as.standby, c)
+		se.servers <- servers
+		if joined {
+			active = true
+			continue
+		}
+
+		if as.Dynamic {
+			if e := se.register(c, as); e != nil {
+				if SctpNotify != nil {
+					SctpNotify(c.id, fmt.Sprintf(
+						"failed to register AS(context=%d): %v", as.Context, e))
+				}
+				continue
+			}
+		}
+		if se.standby(c, as.Context) {
+			active = true
+			continue
+		}
+		r := make(chan error, 1)
+		if e := c.request(&ASPAC{mode: as.Mode, ctx: as.Context, result: r}, r); e != nil {
+			if SctpNotify != nil {
+				SctpNotify(c.id, fmt.Sprintf(
+					"failed to activate AS(context=%d): %v", as.Context, e))
+			}
+			continue
+		}
+		se.activate(c, as.Context)
+		active, activated = true, true
+	}
+	if activated {
+		c.send(transition(Active))
+	}
+	if !active {
+		return errors.New("no AS is activated")
+	}
+	return nil
+}
+
+// downASP deactivates and deregisters AS via ASP c, then sends ASPDN.
+func (se *SignalingEndpoint) downASP(c *ASP) error {
+	se.deactivate(c, nil)
+	se.deregister(c)
+	r := make(chan error, 1)
+	e := c.request(&ASPDN{result: r}, r)
+	c.send(transition(Down))
+	return e
+}
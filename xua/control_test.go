@@ -0,0 +1,80 @@
+package xua
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestASPControl(t *testing.T) {
+	received := make(chan []byte, 1)
+	sgp, asp := pipePair(t, 2918, SUA, func(sgp, asp *SignalingEndpoint) {
+		sgp.PayloadHandler = func(_, _ SCCPAddr, data []byte) {
+			received <- data
+		}
+		asp.Events = make(chan ASPEvent, 16)
+	})
+	defer sgp.Close()
+	defer asp.Close()
+
+	waitState := func(se *SignalingEndpoint, s Status) ASPInfo {
+		for i := 0; i < 50; i++ {
+			if l := se.ASPs(); len(l) == 1 && l[0].State == s {
+				return l[0]
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		t.Fatalf("ASP is not %s: %+v", s, se.ASPs())
+		return ASPInfo{}
+	}
+	waitEvent := func(s Status) {
+		for {
+			select {
+			case ev := <-asp.Events:
+				if ev.New == s {
+					return
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatalf("no event for %s", s)
+			}
+		}
+	}
+
+	info := waitState(asp, Active)
+	waitEvent(Active)
+	if info.SGP || info.PeerAddr == nil {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if e := asp.InactivateASP(info.ID + 1); !errors.Is(e, ErrUnknownASP) {
+		t.Fatalf("unexpected result: %v", e)
+	}
+
+	if e := asp.InactivateASP(info.ID); e != nil {
+		t.Fatal(e)
+	}
+	waitEvent(Inactive)
+	waitState(sgp, Inactive)
+	if e := asp.Write(0, SCCPAddr{PointCode: 1}, []byte{0}); !errors.Is(e, ErrNoActiveASP) {
+		t.Fatalf("unexpected result: %v", e)
+	}
+
+	if e := asp.DownASP(info.ID); e != nil {
+		t.Fatal(e)
+	}
+	waitEvent(Down)
+	waitState(sgp, Down)
+
+	if e := asp.ActivateASP(info.ID); e != nil {
+		t.Fatal(e)
+	}
+	waitEvent(Active)
+	waitState(sgp, Active)
+	if e := asp.Write(0, SCCPAddr{PointCode: 1}, []byte{1}); e != nil {
+		t.Fatal(e)
+	}
+	<-received
+
+	if info = waitState(asp, Active); info.TxTransfer != 1 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
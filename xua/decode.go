@@ -0,0 +1,100 @@
+package xua
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Unitdata is SCCP connectionless data in M3UA DATA, SUA CLDT or SUA CLDR.
+type Unitdata struct {
+	// OPC, DPC and SLS is valid only for M3UA DATA.
+	OPC PointCode
+	DPC PointCode
+	SLS uint8
+	// Context is routing context of the message.
+	Context uint32
+
+	ProtocolClass uint8
+	ReturnOnError bool
+	// Cause is return cause of UDTS, XUDTS, LUDTS or CLDR,
+	// and Success for data.
+	Cause Cause
+
+	CallingParty SCCPAddr
+	CalledParty  SCCPAddr
+	Data         []byte
+
+	// Segmented is true if Data is a segment of segmented data.
+	Segmented bool
+	// FirstSegment, RemainingSegments and SegmentRef are
+	// Segmentation parameter that is valid only if Segmented is true.
+	FirstSegment      bool
+	RemainingSegments uint8
+	SegmentRef        uint32
+}
+
+/*
+DecodeUnitdata decodes xUA message b with common header
+that is captured from network, for offline analysis.
+v is variant of SCCP in M3UA.
+*/
+func DecodeUnitdata(b []byte, v Variant) (u Unitdata, e error) {
+	if len(b) < 8 || b[0] != 1 {
+		return u, fmt.Errorf("invalid xUA message")
+	}
+	l := binary.BigEndian.Uint32(b[4:8])
+	if l < 8 || int(l) > len(b) {
+		return u, fmt.Errorf("invalid length of xUA message")
+	}
+
+	m := getRxMessage(b[2], b[3])
+	switch msg := m.(type) {
+	case *RxDATA:
+		msg.variant = v
+	case *RxCLDT, *RxCLDR:
+	default:
+		return u, fmt.Errorf("not unitdata message: %x-%x", b[2], b[3])
+	}
+
+	for r := bytes.NewReader(b[8:l]); r.Len() > 4; {
+		var t, l uint16
+		binary.Read(r, binary.BigEndian, &t)
+		binary.Read(r, binary.BigEndian, &l)
+		l -= 4
+
+		if e = m.unmarshal(t, l, r); e != nil {
+			return u, fmt.Errorf("invalid data for tag %x: %v", t, e)
+		}
+		if l%4 != 0 {
+			r.Seek(int64(4-l%4), io.SeekCurrent)
+		}
+	}
+
+	var ud userData
+	switch msg := m.(type) {
+	case *RxDATA:
+		ud = msg.userData
+		u.OPC, u.DPC, u.SLS, u.Context = msg.opc, msg.dpc, msg.sls, msg.ctx
+	case *RxCLDT:
+		ud = msg.userData
+		u.Context = msg.ctx
+	case *RxCLDR:
+		ud = msg.userData
+		u.Context = msg.ctx
+	}
+	u.ProtocolClass = ud.protocolClass
+	u.ReturnOnError = ud.returnOnError
+	u.Cause = ud.cause
+	u.CallingParty = ud.cgpa
+	u.CalledParty = ud.cdpa
+	u.Data = ud.data
+	u.Segmented = ud.segment != nil && !(ud.segment.first && ud.segment.remain == 0)
+	if u.Segmented {
+		u.FirstSegment = ud.segment.first
+		u.RemainingSegments = ud.segment.remain
+		u.SegmentRef = ud.segment.ref
+	}
+	return
+}
@@ -0,0 +1,21 @@
+package xua
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func FuzzDecodeUnitdata(f *testing.F) {
+	for _, s := range []string{
+		// M3UA DATA with SCCP address of length 0
+		"01000101000000200210eb14000000bc000000020300000009000000c8bc40cf",
+	} {
+		b, _ := hex.DecodeString(s)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, v := range []Variant{ITU, ANSI, TTC} {
+			DecodeUnitdata(b, v)
+		}
+	})
+}
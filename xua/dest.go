@@ -0,0 +1,329 @@
+package xua
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+var taudit = time.Second * 30 // Destination state audit interval
+
+// defaultImportance is importance of data without Importance.
+const defaultImportance = 4
+
+// DestinationState is state of remote destination notified by SSNM.
+type DestinationState uint8
+
+const (
+	// DestinationAvailable is notified by DAVA.
+	DestinationAvailable DestinationState = iota
+	// DestinationRestricted is notified by DRST.
+	DestinationRestricted
+	// DestinationUnavailable is notified by DUNA.
+	DestinationUnavailable
+	// DestinationUserPartUnavailable is notified by DUPU for SCCP.
+	DestinationUserPartUnavailable
+)
+
+func (s DestinationState) String() string {
+	switch s {
+	case DestinationAvailable:
+		return "available"
+	case DestinationRestricted:
+		return "restricted"
+	case DestinationUnavailable:
+		return "unavailable"
+	case DestinationUserPartUnavailable:
+		return "user part unavailable"
+	}
+	return ""
+}
+
+/*
+Destination is state of remote destination with affected point code.
+Data to unavailable destination is returned with MTP failure
+without sending.
+Congestion is level of congestion notified by SCON.
+Data whose priority is lower than Congestion is returned
+with network congestion without sending.
+Priority of data is Importance/2, or 2 if Importance is not specified.
+
+DAUD is sent periodically while the destination is not available
+or congested, then the state is updated with the answer of SGP.
+*/
+type Destination struct {
+	PointCode  AffectedPointCode
+	State      DestinationState
+	Congestion uint32
+}
+
+func (d Destination) String() string {
+	if d.Congestion != 0 {
+		return fmt.Sprintf("%s %s (congestion level=%d)",
+			d.PointCode, d.State, d.Congestion)
+	}
+	return fmt.Sprintf("%s %s", d.PointCode, d.State)
+}
+
+func (d Destination) normal() bool {
+	return d.State == DestinationAvailable && d.Congestion == 0
+}
+
+func (d Destination) reachable() bool {
+	return d.State == DestinationAvailable || d.State == DestinationRestricted
+}
+
+// destinationOf returns state of pc in list.
+// Entry with the narrowest mask that covers pc is used.
+func destinationOf(list []Destination, pc PointCode) Destination {
+	d := Destination{PointCode: AffectedPointCode{pc: pc}}
+	found := false
+	for _, e := range list {
+		if e.PointCode.covers(pc) && (!found || e.PointCode.mask < d.PointCode.mask) {
+			d, found = e, true
+		}
+	}
+	return d
+}
+
+// Destinations returns remote destinations that are not available
+// or congested.
+func (se *SignalingEndpoint) Destinations() []Destination {
+	list := <-se.destinations
+	se.destinations <- list
+	return append([]Destination{}, list...)
+}
+
+// DestinationOf returns state of remote destination with point code pc.
+func (se *SignalingEndpoint) DestinationOf(pc PointCode) Destination {
+	list := <-se.destinations
+	se.destinations <- list
+	return destinationOf(list, pc)
+}
+
+/*
+SetDestination updates state of remote destination with point code pc.
+In SGP, DUNA, DAVA, DRST, DUPU or SCON is sent to all active ASPs.
+*/
+func (se *SignalingEndpoint) SetDestination(
+	pc PointCode, state DestinationState, congestion uint32) {
+	apc := []AffectedPointCode{{pc: pc}}
+	se.updateDestination(apc, func(d *Destination) {
+		d.State = state
+		d.Congestion = congestion
+	})
+	if !se.sgp {
+		return
+	}
+
+	var targets []*ASP
+	asps := <-se.asps
+	for _, c := range asps {
+		if c.sgp && c.State() == Active {
+			targets = append(targets, c)
+		}
+	}
+	se.asps <- asps
+
+	d := Destination{PointCode: apc[0], State: state, Congestion: congestion}
+	for _, c := range targets {
+		for _, m := range ssnmOf(d, se.Protocol == SUA) {
+			c.enqueue(m)
+		}
+	}
+}
+
+// updateDestination updates state of destinations with affected point codes.
+// Audit of destination is started if the destination becomes abnormal.
+func (se *SignalingEndpoint) updateDestination(
+	apc []AffectedPointCode, f func(*Destination)) {
+	var audit []AffectedPointCode
+	var changed []Destination
+
+	list := <-se.destinations
+	for _, p := range apc {
+		old := destinationOf(list, p.pc)
+		d := old
+		d.PointCode = p
+		f(&d)
+
+		for i := 0; i < len(list); {
+			if p.mask >= list[i].PointCode.mask && p.covers(list[i].PointCode.pc) {
+				list = append(list[:i], list[i+1:]...)
+			} else {
+				i++
+			}
+		}
+		if parent := destinationOf(list, p.pc); d.State != parent.State ||
+			d.Congestion != parent.Congestion {
+			list = append(list, d)
+		}
+
+		if d.State != old.State || d.Congestion != old.Congestion {
+			changed = append(changed, d)
+		}
+		if !d.normal() && old.normal() {
+			audit = append(audit, p)
+		}
+	}
+	se.destinations <- list
+
+	if DestinationNotify != nil {
+		for _, d := range changed {
+			DestinationNotify(d)
+		}
+	}
+	if se.sgp {
+		return
+	}
+	for _, p := range audit {
+		go se.auditDestination(p)
+	}
+}
+
+// isAvailable returns false if pc is unavailable by DUNA or DUPU
+// or subsystem is prohibited by SSP.
+func (se *SignalingEndpoint) isAvailable(
+	pc PointCode, ssn teldata.SubsystemNumber) bool {
+	if !se.DestinationOf(pc).reachable() {
+		return false
+	}
+	if ssn == 0 {
+		return true
+	}
+	ss := <-se.prohibited
+	se.prohibited <- ss
+	_, prohibited := ss[Subsystem{PointCode: pc, SubsystemNumber: ssn}]
+	return !prohibited
+}
+
+// checkDestination returns cause for data that must not be sent to pc.
+func (se *SignalingEndpoint) checkDestination(pc PointCode, importance *uint8) Cause {
+	if pc == 0 {
+		return Success
+	}
+	d := se.DestinationOf(pc)
+	if !d.reachable() {
+		return MtpFailure
+	}
+	prio := uint32(defaultImportance / 2)
+	if importance != nil {
+		prio = uint32(*importance&0x07) / 2
+	}
+	if prio < d.Congestion {
+		return NetworkCongestion
+	}
+	return Success
+}
+
+// auditDestination sends DAUD to SGP periodically
+// until the destination becomes available and not congested.
+func (se *SignalingEndpoint) auditDestination(p AffectedPointCode) {
+	for {
+		select {
+		case <-se.block:
+			return
+		case <-time.After(taudit):
+		}
+
+		d := se.DestinationOf(p.pc)
+		if d.normal() {
+			return
+		}
+		if DaudNotify != nil {
+			DaudNotify([]AffectedPointCode{p})
+		}
+		for _, as := range se.listAS() {
+			if _, asps := se.selectASP(as.Context, 0); len(asps) != 0 {
+				m := &TxDAUD{ctx: as.Context, apc: []AffectedPointCode{p},
+					sua: se.Protocol == SUA}
+				if d.State == DestinationUserPartUnavailable {
+					m.user = 3
+				}
+				asps[0].send(m)
+			}
+		}
+	}
+}
+
+// handleDAUD answers state of audited destinations to ASP.
+// Destination with point code of AS is available
+// only while the AS is active.
+func (se *SignalingEndpoint) handleDAUD(c *ASP, m *RxDAUD) {
+	if !c.sgp {
+		c.write(&TxERR{code: UnexpectedMessage, ctx: m.ctx})
+		return
+	}
+	for _, p := range m.apc {
+		d := se.DestinationOf(p.pc)
+		d.PointCode = p
+		servers := <-se.servers
+		for _, as := range servers {
+			if as.PointCode != 0 && p.covers(as.PointCode) {
+				if as.state == Active {
+					d.State = DestinationAvailable
+				} else {
+					d.State = DestinationUnavailable
+				}
+			}
+		}
+		se.servers <- servers
+		for _, r := range ssnmOf(d, se.Protocol == SUA) {
+			c.write(r)
+		}
+	}
+}
+
+// notifyDestination sends DAVA or DUNA for point code of as
+// to active ASPs that are not serving the AS.
+// It is called while se.servers is held, and messages are queued
+// to the ASPs so that they are written by the serve goroutine.
+func (se *SignalingEndpoint) notifyDestination(as *AS) {
+	if as.PointCode == 0 || as.state == Pending {
+		return
+	}
+	d := Destination{PointCode: AffectedPointCode{pc: as.PointCode}}
+	if as.state != Active {
+		d.State = DestinationUnavailable
+	}
+	serving := make(map[*ASP]bool, len(as.active))
+	for _, a := range as.active {
+		serving[a] = true
+	}
+
+	var targets []*ASP
+	asps := <-se.asps
+	for _, c := range asps {
+		if c.sgp && c.State() == Active && !serving[c] {
+			targets = append(targets, c)
+		}
+	}
+	se.asps <- asps
+
+	for _, c := range targets {
+		for _, m := range ssnmOf(d, se.Protocol == SUA) {
+			c.enqueue(m)
+		}
+	}
+}
+
+// ssnmOf returns SSNM messages of M3UA or SUA that notify state of d.
+func ssnmOf(d Destination, sua bool) []txMessage {
+	apc := []AffectedPointCode{d.PointCode}
+	var ret []txMessage
+	switch d.State {
+	case DestinationAvailable:
+		ret = append(ret, &TxDAVA{apc: apc, sua: sua})
+	case DestinationRestricted:
+		ret = append(ret, &TxDRST{apc: apc, sua: sua})
+	case DestinationUnavailable:
+		return []txMessage{&TxDUNA{apc: apc, sua: sua}}
+	case DestinationUserPartUnavailable:
+		return []txMessage{&TxDUPU{apc: apc, user: 3, sua: sua}}
+	}
+	if d.Congestion != 0 {
+		ret = append(ret, &TxSCON{apc: apc, congestion: d.Congestion, sua: sua})
+	}
+	return ret
+}
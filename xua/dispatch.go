@@ -0,0 +1,269 @@
+package xua
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWorkers    = 128
+	defaultQueueDepth = 1024
+)
+
+// OverflowPolicy is behavior of the endpoint when a queue is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock waits until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the new data.
+	OverflowDropNewest
+	// OverflowReturnError discards the new data and reports error.
+	// Write returns WriteError with ErrQueueFull for sent data.
+	// Received data is returned to the sender with SubsystemCongestion
+	// if return on error is requested.
+	OverflowReturnError
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowReturnError:
+		return "return-error"
+	}
+	return ""
+}
+
+// ErrQueueFull is error of data that is discarded because the queue is full.
+var ErrQueueFull = errors.New("queue is full")
+
+/*
+DispatchOptions is parameters of queues of the endpoint.
+Received data is queued to one of Workers goroutines by its key,
+so data with same key is handled in order.
+Transmit queue of each ASP also has QueueDepth.
+*/
+type DispatchOptions struct {
+	// Workers is number of goroutines that call handlers.
+	// Default value 128 is used if 0.
+	Workers int
+	// QueueDepth is capacity of queue of each worker and each ASP.
+	// Default value 1024 is used if 0.
+	QueueDepth int
+	// Overflow is policy when a queue is full.
+	Overflow OverflowPolicy
+	// Key returns dispatch key of received data.
+	// SLS of the data is used if nil.
+	// tcap.TransactionKey dispatches data by TCAP transaction.
+	Key func(cgpa SCCPAddr, data []byte) uint32
+}
+
+// dispatchOptions returns dispatch parameters with default values.
+func (se *SignalingEndpoint) dispatchOptions() DispatchOptions {
+	o := se.Dispatch
+	if o.Workers <= 0 {
+		o.Workers = defaultWorkers
+	}
+	if o.QueueDepth <= 0 {
+		o.QueueDepth = defaultQueueDepth
+	}
+	return o
+}
+
+// QueueStats is depth metrics of a queue of the endpoint.
+type QueueStats struct {
+	// Name is "rx/<n>" for queue of worker n
+	// and "tx/<id>" for transmit queue of ASP.
+	Name     string
+	Length   int
+	Capacity int
+	// Peak is the maximum length after queueing.
+	Peak int
+	// Dropped is number of data that is discarded by overflow policy.
+	Dropped uint64
+}
+
+type queueCounter struct {
+	peak    atomic.Int64
+	dropped atomic.Uint64
+}
+
+func (q *queueCounter) observe(l int) {
+	for p := q.peak.Load(); int64(l) > p; p = q.peak.Load() {
+		if q.peak.CompareAndSwap(p, int64(l)) {
+			return
+		}
+	}
+}
+
+func (q *queueCounter) stats(name string, l, c int) QueueStats {
+	return QueueStats{
+		Name:     name,
+		Length:   l,
+		Capacity: c,
+		Peak:     int(q.peak.Load()),
+		Dropped:  q.dropped.Load()}
+}
+
+// dispatcher is set of workers that handle received data.
+type dispatcher struct {
+	queues   []chan userData
+	counters []queueCounter
+	done     sync.WaitGroup
+}
+
+// dispatcher returns dispatcher of the endpoint.
+// Workers are started at the first call.
+func (se *SignalingEndpoint) dispatcher() *dispatcher {
+	d := <-se.workers
+	defer func() { se.workers <- d }()
+	if d != nil {
+		return d
+	}
+
+	o := se.dispatchOptions()
+	d = &dispatcher{
+		queues:   make([]chan userData, o.Workers),
+		counters: make([]queueCounter, o.Workers)}
+	for i := range d.queues {
+		q := make(chan userData, o.QueueDepth)
+		d.queues[i] = q
+		d.done.Add(1)
+		go func() {
+			defer d.done.Done()
+			for req, ok := <-q; ok; req, ok = <-q {
+				se.handle(req)
+			}
+		}()
+	}
+	return d
+}
+
+// dispatch queues received data to worker for the key of the data.
+func (se *SignalingEndpoint) dispatch(ud userData) {
+	d := se.dispatcher()
+	key := ud.sls
+	if se.Dispatch.Key != nil {
+		key = se.Dispatch.Key(ud.cgpa, ud.data)
+	}
+	i := key % uint32(len(d.queues))
+	q, cnt := d.queues[i], &d.counters[i]
+
+	if se.Dispatch.Overflow == OverflowBlock {
+		q <- ud
+	} else {
+		select {
+		case q <- ud:
+		default:
+			cnt.dropped.Add(1)
+			if se.Dispatch.Overflow == OverflowDropNewest {
+			} else if ud.cause == Success {
+				se.returnData(SubsystemCongestion, ud)
+			} else if RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf("queue of worker %d is full", i), ud.data)
+			}
+			return
+		}
+	}
+	cnt.observe(len(q))
+}
+
+// closeDispatcher stops workers after queued data is handled,
+// and waits until handlers of all workers return.
+func (se *SignalingEndpoint) closeDispatcher() {
+	d := <-se.workers
+	if d != nil {
+		for _, q := range d.queues {
+			close(q)
+		}
+	}
+	se.workers <- d
+	if d != nil {
+		d.done.Wait()
+	}
+}
+
+// queued returns number of data in receive and transmit queues.
+func (se *SignalingEndpoint) queued() (n int) {
+	d := <-se.workers
+	if d != nil {
+		for _, q := range d.queues {
+			n += len(q)
+		}
+	}
+	se.workers <- d
+
+	asps := <-se.asps
+	for _, c := range asps {
+		n += len(c.msgQ)
+	}
+	se.asps <- asps
+	return
+}
+
+// enqueue queues user data message m to transmit queue of the ASP
+// with overflow policy of the endpoint.
+// ErrNoActiveASP is returned if the ASP is already closed.
+func (c *ASP) enqueue(m message) error {
+	switch {
+	case c.se.Dispatch.Overflow != OverflowBlock:
+		select {
+		case <-c.done:
+			return ErrNoActiveASP
+		default:
+		}
+		select {
+		case c.msgQ <- m:
+		default:
+			c.txQueue.dropped.Add(1)
+			if c.se.Dispatch.Overflow == OverflowDropNewest {
+				return nil
+			}
+			return ErrQueueFull
+		}
+	case c.se.WriteTimeout > 0:
+		t := time.NewTimer(c.se.WriteTimeout)
+		defer t.Stop()
+		select {
+		case c.msgQ <- m:
+		case <-c.done:
+			return ErrNoActiveASP
+		case <-t.C:
+			c.txQueue.dropped.Add(1)
+			return ErrQueueFull
+		}
+	default:
+		if !c.send(m) {
+			return ErrNoActiveASP
+		}
+	}
+	c.txQueue.observe(len(c.msgQ))
+	return nil
+}
+
+// QueueStats returns depth metrics of receive queue of each worker
+// and transmit queue of each ASP.
+func (se *SignalingEndpoint) QueueStats() []QueueStats {
+	stats := []QueueStats{}
+	d := se.dispatcher()
+	for i, q := range d.queues {
+		stats = append(stats, d.counters[i].stats(
+			fmt.Sprintf("rx/%d", i), len(q), cap(q)))
+	}
+
+	asps := <-se.asps
+	for _, c := range asps {
+		if c.txQueue != nil {
+			stats = append(stats, c.txQueue.stats(
+				fmt.Sprintf("tx/%d", c.id), len(c.msgQ), cap(c.msgQ)))
+		}
+	}
+	se.asps <- asps
+	return stats
+}
@@ -0,0 +1,93 @@
+package xua
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDispatchOrder(t *testing.T) {
+	se, _ := NewPipeSignalingEndpoint(pipeAddr(1, 2913))
+	se.Dispatch = DispatchOptions{
+		Workers:    4,
+		QueueDepth: 8,
+		Key:        func(_ SCCPAddr, data []byte) uint32 { return uint32(data[0]) }}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	last := map[byte]int{}
+	se.PayloadHandler = func(_, _ SCCPAddr, data []byte) {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		seq := int(data[1])<<8 | int(data[2])
+		if p, ok := last[data[0]]; ok && p+1 != seq {
+			t.Errorf("key %d: %d is handled after %d", data[0], seq, p)
+		}
+		last[data[0]] = seq
+	}
+
+	for i := range 1000 {
+		wg.Add(1)
+		se.dispatch(userData{data: []byte{byte(i % 7), byte(i / 7 >> 8), byte(i / 7)}})
+	}
+	wg.Wait()
+	se.closeDispatcher()
+
+	stats := se.QueueStats()
+	if len(stats) != 4 || stats[0].Capacity != 8 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDispatchDropNewest(t *testing.T) {
+	se, _ := NewPipeSignalingEndpoint(pipeAddr(1, 2914))
+	se.Dispatch = DispatchOptions{
+		Workers:    1,
+		QueueDepth: 2,
+		Overflow:   OverflowDropNewest}
+
+	block := make(chan any)
+	handled := make(chan any, 10)
+	se.PayloadHandler = func(_, _ SCCPAddr, _ []byte) {
+		<-block
+		handled <- nil
+	}
+
+	for range 10 {
+		se.dispatch(userData{data: []byte{0}})
+	}
+	close(block)
+
+	stats := se.QueueStats()
+	se.closeDispatcher()
+	if stats[0].Dropped < 7 || stats[0].Peak != 2 {
+		t.Fatalf("unexpected stats %+v", stats[0])
+	}
+	for range 10 - stats[0].Dropped {
+		<-handled
+	}
+}
+
+func TestEnqueueClosedASP(t *testing.T) {
+	se, _ := NewPipeSignalingEndpoint(pipeAddr(1, 2915))
+	c := &ASP{
+		se:      se,
+		msgQ:    make(chan message, 1),
+		done:    make(chan any),
+		txQueue: &queueCounter{}}
+	close(c.done)
+
+	for _, o := range []OverflowPolicy{OverflowBlock, OverflowDropNewest} {
+		se.Dispatch.Overflow = o
+		if e := c.enqueue(transition(Active)); e != ErrNoActiveASP {
+			t.Fatalf("unexpected result: %v", e)
+		}
+	}
+	r := make(chan error, 1)
+	if e := c.request(&ASPUP{result: r}, r); e != ErrASPClosed {
+		t.Fatalf("unexpected result: %v", e)
+	}
+	if len(c.msgQ) != 0 {
+		t.Fatalf("message is queued to closed ASP")
+	}
+}
@@ -0,0 +1,107 @@
+package xua
+
+import "time"
+
+// DrainPhase is progress of Drain.
+type DrainPhase uint8
+
+const (
+	// DrainInactive is reported after ASPIA is sent via all ASPs.
+	DrainInactive DrainPhase = iota
+	// DrainWaiting is reported when number of pending work is changed.
+	DrainWaiting
+	// DrainClosing is reported before ASPDN is sent and the endpoint is closed.
+	DrainClosing
+	// DrainClosed is reported after the endpoint is closed.
+	DrainClosed
+)
+
+func (p DrainPhase) String() string {
+	switch p {
+	case DrainInactive:
+		return "inactive"
+	case DrainWaiting:
+		return "waiting"
+	case DrainClosing:
+		return "closing"
+	case DrainClosed:
+		return "closed"
+	}
+	return ""
+}
+
+// DrainStats is result of Drain.
+type DrainStats struct {
+	// Inactivated is number of AS that is inactivated by ASPIA of each ASP.
+	Inactivated int
+	// Pending is number of work that is not finished at the deadline.
+	// It is 0 if all work is finished before the deadline.
+	Pending int
+	// Elapsed is time from the start of Drain to closing.
+	Elapsed time.Duration
+}
+
+/*
+Drain closes the endpoint gracefully.
+ASPIA is sent for each active AS via each ASP first,
+so that the SG shifts traffic to other ASPs.
+The ASPs are kept as draining ASPs and data of open transactions
+is sent via them while no other ASP is active.
+Then Drain waits until pending returns 0 and all queues are empty,
+or until timeout. abort is called if work is still pending at the timeout,
+so that the user can abort the work via the draining ASPs.
+ASPDN is sent and the endpoint is closed after that.
+pending returns number of work of the user, such as open transactions,
+and pending and abort may be nil.
+Progress is reported with DrainNotify.
+*/
+func (se *SignalingEndpoint) Drain(timeout time.Duration, pending func() int, abort func()) (s DrainStats) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	asps := <-se.asps
+	list := make([]*ASP, 0, len(asps))
+	for _, c := range asps {
+		if !c.sgp {
+			list = append(list, c)
+		}
+	}
+	se.asps <- asps
+	for _, c := range list {
+		n, _ := se.inactivate(c, true)
+		s.Inactivated += n
+	}
+	notifyDrain(DrainInactive, 0)
+
+	last := -1
+	for {
+		s.Pending = se.queued()
+		if pending != nil {
+			s.Pending += pending()
+		}
+		if s.Pending != last {
+			notifyDrain(DrainWaiting, s.Pending)
+			last = s.Pending
+		}
+		if s.Pending == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if s.Pending != 0 && abort != nil {
+		// data of abort is queued before ASPDN
+		abort()
+	}
+	s.Elapsed = time.Since(start)
+	notifyDrain(DrainClosing, s.Pending)
+	se.Close()
+	notifyDrain(DrainClosed, s.Pending)
+	return
+}
+
+func notifyDrain(p DrainPhase, pending int) {
+	if DrainNotify != nil {
+		DrainNotify(p, pending)
+	}
+}
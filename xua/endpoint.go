@@ -1,14 +1,19 @@
 package xua
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"time"
+
+	"github.com/fkgi/teldata"
 )
 
 const (
-	minWorkers = 128
-	maxWorkers = 65535 - minWorkers
+	defaultHeartbeatMisses = 3
+
+	// maxSUAData is maximum length of Data parameter of SUA.
+	maxSUAData = 0xffff - 4
 )
 
 type userData struct {
@@ -18,6 +23,17 @@ type userData struct {
 	cgpa          SCCPAddr
 	cdpa          SCCPAddr
 	data          []byte
+
+	// opc is originating point code of received M3UA DATA
+	opc PointCode
+	// rc is routing context of sent or received data
+	rc uint32
+	// sls is SLS of sent or received data
+	sls uint32
+
+	hopCount   uint8
+	importance *uint8
+	segment    *segmentation
 }
 
 var id = make(chan byte, 1)
@@ -31,157 +47,362 @@ func nextID() byte {
 	return i
 }
 
+// Protocol is user adaptation layer protocol of the endpoint.
+type Protocol uint8
+
+const (
+	M3UA Protocol = iota
+	SUA
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case M3UA:
+		return "M3UA"
+	case SUA:
+		return "SUA"
+	}
+	return ""
+}
+
 type SignalingEndpoint struct {
-	sock    int
-	asps    chan map[int]*ASP
+	tp      transport
+	asps    chan map[association]*ASP
+	peers   chan map[string]*peer
 	block   chan any
-	sharedQ chan userData
+	workers chan *dispatcher
+
+	segments chan map[string]*reassembly
+	segRef   chan uint32
+	sequence chan uint32
+
+	conns    chan map[uint32]*SCCPConn
+	coRef    chan uint32
+	listener chan *SCCPListener
+
+	destinations chan []Destination
+	prohibited   chan map[Subsystem]struct{}
+
+	sgp     bool
+	servers chan map[uint32]*AS
 
 	PayloadHandler func(SCCPAddr, SCCPAddr, []byte)
-	NetIndicator   uint8
-	NetAppearance  *uint32
-	Context        uint32
-	PointCode      uint32
+	// NoticeHandler is called with returned data
+	// when UDTS, XUDTS, LUDTS or CLDR is received.
+	NoticeHandler func(Cause, SCCPAddr, SCCPAddr, []byte)
+	Protocol      Protocol
+	NetIndicator  uint8
+	NetAppearance *uint32
+	Context       uint32
+	PointCode     PointCode
 	SCCPAddr
+	// Variant is format of SCCP address for M3UA.
+	Variant       Variant
 	ReturnOnError bool
+
+	// Router translates called party GT to DPC and called party address.
+	// Specified dpc and cdpa is used if Router is nil or no rule matches.
+	Router *Router
+
+	// SegmentSize is maximum size of data in one UDT/XUDT.
+	// Larger data is segmented to XUDTs. Default size is used if 0.
+	// It is reduced to size that fits in one XUDT with the addresses.
+	SegmentSize int
+	// HopCounter and Importance is set to XUDT.
+	// XUDT is used instead of UDT if any of them is specified.
+	HopCounter uint8
+	Importance *uint8
+	// LongData enables LUDT for data that is larger than SegmentSize.
+	LongData bool
+	// ProtocolClass is SCCP protocol class of connection by DialSCCP,
+	// 2 or 3. Protocol class 2 is used if 0.
+	ProtocolClass uint8
+
+	// HeartbeatInterval is interval of BEAT. BEAT is not sent if 0.
+	// BEAT from peer is always answered.
+	HeartbeatInterval time.Duration
+	// HeartbeatMisses is number of unanswered BEAT to abort the association.
+	// Default value 3 is used if 0.
+	HeartbeatMisses int
+
+	// Retry is policy of reconnection to SGP.
+	Retry RetryPolicy
+	// SCTP is parameters of SCTP association.
+	SCTP SCTPOptions
+	// WriteTimeout is maximum time of Write to wait for active ASP
+	// and for room of the queue with OverflowBlock policy.
+	// Write fails immediately without active ASP
+	// and waits room of the queue without limit if 0.
+	WriteTimeout time.Duration
+	// Dispatch is parameters of worker and queues.
+	// It must be set before the first data is sent or received.
+	Dispatch DispatchOptions
+	// Events receives state transitions of ASPs, including transitions
+	// by NTFY from SG. Event is discarded if the channel is full.
+	Events chan ASPEvent
 }
 
-func NewSignalingEndpoint(a *SCTPAddr) (se *SignalingEndpoint, e error) {
-	se = &SignalingEndpoint{}
-	if a == nil || len(a.IP) == 0 {
-		e = fmt.Errorf("nil address")
-	} else if a.IP[0].To4() == nil {
-		e = fmt.Errorf("invalid address")
-	} else if se.sock, e = sockOpen(); e != nil {
-	} else if e = sctpBindx(se.sock, a.rawBytes()); e != nil {
-		sockClose(se.sock)
+// sctpOptions returns SCTP parameters with default values.
+func (se *SignalingEndpoint) sctpOptions() SCTPOptions {
+	o := se.SCTP
+	if o.OutStreams == 0 {
+		o.OutStreams = defaultOutStreams
 	}
-	if e != nil {
-		return
+	if o.PPID != 0 {
+	} else if se.Protocol == SUA {
+		o.PPID = 4
+	} else {
+		o.PPID = 3
 	}
+	return o
+}
 
-	se.asps = make(chan map[int]*ASP, 1)
-	se.asps <- map[int]*ASP{}
-	se.block = make(chan any)
-	se.sharedQ = make(chan userData, maxWorkers)
+// peer is SGP that is connected by ConnectTo.
+type peer struct {
+	addr *SCTPAddr
+	stop chan any
+	asp  *ASP
+}
 
-	activeWorkers := make(chan int, 1)
-	activeWorkers <- 0
+// NewSignalingEndpoint returns SignalingEndpoint on kernel SCTP
+// that is bound to a.
+func NewSignalingEndpoint(a *SCTPAddr) (*SignalingEndpoint, error) {
+	if a == nil || len(a.IP) == 0 {
+		return nil, fmt.Errorf("nil address")
+	} else if len(a.rawBytes()) == 0 {
+		return nil, fmt.Errorf("invalid address")
+	}
+	tp, e := newSCTPTransport(a)
+	if e != nil {
+		return nil, e
+	}
+	return newSignalingEndpoint(tp), nil
+}
 
-	worker := func() {
-		for c := 0; c < 500; {
-			if len(se.sharedQ) < minWorkers {
-				time.Sleep(time.Millisecond * 10)
-				c++
-				continue
-			}
-			if req, ok := <-se.sharedQ; !ok {
-				break
-			} else if se.PayloadHandler != nil {
-				se.PayloadHandler(req.cgpa, req.cdpa, req.data)
-				/*
-					} else if req.returnOnError {
-						se.selectASP().msgQ <- &TxDATA{
-							ctx: se.Context,
-							userData: userData{
-								cause: SubsystemFailure,
-								cgpa:  se.SCCPAddr, cdpa: req.cgpa,
-								data: req.data}}
-				*/
-			}
-			c = 0
-		}
-		activeWorkers <- (<-activeWorkers - 1)
-	}
-
-	for range minWorkers {
-		go func() {
-			for req, ok := <-se.sharedQ; ok; req, ok = <-se.sharedQ {
-				a := <-activeWorkers
-				activeWorkers <- a
-				if len(se.sharedQ) > minWorkers && a < maxWorkers {
-					activeWorkers <- (<-activeWorkers + 1)
-					go worker()
-				} else if se.PayloadHandler != nil {
-					se.PayloadHandler(req.cgpa, req.cdpa, req.data)
-					/*
-						} else if req.returnOnError {
-							se.selectASP().msgQ <- &TxDATA{
-								ctx: se.Context,
-								userData: userData{
-									cause: SubsystemFailure,
-									cgpa:  se.SCCPAddr, cdpa: req.cgpa,
-									data: req.data}}
-					*/
-				}
-			}
-		}()
+// NewPipeSignalingEndpoint returns SignalingEndpoint on in-process pipe
+// with address a. It can connect to other pipe SignalingEndpoint
+// in same process without kernel SCTP, for testing.
+func NewPipeSignalingEndpoint(a *SCTPAddr) (*SignalingEndpoint, error) {
+	if a == nil {
+		return nil, fmt.Errorf("nil address")
 	}
-	return
+	return newSignalingEndpoint(&pipeTransport{
+		addr: a, done: make(chan any)}), nil
 }
 
-/*
-func (se *SignalingEndpoint) Listen() (e error) {
-	if e = sockListen(se.sock); e != nil {
-		sockClose(se.sock)
+// NewTCPSignalingEndpoint returns SignalingEndpoint on TCP
+// with the first IP address and port of a, for lab use.
+// Stream ID is sent in frame header of each message.
+func NewTCPSignalingEndpoint(a *SCTPAddr) (*SignalingEndpoint, error) {
+	if a == nil {
+		return nil, fmt.Errorf("nil address")
 	}
+	return newSignalingEndpoint(&tcpTransport{addr: a}), nil
+}
+
+func newSignalingEndpoint(tp transport) (se *SignalingEndpoint) {
+	se = &SignalingEndpoint{tp: tp}
+	se.asps = make(chan map[association]*ASP, 1)
+	se.asps <- map[association]*ASP{}
+	se.peers = make(chan map[string]*peer, 1)
+	se.peers <- map[string]*peer{}
+	se.block = make(chan any)
+	se.workers = make(chan *dispatcher, 1)
+	se.workers <- nil
+	se.segments = make(chan map[string]*reassembly, 1)
+	se.segments <- map[string]*reassembly{}
+	se.segRef = make(chan uint32, 1)
+	se.segRef <- uint32(time.Now().UnixMicro())
+	se.sequence = make(chan uint32, 1)
+	se.sequence <- 0
+	se.conns = make(chan map[uint32]*SCCPConn, 1)
+	se.conns <- map[uint32]*SCCPConn{}
+	se.coRef = make(chan uint32, 1)
+	se.coRef <- uint32(time.Now().UnixMicro())
+	se.listener = make(chan *SCCPListener, 1)
+	se.listener <- nil
+	se.destinations = make(chan []Destination, 1)
+	se.destinations <- []Destination{}
+	se.prohibited = make(chan map[Subsystem]struct{}, 1)
+	se.prohibited <- map[Subsystem]struct{}{}
+	se.servers = make(chan map[uint32]*AS, 1)
+	se.servers <- map[uint32]*AS{}
 	return
 }
-*/
 
+/*
+ConnectTo starts connecting to SGP with address a in ASP mode.
+Connection is retried with Retry policy while it is failed or lost,
+until Disconnect or Close is called.
+Peers can be added by ConnectTo and removed by Disconnect at runtime.
+*/
 func (se *SignalingEndpoint) ConnectTo(a *SCTPAddr) error {
 	if a == nil || len(a.IP) == 0 {
 		return fmt.Errorf("nil address")
-	} else if a.IP[0].To4() == nil {
+	} else if len(a.rawBytes()) == 0 {
 		return fmt.Errorf("invalid address")
 	}
 
+	p := &peer{addr: a, stop: make(chan any)}
+	peers := <-se.peers
+	if _, ok := peers[a.String()]; ok {
+		se.peers <- peers
+		return fmt.Errorf("already connected to %s", a)
+	}
+	peers[a.String()] = p
+	se.peers <- peers
+	se.defaultAS()
+
 	go func() {
-	svc:
-		for {
+		defer func() {
+			peers := <-se.peers
+			if peers[a.String()] == p {
+				delete(peers, a.String())
+			}
+			se.peers <- peers
+		}()
+
+		for n := 0; ; {
 			i := nextID()
 			if SctpNotify != nil {
 				SctpNotify(i, fmt.Sprintf("connecting to %s", a.String()))
 			}
-			if s, e := sctpConnectx(se.sock, a.rawBytes()); e == nil {
-				asps := <-se.asps
-				asps[s] = &ASP{id: i, sock: s}
-				se.asps <- asps
+			notifyAssociation(AssociationEvent{
+				Type: AssociationConnecting, ID: i, PeerAddr: a})
 
-				asps[s].connectAndServe(se.Context, se.sharedQ)
+			if s, e := se.tp.dial(a, se.sctpOptions()); e == nil {
+				n = 0
+				s = newCapturedAssociation(s, se.sctpOptions().PPID)
+				c := &ASP{id: i, conn: s}
+				notifyAssociation(c.event(AssociationEstablished, nil))
 
-				asps = <-se.asps
-				delete(asps, s)
+				asps := <-se.asps
+				asps[s] = c
 				se.asps <- asps
-				sockClose(s)
+				peers := <-se.peers
+				p.asp = c
+				stopped := false
+				select {
+				case <-p.stop:
+					stopped = true
+				default:
+				}
+				se.peers <- peers
+				if stopped {
+					// Disconnect is called while dialing
+					c.closed = true
+					se.release(c)
+					return
+				}
+
+				c.connectAndServe(se)
 
+				peers = <-se.peers
+				p.asp = nil
+				se.peers <- peers
+				se.release(c)
+			} else {
+				n++
 				if SctpNotify != nil {
-					SctpNotify(i, "closed")
+					SctpNotify(i, "failed to connect: "+e.Error())
+				}
+				notifyAssociation(AssociationEvent{
+					Type: AssociationLost, ID: i, PeerAddr: a, Err: e})
+				if se.Retry.MaxAttempts > 0 && n >= se.Retry.MaxAttempts {
+					if SctpNotify != nil {
+						SctpNotify(i, fmt.Sprintf(
+							"gave up connecting to %s after %d attempts", a, n))
+					}
+					return
 				}
-			} else if SctpNotify != nil {
-				SctpNotify(i, "failed to connect: "+e.Error())
 			}
 
 			select {
 			case <-se.block:
-				break svc
-			case <-time.After(time.Second * 30):
+				return
+			case <-p.stop:
+				return
+			case <-time.After(se.Retry.delay(n)):
 			}
 		}
 	}()
 	return nil
 }
 
+// Disconnect stops connecting to SGP with address a
+// and closes the association to the SGP after ASPDN.
+func (se *SignalingEndpoint) Disconnect(a *SCTPAddr) error {
+	if a == nil {
+		return fmt.Errorf("nil address")
+	}
+	peers := <-se.peers
+	p, ok := peers[a.String()]
+	var c *ASP
+	if ok {
+		delete(peers, a.String())
+		c = p.asp
+		close(p.stop)
+	}
+	se.peers <- peers
+	if !ok {
+		return fmt.Errorf("not connected to %s", a)
+	}
+
+	if c != nil {
+		se.shutdown(c)
+	}
+	return nil
+}
+
+// Peers returns addresses of SGPs that are connected by ConnectTo.
+func (se *SignalingEndpoint) Peers() []*SCTPAddr {
+	peers := <-se.peers
+	defer func() { se.peers <- peers }()
+
+	list := make([]*SCTPAddr, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, p.addr)
+	}
+	return list
+}
+
+// shutdown closes the association of the ASP after ASPDN.
+func (se *SignalingEndpoint) shutdown(c *ASP) {
+	if !c.sgp && c.isUp() {
+		se.downASP(c)
+	}
+	c.closed = true
+	c.conn.close()
+}
+
+// release removes the ASP after the association is terminated.
+// Association that is shut down by peer after ASPDN is not lost.
+func (se *SignalingEndpoint) release(c *ASP) {
+	asps := <-se.asps
+	delete(asps, c.conn)
+	se.asps <- asps
+
+	if !c.closed && !(c.State() == Down && c.cause == io.EOF) {
+		notifyAssociation(c.event(AssociationLost, c.cause))
+	}
+	ev := c.event(AssociationClosed, nil)
+	c.conn.close()
+
+	if SctpNotify != nil {
+		SctpNotify(c.id, "closed")
+	}
+	notifyAssociation(ev)
+}
+
 func (se *SignalingEndpoint) Close() {
 	close(se.block)
+	if l := <-se.listener; l != nil {
+		close(l.q)
+	}
+	se.listener <- nil
 	asps := <-se.asps
 	for _, v := range asps {
-		if v.state == Active || v.state == Inactive {
-			r := make(chan error, 1)
-			v.msgQ <- &ASPDN{result: r}
-			<-r
-		}
-		sockClose(v.sock)
+		se.shutdown(v)
 	}
 	se.asps <- asps
 
@@ -196,41 +417,278 @@ func (se *SignalingEndpoint) Close() {
 		}
 	}
 
-	close(se.sharedQ)
-	sockClose(se.sock)
+	se.closeDispatcher()
+	se.tp.close()
 }
 
-func (se *SignalingEndpoint) selectASP() (c *ASP) {
-	asps := <-se.asps
-	list := make([]*ASP, 0, len(asps))
-	for _, c = range asps {
-		list = append(list, c)
+var (
+	ErrNoActiveASP            = errors.New("no active ASP")
+	ErrDestinationUnavailable = errors.New("destination is unavailable")
+	ErrMessageTooLarge        = errors.New("message is too large")
+)
+
+/*
+WriteError is error of data that is not sent by Write.
+Err is ErrNoActiveASP, ErrDestinationUnavailable, ErrQueueFull
+or ErrMessageTooLarge, and Cause is SCCP return cause for the data
+as same as data that is returned by peer.
+*/
+type WriteError struct {
+	Err   error
+	Cause Cause
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("%v (cause=%s)", e.Err, e.Cause)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// Write sends data to cdpa. dpc is used only for M3UA.
+// Data is sent via AS with Context of the endpoint.
+// SLS is assigned in round robin.
+// *WriteError is returned if the data is not sent.
+func (se *SignalingEndpoint) Write(dpc PointCode, cdpa SCCPAddr, data []byte) error {
+	return se.write(se.Context, se.nextSLS(), dpc, cdpa, data)
+}
+
+// WriteAS sends data to cdpa via AS with routing context ctx.
+// dpc is used only for M3UA.
+func (se *SignalingEndpoint) WriteAS(ctx uint32, dpc PointCode, cdpa SCCPAddr, data []byte) error {
+	return se.write(ctx, se.nextSLS(), dpc, cdpa, data)
+}
+
+// WriteSLS sends data to cdpa with SLS.
+// Data with same SLS is sent via same ASP and same SCTP stream
+// while the set of active ASP is not changed.
+// sls is masked by SLSMask. dpc is used only for M3UA.
+func (se *SignalingEndpoint) WriteSLS(sls uint32, dpc PointCode, cdpa SCCPAddr, data []byte) error {
+	return se.write(se.Context, sls, dpc, cdpa, data)
+}
+
+func (se *SignalingEndpoint) nextSLS() uint32 {
+	seq := <-se.sequence
+	se.sequence <- seq + 1
+	return seq
+}
+
+func (se *SignalingEndpoint) write(ctx, sls uint32, dpc PointCode, cdpa SCCPAddr, data []byte) error {
+	if se.Router != nil {
+		if p, a, ok := se.Router.translate(cdpa, se.isAvailable); ok {
+			dpc, cdpa = p, a
+		} else if dpc == 0 && cdpa.PointCode == 0 {
+			return se.unavailable(NoTranslationForThisSpecificAddress, data)
+		}
 	}
-	se.asps <- asps
-	for {
-		c = list[rand.Intn(len(list))]
-		if c.state == Active {
-			break
+
+	pc := dpc
+	if se.Protocol == SUA || pc == 0 {
+		pc = cdpa.PointCode
+	}
+	if cause := se.checkDestination(pc, se.Importance); cause != Success {
+		return se.unavailable(cause, data)
+	}
+
+	return se.send(dpc, userData{
+		rc:            ctx,
+		sls:           sls & SLSMask,
+		returnOnError: se.ReturnOnError,
+		cgpa:          se.SCCPAddr,
+		cdpa:          cdpa,
+		data:          data,
+		hopCount:      se.HopCounter,
+		importance:    se.Importance})
+}
+
+// unavailable notifies data for unavailable destination.
+func (se *SignalingEndpoint) unavailable(cause Cause, data []byte) error {
+	e := &WriteError{Err: ErrDestinationUnavailable, Cause: cause}
+	if TxFailureNotify != nil {
+		TxFailureNotify(e, data)
+	}
+	return e
+}
+
+// send sends ud to dpc via one of active ASPs of AS for ud.rc.
+// Active ASP is waited up to WriteTimeout.
+func (se *SignalingEndpoint) send(dpc PointCode, ud userData) (e error) {
+	defer func() {
+		if e != nil && TxFailureNotify != nil {
+			TxFailureNotify(e, ud.data)
+		}
+	}()
+
+	as, asps := se.waitASP(ud.rc, ud.sls, se.WriteTimeout)
+	if len(asps) == 0 {
+		return &WriteError{Err: ErrNoActiveASP, Cause: MtpFailure}
+	}
+
+	if se.Protocol == SUA {
+		if len(ud.data) > maxSUAData {
+			return &WriteError{Err: ErrMessageTooLarge, Cause: SegmentationFailure}
+		}
+		for _, c := range asps {
+			if err := c.enqueue(&TxCLDT{
+				ctx:          as.Context,
+				sequenceCtrl: ud.sls,
+				userData:     ud}); err != nil && e == nil {
+				e = &WriteError{Err: err, Cause: NetworkCongestion}
+			}
+		}
+		return
+	}
+
+	size := se.SegmentSize
+	if size <= 0 {
+		size = defaultSegmentSize
+	}
+	if n := ud.maxSCCPData(se.Variant); n <= 0 {
+		return &WriteError{Err: ErrMessageTooLarge, Cause: SegmentationFailure}
+	} else if size > n {
+		size = n
+	}
+	long := false
+	uds := []userData{ud}
+	if len(ud.data) <= size {
+	} else if se.LongData && len(ud.data) <= maxLongData {
+		long = true
+	} else {
+		ref := <-se.segRef
+		se.segRef <- ref + 1
+
+		var err error
+		if uds, err = ud.split(size, ref); err != nil {
+			return &WriteError{Err: ErrMessageTooLarge, Cause: SegmentationFailure}
+		}
+	}
+
+	na, opc := se.NetAppearance, se.PointCode
+	if as.NetAppearance != nil {
+		na = as.NetAppearance
+	}
+	if as.PointCode != 0 {
+		opc = as.PointCode
+	}
+	for _, c := range asps {
+		for _, ud := range uds {
+			if err := c.enqueue(&TxDATA{
+				na:       na,
+				ctx:      as.Context,
+				opc:      opc,
+				dpc:      dpc,
+				ni:       se.NetIndicator,
+				sls:      uint8(ud.sls),
+				userData: ud,
+				long:     long,
+				variant:  se.Variant}); err != nil && e == nil {
+				e = &WriteError{Err: err, Cause: NetworkCongestion}
+			}
 		}
 	}
 	return
 }
 
-func (se *SignalingEndpoint) Write(dpc uint32, cdpa SCCPAddr, data []byte) {
-	c := se.selectASP()
-	seq := <-c.sequence
-	c.sequence <- seq + 1
-
-	c.msgQ <- &TxDATA{
-		na:  se.NetAppearance,
-		ctx: se.Context,
-		opc: se.PointCode,
-		dpc: dpc,
-		ni:  se.NetIndicator,
-		sls: uint8(seq & SLSMask),
-		userData: userData{
-			returnOnError: se.ReturnOnError,
-			cgpa:          se.SCCPAddr,
-			cdpa:          cdpa,
-			data:          data}}
+func (se *SignalingEndpoint) receive(d userData) {
+	if d.cause != Success {
+		se.dispatch(d)
+	} else if d, ok := se.reassemble(d); ok {
+		se.dispatch(d)
+	}
+}
+
+func (se *SignalingEndpoint) handle(req userData) {
+	switch {
+	case req.cause != Success:
+		if se.NoticeHandler != nil {
+			se.NoticeHandler(req.cause, req.cgpa, req.cdpa, req.data)
+		} else if TxFailureNotify != nil {
+			TxFailureNotify(
+				fmt.Errorf("error response(cause=%s) from peer", req.cause), req.data)
+		}
+		return
+	case req.cdpa.SubsystemNumber == SsnSCMG:
+		se.handleSCMG(req)
+		return
+	}
+
+	handler := se.PayloadHandler
+	ssns := []teldata.SubsystemNumber{se.SubsystemNumber}
+	if as := se.lookupAS(req.rc, req.cdpa); as != nil {
+		if as.Handler != nil {
+			handler = as.Handler
+		}
+		if len(as.SubsystemNumbers) != 0 {
+			ssns = as.SubsystemNumbers
+		}
+	}
+
+	switch {
+	case handler == nil:
+		se.returnData(SubsystemFailure, req)
+	case !servesSSN(ssns, req.cdpa.SubsystemNumber):
+		se.returnData(UnequippedUser, req)
+	default:
+		handler(req.cgpa, req.cdpa, req.data)
+	}
+}
+
+func servesSSN(ssns []teldata.SubsystemNumber, ssn teldata.SubsystemNumber) bool {
+	if ssn == 0 {
+		return true
+	}
+	for _, s := range ssns {
+		if s == 0 || s == ssn {
+			return true
+		}
+	}
+	return false
+}
+
+// returnData sends UDTS, XUDTS or CLDR for undeliverable received data
+// if return on error is requested.
+func (se *SignalingEndpoint) returnData(cause Cause, req userData) {
+	if TxFailureNotify != nil {
+		TxFailureNotify(
+			fmt.Errorf("undeliverable data (cause=%s)", cause), req.data)
+	}
+	if !req.returnOnError {
+		return
+	}
+
+	sls := req.sls & SLSMask
+	as, asps := se.selectASP(req.rc, sls)
+	if len(asps) == 0 {
+		return
+	}
+	c := asps[0]
+	ud := userData{
+		sls:        sls,
+		cause:      cause,
+		cgpa:       req.cdpa,
+		cdpa:       req.cgpa,
+		data:       req.data,
+		hopCount:   req.hopCount,
+		importance: req.importance}
+	if se.Protocol == SUA {
+		c.enqueue(&TxCLDR{ctx: as.Context, userData: ud})
+		return
+	}
+	na, opc := se.NetAppearance, se.PointCode
+	if as.NetAppearance != nil {
+		na = as.NetAppearance
+	}
+	if as.PointCode != 0 {
+		opc = as.PointCode
+	}
+	c.enqueue(&TxDATA{
+		na:       na,
+		ctx:      as.Context,
+		opc:      opc,
+		dpc:      req.opc,
+		ni:       se.NetIndicator,
+		sls:      uint8(sls),
+		userData: ud,
+		variant:  se.Variant})
 }
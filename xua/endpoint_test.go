@@ -0,0 +1,98 @@
+package xua
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteNoActiveASP(t *testing.T) {
+	se, _ := NewPipeSignalingEndpoint(pipeAddr(1, 2915))
+	se.Protocol = SUA
+	defer se.Close()
+
+	e := se.Write(0, SCCPAddr{PointCode: 1}, []byte{0})
+	var we *WriteError
+	if !errors.Is(e, ErrNoActiveASP) || !errors.As(e, &we) || we.Cause != MtpFailure {
+		t.Fatalf("unexpected result: %v", e)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	received := make(chan []byte, 1)
+	sgp, asp := pipePair(t, 2916, SUA, func(sgp, _ *SignalingEndpoint) {
+		sgp.PayloadHandler = func(_, _ SCCPAddr, data []byte) {
+			received <- data
+		}
+	})
+	defer sgp.Close()
+	defer asp.Close()
+
+	// Write waits for the ASP to be activated again
+	sgpAddr := pipeAddr(1, 2916)
+	asp.WriteTimeout = time.Second * 5
+	asp.Disconnect(sgpAddr)
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		if e := asp.ConnectTo(sgpAddr); e != nil {
+			t.Error(e)
+		}
+	}()
+	if e := asp.Write(0, SCCPAddr{PointCode: 1}, []byte{1, 2, 3}); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second * 5):
+		t.Fatal("data is not received")
+	}
+
+	asp.WriteTimeout = time.Millisecond * 100
+	asp.Disconnect(sgpAddr)
+	start := time.Now()
+	if e := asp.Write(0, SCCPAddr{PointCode: 1}, []byte{0}); !errors.Is(e, ErrNoActiveASP) {
+		t.Fatalf("unexpected result: %v", e)
+	}
+	if d := time.Since(start); d < asp.WriteTimeout {
+		t.Fatalf("Write returns in %s", d)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	received := make(chan []byte, 1)
+	sgp, asp := pipePair(t, 2917, SUA, func(sgp, _ *SignalingEndpoint) {
+		sgp.PayloadHandler = func(_, _ SCCPAddr, data []byte) {
+			received <- data
+		}
+	})
+	// asp is closed by Drain
+	defer sgp.Close()
+
+	var phases []DrainPhase
+	DrainNotify = func(p DrainPhase, _ int) {
+		phases = append(phases, p)
+	}
+	defer func() { DrainNotify = nil }()
+
+	open := 1
+	s := asp.Drain(time.Second*5, func() int {
+		if open != 0 && asp.ASState(0) == Inactive {
+			// open transaction is finished via draining ASP
+			if e := asp.Write(0, SCCPAddr{PointCode: 1}, []byte{1}); e != nil {
+				t.Error(e)
+			}
+			<-received
+			open = 0
+			return 1
+		}
+		return open
+	}, nil)
+
+	if s.Inactivated != 1 || s.Pending != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if len(phases) < 4 || phases[0] != DrainInactive ||
+		phases[len(phases)-1] != DrainClosed {
+		t.Fatalf("unexpected phases %v", phases)
+	}
+}
@@ -0,0 +1,148 @@
+package xua
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// AssociationEventType is type of association lifecycle event.
+type AssociationEventType uint8
+
+const (
+	// AssociationConnecting is notified before connecting to peer.
+	AssociationConnecting AssociationEventType = iota
+	// AssociationEstablished is notified when association is
+	// connected to or accepted from peer.
+	AssociationEstablished
+	// AssociationASPUp is notified when ASP becomes up.
+	AssociationASPUp
+	// AssociationASPActive is notified when ASP becomes active.
+	AssociationASPActive
+	// AssociationLost is notified when association is failed to connect,
+	// or terminated without Close or Disconnect.
+	AssociationLost
+	// AssociationClosed is notified when association is closed.
+	AssociationClosed
+)
+
+func (t AssociationEventType) String() string {
+	switch t {
+	case AssociationConnecting:
+		return "connecting"
+	case AssociationEstablished:
+		return "established"
+	case AssociationASPUp:
+		return "ASP up"
+	case AssociationASPActive:
+		return "ASP active"
+	case AssociationLost:
+		return "lost"
+	case AssociationClosed:
+		return "closed"
+	}
+	return ""
+}
+
+// AssociationEvent is lifecycle event of association.
+// Err is cause of AssociationLost.
+type AssociationEvent struct {
+	Type      AssociationEventType
+	ID        byte
+	LocalAddr net.Addr
+	PeerAddr  net.Addr
+	Err       error
+}
+
+func (ev AssociationEvent) String() string {
+	s := fmt.Sprintf("association(id=%d) %s", ev.ID, ev.Type)
+	if ev.LocalAddr != nil || ev.PeerAddr != nil {
+		s = fmt.Sprintf("%s (local=%v, peer=%v)", s, ev.LocalAddr, ev.PeerAddr)
+	}
+	if ev.Err != nil {
+		s = fmt.Sprintf("%s: %v", s, ev.Err)
+	}
+	return s
+}
+
+func notifyAssociation(ev AssociationEvent) {
+	if AssociationNotify != nil {
+		AssociationNotify(ev)
+	}
+}
+
+// event returns lifecycle event of the ASP.
+func (c *ASP) event(t AssociationEventType, e error) AssociationEvent {
+	return AssociationEvent{
+		Type:      t,
+		ID:        c.id,
+		LocalAddr: c.LocalAddr(),
+		PeerAddr:  c.RemoteAddr(),
+		Err:       e}
+}
+
+var (
+	defaultRetryDelay    = time.Second * 30
+	defaultMaxRetryDelay = time.Hour
+)
+
+/*
+RetryPolicy is policy of reconnection to peer.
+Delay before n-th retry after consecutive failures is
+InitialDelay * Multiplier^(n-1), that is limited to MaxDelay
+and randomized by ±Jitter ratio.
+Zero value retries every 30 seconds forever.
+*/
+type RetryPolicy struct {
+	// InitialDelay is delay before the first retry.
+	// Default value 30s is used if 0.
+	InitialDelay time.Duration
+	// MaxDelay is upper limit of delay.
+	// Default value 1h is used if 0.
+	MaxDelay time.Duration
+	// Multiplier is factor of exponential backoff.
+	// Delay is fixed if less than or equal to 1.
+	Multiplier float64
+	// Jitter is ratio of random variation of delay, from 0 to 1.
+	Jitter float64
+	// MaxAttempts is number of consecutive failures
+	// to give up connecting. Retry forever if 0.
+	MaxAttempts int
+}
+
+// delay returns delay before retry after n consecutive failures.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := float64(p.InitialDelay)
+	if d <= 0 {
+		d = float64(defaultRetryDelay)
+	}
+	limit := float64(p.MaxDelay)
+	if limit <= 0 {
+		limit = float64(defaultMaxRetryDelay)
+	}
+	for i := 1; i < n && p.Multiplier > 1 && d < limit; i++ {
+		d *= p.Multiplier
+	}
+	if d > limit {
+		d = limit
+	}
+	if j := p.Jitter; j > 0 {
+		if j > 1 {
+			j = 1
+		}
+		d += d * j * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// notifyState notifies lifecycle event of the ASP
+// when state is changed from old to s.
+func (c *ASP) notifyState(old, s Status) {
+	switch {
+	case s == Active:
+		notifyAssociation(c.event(AssociationASPActive, nil))
+	case s == Inactive && (old == Down || old == 0):
+		notifyAssociation(c.event(AssociationASPUp, nil))
+	}
+}
@@ -0,0 +1,40 @@
+package xua
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   RetryPolicy
+		n        int
+		min, max time.Duration
+	}{
+		{"default", RetryPolicy{}, 5,
+			time.Second * 30, time.Second * 30},
+		{"fixed", RetryPolicy{InitialDelay: time.Second, Multiplier: 1}, 10,
+			time.Second, time.Second},
+		{"first", RetryPolicy{InitialDelay: time.Second, Multiplier: 2}, 1,
+			time.Second, time.Second},
+		{"multiplier", RetryPolicy{InitialDelay: time.Second, Multiplier: 2}, 4,
+			time.Second * 8, time.Second * 8},
+		{"cap", RetryPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Second * 5}, 10,
+			time.Second * 5, time.Second * 5},
+		{"default cap", RetryPolicy{Multiplier: 2}, 100,
+			time.Hour, time.Hour},
+		{"jitter", RetryPolicy{InitialDelay: time.Second * 10, Jitter: 0.5}, 1,
+			time.Second * 5, time.Second * 15},
+		{"jitter over 1", RetryPolicy{InitialDelay: time.Second * 10, Jitter: 3}, 1,
+			0, time.Second * 20},
+		{"jitter on cap", RetryPolicy{Multiplier: 2, MaxDelay: time.Minute, Jitter: 0.1}, 1000,
+			time.Second * 54, time.Second * 66},
+	} {
+		for range 100 {
+			if d := tc.policy.delay(tc.n); d < tc.min || d > tc.max {
+				t.Fatalf("%s: delay %s is out of [%s, %s]", tc.name, d, tc.min, tc.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package xua
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+/*
+Rule is global title translation rule.
+
+	[
+	  {
+	    "prefix": "8190",
+	    "ssn": 6,
+	    "primary": {"pc": 1001, "route_on_ssn": true},
+	    "backup": {"pc": 1002, "route_on_ssn": true}
+	  },
+	  {
+	    "prefix": "81",
+	    "primary": {"pc": 2001}
+	  }
+	]
+
+Rule with the longest Prefix that matches digits of called party GT is used.
+TranslationType and SubsystemNumber of the rule is also compared
+with called party address if specified.
+Rule with empty Prefix matches any GT.
+*/
+type Rule struct {
+	Prefix          string                  `json:"prefix"`
+	TranslationType *uint8                  `json:"tt,omitempty"`
+	SubsystemNumber teldata.SubsystemNumber `json:"ssn,omitempty"`
+
+	Primary Route  `json:"primary"`
+	Backup  *Route `json:"backup,omitempty"`
+}
+
+func (r Rule) match(a SCCPAddr) bool {
+	if r.TranslationType != nil &&
+		*r.TranslationType != a.GlobalTitle.TranslationType {
+		return false
+	}
+	if r.SubsystemNumber != 0 && r.SubsystemNumber != a.SubsystemNumber {
+		return false
+	}
+	return strings.HasPrefix(a.GlobalTitle.Digits.String(), r.Prefix)
+}
+
+/*
+Route is destination of global title translation.
+Called party address is routed on GT to PointCode by default.
+If RouteOnSSN is true, PointCode is set to called party address
+and SubsystemNumber is replaced if specified.
+TranslationType of GT is replaced if specified.
+*/
+type Route struct {
+	PointCode       PointCode               `json:"pc"`
+	RouteOnSSN      bool                    `json:"route_on_ssn,omitempty"`
+	SubsystemNumber teldata.SubsystemNumber `json:"ssn,omitempty"`
+	TranslationType *uint8                  `json:"tt,omitempty"`
+}
+
+// dest returns DPC and SSN of the route. SSN is 0 if routed on GT.
+func (r Route) dest(a SCCPAddr) (PointCode, teldata.SubsystemNumber) {
+	if !r.RouteOnSSN {
+		return r.PointCode, 0
+	}
+	if r.SubsystemNumber != 0 {
+		return r.PointCode, r.SubsystemNumber
+	}
+	return r.PointCode, a.SubsystemNumber
+}
+
+func (r Route) translate(a SCCPAddr) SCCPAddr {
+	if r.TranslationType != nil {
+		a.GlobalTitle.TranslationType = *r.TranslationType
+	}
+	if !r.RouteOnSSN {
+		a.PointCode = 0
+		a.RoutingIndicator = RouteOnGT
+		return a
+	}
+	a.PointCode = r.PointCode
+	a.RoutingIndicator = RouteOnSSN
+	if r.SubsystemNumber != 0 {
+		a.SubsystemNumber = r.SubsystemNumber
+	}
+	return a
+}
+
+// Router is global title translation table of SignalingEndpoint.
+type Router struct {
+	rules chan []Rule
+}
+
+// NewRouter generates Router with rules.
+func NewRouter(rules []Rule) *Router {
+	r := &Router{rules: make(chan []Rule, 1)}
+	r.rules <- sortRules(rules)
+	return r
+}
+
+// LoadRouter generates Router with rules from JSON file.
+func LoadRouter(path string) (*Router, error) {
+	r := NewRouter(nil)
+	return r, r.Load(path)
+}
+
+func sortRules(rules []Rule) []Rule {
+	rules = append([]Rule{}, rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+	return rules
+}
+
+// Rules returns current rules of the router.
+func (r *Router) Rules() []Rule {
+	rules := <-r.rules
+	r.rules <- rules
+	return append([]Rule{}, rules...)
+}
+
+// Set replaces all rules of the router.
+func (r *Router) Set(rules []Rule) {
+	rules = sortRules(rules)
+	<-r.rules
+	r.rules <- rules
+}
+
+// Load replaces all rules of the router with rules in JSON file.
+func (r *Router) Load(path string) error {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return e
+	}
+	var rules []Rule
+	if e = json.Unmarshal(data, &rules); e != nil {
+		return fmt.Errorf("invalid routing file %s: %v", path, e)
+	}
+	r.Set(rules)
+	return nil
+}
+
+// Watch reloads rules from JSON file when the file is modified.
+// Modification time of the file is checked in each interval.
+// Returned function stops watching.
+func (r *Router) Watch(path string, interval time.Duration) (stop func()) {
+	var mod time.Time
+	if s, e := os.Stat(path); e == nil {
+		mod = s.ModTime()
+	}
+	done := make(chan any)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			s, e := os.Stat(path)
+			if e != nil || s.ModTime().Equal(mod) {
+				continue
+			}
+			mod = s.ModTime()
+			e = r.Load(path)
+			if RoutingNotify != nil {
+				RoutingNotify(path, e)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// translate returns DPC and translated called party address for cdpa.
+// Backup route is used if DPC or subsystem of primary route is not available.
+func (r *Router) translate(cdpa SCCPAddr,
+	available func(PointCode, teldata.SubsystemNumber) bool) (
+	PointCode, SCCPAddr, bool) {
+	rules := <-r.rules
+	r.rules <- rules
+
+	for _, rule := range rules {
+		if !rule.match(cdpa) {
+			continue
+		}
+		route := rule.Primary
+		if rule.Backup != nil &&
+			!available(route.dest(cdpa)) && available(rule.Backup.dest(cdpa)) {
+			route = *rule.Backup
+		}
+		return route.PointCode, route.translate(cdpa), true
+	}
+	return 0, cdpa, false
+}
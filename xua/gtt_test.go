@@ -0,0 +1,113 @@
+package xua
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+func gtAddr(digits string, tt uint8, ssn teldata.SubsystemNumber) SCCPAddr {
+	a := SCCPAddr{RoutingIndicator: RouteOnGT, SubsystemNumber: ssn}
+	a.GlobalTitle.TranslationType = tt
+	a.GlobalTitle.Digits, _ = teldata.ParseTBCD(digits)
+	return a
+}
+
+func TestRouterTranslate(t *testing.T) {
+	tt := uint8(10)
+	r := NewRouter([]Rule{
+		{Prefix: "", Primary: Route{PointCode: 9}},
+		{Prefix: "81", Primary: Route{PointCode: 2001}},
+		{Prefix: "8190", SubsystemNumber: 6,
+			Primary: Route{PointCode: 1001, RouteOnSSN: true},
+			Backup:  &Route{PointCode: 1002, RouteOnSSN: true}},
+		{Prefix: "8190", SubsystemNumber: 8,
+			Primary: Route{PointCode: 3001, RouteOnSSN: true, SubsystemNumber: 149},
+			Backup:  &Route{PointCode: 3002}},
+		{Prefix: "8180", TranslationType: &tt,
+			Primary: Route{PointCode: 4001}},
+	})
+
+	for _, tc := range []struct {
+		name string
+		cdpa SCCPAddr
+		down map[PointCode]bool
+		pc   PointCode
+		ri   RoutingIndicator
+		ssn  teldata.SubsystemNumber
+	}{
+		{"longest prefix", gtAddr("819012", 0, 6), nil, 1001, RouteOnSSN, 6},
+		{"shorter prefix", gtAddr("818012", 0, 6), nil, 2001, RouteOnGT, 6},
+		{"SSN mismatch", gtAddr("819012", 0, 7), nil, 2001, RouteOnGT, 7},
+		{"SSN replaced", gtAddr("819012", 0, 8), nil, 3001, RouteOnSSN, 149},
+		{"TT match", gtAddr("818012", 10, 6), nil, 4001, RouteOnGT, 6},
+		{"empty prefix", gtAddr("443012", 0, 6), nil, 9, RouteOnGT, 6},
+		{"backup", gtAddr("819012", 0, 6),
+			map[PointCode]bool{1001: true}, 1002, RouteOnSSN, 6},
+		{"backup on GT", gtAddr("819012", 0, 8),
+			map[PointCode]bool{3001: true}, 3002, RouteOnGT, 8},
+		{"backup unavailable", gtAddr("819012", 0, 6),
+			map[PointCode]bool{1001: true, 1002: true}, 1001, RouteOnSSN, 6},
+	} {
+		available := func(pc PointCode, _ teldata.SubsystemNumber) bool {
+			return !tc.down[pc]
+		}
+		pc, a, ok := r.translate(tc.cdpa, available)
+		if !ok || pc != tc.pc || a.RoutingIndicator != tc.ri ||
+			a.SubsystemNumber != tc.ssn {
+			t.Errorf("%s: translated to %s, %+v, %t", tc.name, pc, a, ok)
+		}
+		if tc.ri == RouteOnSSN && a.PointCode != pc ||
+			tc.ri == RouteOnGT && a.PointCode != 0 {
+			t.Errorf("%s: unexpected point code in %+v", tc.name, a)
+		}
+	}
+
+	r.Set([]Rule{{Prefix: "81", Primary: Route{PointCode: 2001}}})
+	if _, _, ok := r.translate(gtAddr("443012", 0, 6),
+		func(PointCode, teldata.SubsystemNumber) bool { return true }); ok {
+		t.Error("unmatched GT is translated")
+	}
+}
+
+func TestRouterWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route.json")
+	if e := os.WriteFile(path, []byte(`[{"prefix":"81","primary":{"pc":1}}]`), 0o644); e != nil {
+		t.Fatal(e)
+	}
+	r, e := LoadRouter(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	loaded := make(chan error, 1)
+	RoutingNotify = func(_ string, e error) { loaded <- e }
+	stop := r.Watch(path, time.Millisecond*10)
+	t.Cleanup(func() {
+		stop()
+		RoutingNotify = nil
+	})
+
+	if e = os.WriteFile(path, []byte(`[{"prefix":"44","primary":{"pc":2}}]`), 0o644); e != nil {
+		t.Fatal(e)
+	}
+	// modification time may have coarse resolution
+	mod := time.Now().Add(time.Second)
+	os.Chtimes(path, mod, mod)
+
+	select {
+	case e = <-loaded:
+		if e != nil {
+			t.Fatal(e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("routing file is not reloaded")
+	}
+	if rules := r.Rules(); len(rules) != 1 || rules[0].Prefix != "44" ||
+		rules[0].Primary.PointCode != 2 {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
@@ -1,6 +1,7 @@
 package xua
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 )
@@ -46,10 +47,11 @@ Direction is SGP -> ASP.
 type ERR struct {
 	code ErrCode
 	ctx  uint32
-	apc  []PointCode
+	apc  []AffectedPointCode
 	na   *uint32
 	// info []byte
 }
+type TxERR ERR
 
 func (m *ERR) handleMessage(c *ASP) {
 	if StateNotify != nil {
@@ -82,6 +84,25 @@ func (m *ERR) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+func (m *TxERR) handleMessage(c *ASP) { c.write(m) }
+func (m *TxERR) handleResult(message) {}
+
+func (m *TxERR) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	writeUint32(buf, 0x000c, uint32(m.code))
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+	if len(m.apc) != 0 {
+		writeAPC(buf, m.apc)
+	}
+	if m.na != nil {
+		writeUint32(buf, 0x010d, *m.na)
+	}
+	return 0x00, 0x00, buf.Bytes()
+}
+
 type ErrCode uint32
 
 const (
@@ -184,7 +205,12 @@ type NTFY struct {
 	// id     *uint32
 	ctx uint32
 	// info    string
+
+	// local is true if the NTFY is not received from SG
+	// but generated by the ASP itself.
+	local bool
 }
+type TxNTFY NTFY
 
 type Status uint32
 
@@ -214,17 +240,28 @@ func (s Status) String() string {
 }
 
 func (m *NTFY) handleMessage(a *ASP) {
-	if a.state == m.status {
+	if a.State() == m.status && !m.local {
 		return
 	}
 
 	if StateNotify != nil {
 		StateNotify(a.id, m.status)
 	}
+	if m.local && m.status == Down {
+		// association is lost, no answer for waiting request
+		a.ctrlMsg = nil
+	}
 	switch m.status {
 	case Down, Inactive, Active, Pending:
-		a.state = m.status
+		if m.local {
+			a.transit(m.status, 0, 0)
+		} else {
+			a.transit(m.status, m.status, m.ctx)
+		}
 		a.statNotif <- m.status
+	case AlternateASPActive:
+		a.se.alternate(a, m.ctx)
+		a.transit(Inactive, m.status, m.ctx)
 	}
 }
 
@@ -247,6 +284,19 @@ func (m *NTFY) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+func (m *TxNTFY) handleMessage(c *ASP) { c.write(m) }
+func (m *TxNTFY) handleResult(message) {}
+
+func (m *TxNTFY) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	writeUint32(buf, 0x000d, uint32(m.status))
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+	return 0x00, 0x01, buf.Bytes()
+}
+
 // 0x02 TEI Status Request
 // 0x03 TEI Status Confirm
 // 0x04 TEI Status Indication
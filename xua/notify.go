@@ -1,16 +1,44 @@
 package xua
 
+import "time"
+
 var (
 	ErrorNotify func(id byte, c ErrCode)
 	StateNotify func(id byte, s Status)
 	SctpNotify  func(id byte, s string)
 
-	DunaNotify func([]PointCode)
-	DavaNotify func([]PointCode)
-	DaudNotify func([]PointCode)
-	SconNotify func([]PointCode, uint32)
-	DupuNotify func([]PointCode, uint16)
-	DrstNotify func([]PointCode)
+	// AssociationNotify is called with lifecycle event of association.
+	AssociationNotify func(ev AssociationEvent)
+
+	// HeartbeatNotify is called with round trip time
+	// when BEAT Ack is received.
+	HeartbeatNotify func(id byte, rtt time.Duration)
+
+	DunaNotify func([]AffectedPointCode)
+	DavaNotify func([]AffectedPointCode)
+	DaudNotify func([]AffectedPointCode)
+	SconNotify func([]AffectedPointCode, uint32)
+	DupuNotify func([]AffectedPointCode, uint16)
+	DrstNotify func([]AffectedPointCode)
+
+	// DestinationNotify is called when state of remote destination
+	// is changed by SSNM.
+	DestinationNotify func(d Destination)
+
+	// SubsystemNotify is called when remote subsystem state is changed
+	// by SSA or SSP.
+	SubsystemNotify func(s Subsystem, allowed bool)
+
+	// RoutingNotify is called when routing file is reloaded.
+	RoutingNotify func(path string, e error)
+
+	// CaptureNotify is called when capture file is opened,
+	// or with error when capture is stopped by failure.
+	CaptureNotify func(path string, e error)
+
+	// DrainNotify is called with progress of Drain and
+	// number of pending work.
+	DrainNotify func(p DrainPhase, pending int)
 
 	TxFailureNotify func(error, []byte) = nil
 	RxFailureNotify func(error, []byte) = nil
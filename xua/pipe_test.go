@@ -0,0 +1,46 @@
+package xua
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeAddr returns address of 127.0.0.n for in-process pipe.
+func pipeAddr(n byte, port int) *SCTPAddr {
+	return &SCTPAddr{IP: []net.IP{net.IPv4(127, 0, 0, n)}, Port: port}
+}
+
+// pipePair returns SGP and ASP endpoints of proto on in-process pipe
+// after the ASP is activated.
+// SGP is on 127.0.0.1 with point code 1, and ASP is on 127.0.0.2
+// with point code 2. setup is called before the ASP is connected.
+func pipePair(t *testing.T, port int, proto Protocol,
+	setup ...func(sgp, asp *SignalingEndpoint)) (sgp, asp *SignalingEndpoint) {
+	sgp, _ = NewPipeSignalingEndpoint(pipeAddr(1, port))
+	sgp.Protocol = proto
+	sgp.PointCode = 1
+	sgp.SCCPAddr = SCCPAddr{PointCode: 1, SubsystemNumber: 254}
+	asp, _ = NewPipeSignalingEndpoint(pipeAddr(2, port))
+	asp.Protocol = proto
+	asp.PointCode = 2
+	asp.SCCPAddr = SCCPAddr{PointCode: 2, SubsystemNumber: 254}
+	for _, f := range setup {
+		f(sgp, asp)
+	}
+
+	if e := sgp.Listen(); e != nil {
+		t.Fatal(e)
+	}
+	if e := asp.ConnectTo(pipeAddr(1, port)); e != nil {
+		sgp.Close()
+		t.Fatal(e)
+	}
+	for i := 0; asp.ASState(0) != Active; i++ {
+		if i == 50 {
+			t.Fatal("ASP is not activated")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return
+}
@@ -0,0 +1,162 @@
+package xua
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PCFormat is notation of point code.
+type PCFormat uint8
+
+const (
+	// PCInteger is decimal integer notation.
+	PCInteger PCFormat = iota
+	// PC383 is 3-8-3 notation of 14 bit ITU international point code.
+	PC383
+	// PC888 is 8-8-8 notation of 24 bit ANSI point code.
+	PC888
+	// PC547 is 5-4-7 notation of 16 bit Japanese point code.
+	// Main area, sub area and unit number are placed
+	// from the least significant bit.
+	PC547
+)
+
+// PointCodeFormat is notation of PointCode in String, JSON and logs.
+var PointCodeFormat = PCInteger
+
+func (f PCFormat) String() string {
+	switch f {
+	case PCInteger:
+		return "integer"
+	case PC383:
+		return "3-8-3"
+	case PC888:
+		return "8-8-8"
+	case PC547:
+		return "5-4-7"
+	}
+	return ""
+}
+
+// ParsePCFormat returns PCFormat of the name.
+func ParsePCFormat(s string) (PCFormat, error) {
+	for _, f := range []PCFormat{PCInteger, PC383, PC888, PC547} {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return PCInteger, fmt.Errorf("invalid point code format %s", s)
+}
+
+// fields returns bit length of each field of the notation.
+func (f PCFormat) fields() []int {
+	switch f {
+	case PC383:
+		return []int{3, 8, 3}
+	case PC888:
+		return []int{8, 8, 8}
+	case PC547:
+		return []int{5, 4, 7}
+	}
+	return nil
+}
+
+// shifts returns bit position of each field of the notation.
+func (f PCFormat) shifts() []int {
+	l := f.fields()
+	s := make([]int, len(l))
+	for i := range l {
+		if f == PC547 {
+			// first field is the least significant
+			if i != 0 {
+				s[i] = s[i-1] + l[i-1]
+			}
+		} else {
+			for _, n := range l[i+1:] {
+				s[i] += n
+			}
+		}
+	}
+	return s
+}
+
+// Format returns p in notation f.
+func (f PCFormat) Format(p PointCode) string {
+	l := f.fields()
+	if l == nil {
+		return strconv.FormatUint(uint64(p), 10)
+	}
+	s := make([]string, len(l))
+	for i, sh := range f.shifts() {
+		s[i] = strconv.FormatUint(uint64(uint32(p)>>sh&(1<<l[i]-1)), 10)
+	}
+	return strings.Join(s, "-")
+}
+
+/*
+Parse returns point code of s in notation f.
+Field is separated by "-" or ".".
+Decimal integer is also accepted in any notation.
+*/
+func (f PCFormat) Parse(s string) (PointCode, error) {
+	s = strings.TrimSpace(s)
+	if v, e := strconv.ParseUint(s, 10, 32); e == nil {
+		return PointCode(v), nil
+	}
+
+	l := f.fields()
+	d := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '.' })
+	if l == nil || len(d) != len(l) {
+		return 0, fmt.Errorf("invalid point code %s for %s format", s, f)
+	}
+	var p uint32
+	for i, sh := range f.shifts() {
+		v, e := strconv.ParseUint(d[i], 10, l[i])
+		if e != nil {
+			return 0, fmt.Errorf("invalid point code %s for %s format", s, f)
+		}
+		p |= uint32(v) << sh
+	}
+	return PointCode(p), nil
+}
+
+// PointCode is signaling point code.
+type PointCode uint32
+
+// ParsePointCode returns point code of s in PointCodeFormat.
+func ParsePointCode(s string) (PointCode, error) {
+	return PointCodeFormat.Parse(s)
+}
+
+func (p PointCode) String() string {
+	return PointCodeFormat.Format(p)
+}
+
+// Set sets point code of s in PointCodeFormat for flag.Value.
+func (p *PointCode) Set(s string) (e error) {
+	*p, e = ParsePointCode(s)
+	return
+}
+
+func (p PointCode) MarshalJSON() ([]byte, error) {
+	if PointCodeFormat == PCInteger {
+		return json.Marshal(uint32(p))
+	}
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON accepts integer or string in PointCodeFormat.
+func (p *PointCode) UnmarshalJSON(b []byte) error {
+	var v uint32
+	if e := json.Unmarshal(b, &v); e == nil {
+		*p = PointCode(v)
+		return nil
+	}
+	var s string
+	if e := json.Unmarshal(b, &s); e != nil {
+		return e
+	}
+	return p.Set(s)
+}
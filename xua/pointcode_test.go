@@ -0,0 +1,100 @@
+package xua
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPCFormat(t *testing.T) {
+	for _, tc := range []struct {
+		f PCFormat
+		p PointCode
+		s string
+	}{
+		{PCInteger, 4899, "4899"},
+		{PC383, 4899, "2-100-3"},
+		{PC383, 0x3fff, "7-255-7"},
+		{PC888, 0x010203, "1-2-3"},
+		{PC888, 0xffffff, "255-255-255"},
+		// main area is placed in the least significant bits
+		{PC547, 1 | 2<<5 | 3<<9, "1-2-3"},
+		{PC547, 0x0123, "3-9-0"},
+		{PC547, 0xffff, "31-15-127"},
+	} {
+		if s := tc.f.Format(tc.p); s != tc.s {
+			t.Errorf("%s: format %d = %s, want %s", tc.f, tc.p, s, tc.s)
+		}
+		if p, e := tc.f.Parse(tc.s); e != nil || p != tc.p {
+			t.Errorf("%s: parse %s = %d, %v, want %d", tc.f, tc.s, p, e, tc.p)
+		}
+	}
+}
+
+func TestPCFormatParse(t *testing.T) {
+	for _, tc := range []struct {
+		f  PCFormat
+		s  string
+		p  PointCode
+		ok bool
+	}{
+		// integer is accepted in any format
+		{PC383, "4899", 4899, true},
+		{PC547, " 1601 ", 1601, true},
+		{PC383, "2.100.3", 4899, true},
+		{PC383, "8-0-0", 0, false},
+		{PC383, "0-256-0", 0, false},
+		{PC888, "256-0-0", 0, false},
+		{PC547, "32-0-0", 0, false},
+		{PC547, "0-16-0", 0, false},
+		{PC547, "0-0-128", 0, false},
+		{PC383, "1-2", 0, false},
+		{PC383, "1-2-3-4", 0, false},
+		{PC888, "a-b-c", 0, false},
+		{PCInteger, "1-2-3", 0, false},
+		{PCInteger, "-1", 0, false},
+	} {
+		p, e := tc.f.Parse(tc.s)
+		if (e == nil) != tc.ok || p != tc.p {
+			t.Errorf("%s: parse %q = %d, %v", tc.f, tc.s, p, e)
+		}
+	}
+}
+
+func TestPointCodeJSON(t *testing.T) {
+	f := PointCodeFormat
+	t.Cleanup(func() { PointCodeFormat = f })
+
+	for _, tc := range []struct {
+		f    PCFormat
+		p    PointCode
+		json string
+	}{
+		{PCInteger, 4899, `4899`},
+		{PC383, 4899, `"2-100-3"`},
+		{PC888, 0x010203, `"1-2-3"`},
+		{PC547, 1601, `"1-2-3"`},
+	} {
+		PointCodeFormat = tc.f
+		b, e := json.Marshal(tc.p)
+		if e != nil || string(b) != tc.json {
+			t.Errorf("%s: marshal %d = %s, %v", tc.f, tc.p, b, e)
+		}
+		var p PointCode
+		if e = json.Unmarshal(b, &p); e != nil || p != tc.p {
+			t.Errorf("%s: unmarshal %s = %d, %v", tc.f, b, p, e)
+		}
+	}
+
+	// integer is accepted in any format
+	PointCodeFormat = PC383
+	var p PointCode
+	if e := json.Unmarshal([]byte(`4899`), &p); e != nil || p != 4899 {
+		t.Errorf("unmarshal integer = %d, %v", p, e)
+	}
+	if e := json.Unmarshal([]byte(`"8-0-0"`), &p); e == nil {
+		t.Error("out of range point code is accepted")
+	}
+	if e := json.Unmarshal([]byte(`true`), &p); e == nil {
+		t.Error("invalid JSON type is accepted")
+	}
+}
@@ -1,10 +1,593 @@
 package xua
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
 /*
 RKM: Routing Key Management Messages
 Message class = 0x09
-// 0x01 Registration Request (REG REQ)
-// 0x02 Registration Response (REG RSP)
-// 0x03 Deregistration Request (DEREG REQ)
-// 0x04 Deregistration Response (DEREG RSP)
 */
+
+// RegistrationStatus is status of routing key registration in REG RSP.
+type RegistrationStatus uint32
+
+const (
+	Registered                    RegistrationStatus = 0
+	RegUnknown                    RegistrationStatus = 1
+	RegInvalidDPC                 RegistrationStatus = 2
+	RegInvalidNetworkAppearance   RegistrationStatus = 3
+	RegInvalidRoutingKey          RegistrationStatus = 4
+	RegPermissionDenied           RegistrationStatus = 5
+	RegCannotSupportUniqueRouting RegistrationStatus = 6
+	RegNotProvisioned             RegistrationStatus = 7
+	RegInsufficientResources      RegistrationStatus = 8
+	RegUnsupportedParameter       RegistrationStatus = 9
+	RegInvalidTrafficMode         RegistrationStatus = 10
+	RegChangeRefused              RegistrationStatus = 11
+	RegAlreadyRegistered          RegistrationStatus = 12
+)
+
+func (s RegistrationStatus) String() string {
+	switch s {
+	case Registered:
+		return "successfully registered"
+	case RegUnknown:
+		return "unknown"
+	case RegInvalidDPC:
+		return "invalid DPC"
+	case RegInvalidNetworkAppearance:
+		return "invalid network appearance"
+	case RegInvalidRoutingKey:
+		return "invalid routing key"
+	case RegPermissionDenied:
+		return "permission denied"
+	case RegCannotSupportUniqueRouting:
+		return "cannot support unique routing"
+	case RegNotProvisioned:
+		return "routing key not currently provisioned"
+	case RegInsufficientResources:
+		return "insufficient resources"
+	case RegUnsupportedParameter:
+		return "unsupported RK parameter field"
+	case RegInvalidTrafficMode:
+		return "unsupported/invalid traffic handling mode"
+	case RegChangeRefused:
+		return "routing key change refused"
+	case RegAlreadyRegistered:
+		return "routing key already registered"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(s))
+}
+
+// DeregistrationStatus is status of routing key deregistration in DEREG RSP.
+type DeregistrationStatus uint32
+
+const (
+	Deregistered               DeregistrationStatus = 0
+	DeregUnknown               DeregistrationStatus = 1
+	DeregInvalidRoutingContext DeregistrationStatus = 2
+	DeregPermissionDenied      DeregistrationStatus = 3
+	DeregNotRegistered         DeregistrationStatus = 4
+	DeregASPCurrentlyActive    DeregistrationStatus = 5
+)
+
+func (s DeregistrationStatus) String() string {
+	switch s {
+	case Deregistered:
+		return "successfully deregistered"
+	case DeregUnknown:
+		return "unknown"
+	case DeregInvalidRoutingContext:
+		return "invalid routing context"
+	case DeregPermissionDenied:
+		return "permission denied"
+	case DeregNotRegistered:
+		return "not registered"
+	case DeregASPCurrentlyActive:
+		return "ASP currently active for routing context"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(s))
+}
+
+// tags of RKM parameters for M3UA and SUA
+type rkmTags struct {
+	routingKey, regResult, deregResult      uint16
+	localID, regStatus, deregStatus, netApp uint16
+}
+
+var (
+	m3uaRKM = rkmTags{
+		routingKey: 0x0207, regResult: 0x0208, deregResult: 0x0209,
+		localID: 0x020a, regStatus: 0x0212, deregStatus: 0x0213, netApp: 0x0200}
+	suaRKM = rkmTags{
+		routingKey: 0x010e, regResult: 0x0014, deregResult: 0x0015,
+		localID: 0x0018, regStatus: 0x0016, deregStatus: 0x0017, netApp: 0x010d}
+)
+
+func rkmTagsOf(sua bool) rkmTags {
+	if sua {
+		return suaRKM
+	}
+	return m3uaRKM
+}
+
+/*
+routingKey is Routing Key parameter.
+
+M3UA Routing Key (Tag = 0x0207)
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Local-RK-Identifier                       |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                  Routing Context (Optional)                   |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                 Traffic Mode Type (Optional)                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                    Destination Point Code                     |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                Network Appearance (Optional)                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                Service Indicators (Optional)                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+SUA Routing Key (Tag = 0x010E)
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Local-RK-Identifier                       |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                 Traffic Mode Type (Optional)                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                Network Appearance (Optional)                  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|          Destination Address (Optional, repeatable)           |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|              Address Range (Optional, repeatable)             |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+type routingKey struct {
+	id   uint32
+	ctx  uint32
+	mode uint32
+	na   *uint32
+	dpc  PointCode
+	si   []uint8
+	addr []SCCPAddr
+}
+
+func (k routingKey) equal(o routingKey) bool {
+	return k.dpc == o.dpc &&
+		bytes.Equal(k.si, o.si) &&
+		fmt.Sprint(k.addr) == fmt.Sprint(o.addr)
+}
+
+func (k routingKey) marshal(sua bool) []byte {
+	tags := rkmTagsOf(sua)
+	buf := new(bytes.Buffer)
+
+	writeUint32(buf, tags.localID, k.id)
+	if k.ctx != 0 && !sua {
+		writeUint32(buf, 0x0006, k.ctx)
+	}
+	if k.mode != 0 {
+		writeUint32(buf, 0x000b, k.mode)
+	}
+	if !sua {
+		writeUint32(buf, 0x020b, uint32(k.dpc)&0x00ffffff)
+	}
+	if k.na != nil {
+		writeUint32(buf, tags.netApp, *k.na)
+	}
+	if len(k.si) != 0 {
+		binary.Write(buf, binary.BigEndian, uint16(0x020c))
+		binary.Write(buf, binary.BigEndian, uint16(4+len(k.si)))
+		buf.Write(k.si)
+		if len(k.si)%4 != 0 {
+			buf.Write(make([]byte, 4-len(k.si)%4))
+		}
+	}
+	for _, a := range k.addr {
+		writeSUAAddr(buf, 0x0103, a)
+	}
+	return buf.Bytes()
+}
+
+func (k *routingKey) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x020a, 0x0018: // Local-RK-Identifier
+		k.id, e = readUint32(r, l)
+	case 0x0006: // Routing Context (Optional)
+		k.ctx, e = readUint32(r, l)
+	case 0x000b: // Traffic Mode Type (Optional)
+		k.mode, e = readUint32(r, l)
+	case 0x020b: // Destination Point Code
+		var pc uint32
+		if pc, e = readUint32(r, l); e == nil {
+			k.dpc = PointCode(pc & 0x00ffffff)
+		}
+	case 0x0200, 0x010d: // Network Appearance (Optional)
+		var na uint32
+		if na, e = readUint32(r, l); e == nil {
+			k.na = &na
+		}
+	case 0x020c: // Service Indicators (Optional)
+		k.si = make([]byte, l)
+		_, e = r.Read(k.si)
+	case 0x0103: // Destination Address (Optional)
+		var a SCCPAddr
+		if a, e = readSUAAddr(r, l); e == nil {
+			k.addr = append(k.addr, a)
+		}
+	case 0x0111: // Address Range (Optional)
+		e = readParams(r, l, func(t, l uint16, r io.ReadSeeker) (e error) {
+			if t != 0x0102 && t != 0x0103 {
+				_, e = r.Seek(int64(l), io.SeekCurrent)
+				return
+			}
+			var a SCCPAddr
+			if a, e = readSUAAddr(r, l); e == nil {
+				k.addr = append(k.addr, a)
+			}
+			return
+		})
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+// writeParams writes parameter with tag t that contains
+// parameters in b.
+func writeParams(w io.Writer, t uint16, b []byte) {
+	binary.Write(w, binary.BigEndian, t)
+	binary.Write(w, binary.BigEndian, uint16(4+len(b)))
+	w.Write(b)
+}
+
+// readParams reads parameters in l bytes of r and calls f for each parameter.
+func readParams(r io.ReadSeeker, l uint16,
+	f func(uint16, uint16, io.ReadSeeker) error) error {
+	d := make([]byte, l)
+	if _, e := io.ReadFull(r, d); e != nil {
+		return e
+	}
+	for buf := bytes.NewReader(d); buf.Len() > 4; {
+		var t, l uint16
+		binary.Read(buf, binary.BigEndian, &t)
+		binary.Read(buf, binary.BigEndian, &l)
+		l -= 4
+		if e := f(t, l, buf); e != nil {
+			return e
+		}
+		if l%4 != 0 {
+			buf.Seek(int64(4-l%4), io.SeekCurrent)
+		}
+	}
+	return nil
+}
+
+/*
+REGREQ is Registration Request message. (Message type = 0x01)
+Direction is ASP -> SGP.
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0207 / 0x010E     |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                         Routing Key 1                         /
+	\                                                               \
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                              ...                              /
+	\                                                               \
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0207 / 0x010E     |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                         Routing Key n                         /
+	\                                                               \
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+type REGREQ struct {
+	sua  bool
+	keys []routingKey
+
+	result chan error
+}
+type RxREGREQ REGREQ
+
+func (m *REGREQ) handleMessage(c *ASP) {
+	if e := c.handleCtrlReq(m); e != nil {
+		m.result <- e
+	}
+}
+
+// handleResult sets routing context in REG RSP to keys.
+func (m *REGREQ) handleResult(msg message) {
+	switch res := msg.(type) {
+	case *ERR:
+		m.result <- fmt.Errorf("error with code %s", res.code)
+	case *REGRSP:
+		for i, k := range m.keys {
+			ok := false
+			for _, r := range res.results {
+				if r.id != k.id {
+					continue
+				}
+				if r.status != Registered &&
+					(r.status != RegAlreadyRegistered || r.ctx == 0) {
+					m.result <- fmt.Errorf("registration failed: %s", r.status)
+					return
+				}
+				m.keys[i].ctx = r.ctx
+				ok = true
+			}
+			if !ok {
+				m.result <- fmt.Errorf("no registration result")
+				return
+			}
+		}
+		m.result <- nil
+	default:
+		m.result <- fmt.Errorf("unexpected result")
+	}
+}
+
+func (m *REGREQ) marshal() (uint8, uint8, []byte) {
+	tags := rkmTagsOf(m.sua)
+	buf := new(bytes.Buffer)
+
+	for _, k := range m.keys {
+		writeParams(buf, tags.routingKey, k.marshal(m.sua))
+	}
+	return 0x09, 0x01, buf.Bytes()
+}
+
+func (m *RxREGREQ) handleMessage(c *ASP) { c.se.handleREGREQ(c, m.keys) }
+
+func (m *RxREGREQ) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0207, 0x010e: // Routing Key
+		k := routingKey{}
+		if e = readParams(r, l, k.unmarshal); e == nil {
+			m.keys = append(m.keys, k)
+		}
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+/*
+REGRSP is Registration Response message. (Message type = 0x02)
+Direction is SGP -> ASP.
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0208 / 0x0014     |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x020A / 0x0018     |             Length = 8        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Local-RK-Identifier                       |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0212 / 0x0016     |             Length = 8        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                      Registration Status                      |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|         Tag = 0x0006          |             Length = 8        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                        Routing Context                        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                              ...                              /
+*/
+type REGRSP struct {
+	sua     bool
+	results []regResult
+}
+type TxREGRSP REGRSP
+
+type regResult struct {
+	id     uint32
+	status RegistrationStatus
+	ctx    uint32
+}
+
+func (m *REGRSP) handleMessage(c *ASP) { c.handleCtrlAns(m) }
+
+func (m *REGRSP) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0208, 0x0014: // Registration Result
+		res := regResult{}
+		e = readParams(r, l, func(t, l uint16, r io.ReadSeeker) (e error) {
+			var v uint32
+			switch t {
+			case 0x020a, 0x0018: // Local-RK-Identifier
+				res.id, e = readUint32(r, l)
+			case 0x0212, 0x0016: // Registration Status
+				v, e = readUint32(r, l)
+				res.status = RegistrationStatus(v)
+			case 0x0006: // Routing Context
+				res.ctx, e = readUint32(r, l)
+			default:
+				_, e = r.Seek(int64(l), io.SeekCurrent)
+			}
+			return
+		})
+		if e == nil {
+			m.results = append(m.results, res)
+		}
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+func (m *TxREGRSP) handleMessage(c *ASP) { c.write(m) }
+func (m *TxREGRSP) handleResult(message) {}
+
+func (m *TxREGRSP) marshal() (uint8, uint8, []byte) {
+	tags := rkmTagsOf(m.sua)
+	buf := new(bytes.Buffer)
+
+	for _, res := range m.results {
+		b := new(bytes.Buffer)
+		writeUint32(b, tags.localID, res.id)
+		writeUint32(b, tags.regStatus, uint32(res.status))
+		writeUint32(b, 0x0006, res.ctx)
+		writeParams(buf, tags.regResult, b.Bytes())
+	}
+	return 0x09, 0x02, buf.Bytes()
+}
+
+/*
+DEREGREQ is Deregistration Request message. (Message type = 0x03)
+Direction is ASP -> SGP.
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|          Tag = 0x0006         |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                       Routing Context                         /
+	\                                                               \
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+type DEREGREQ struct {
+	sua bool
+	ctx []uint32
+
+	result chan error
+}
+type RxDEREGREQ DEREGREQ
+
+func (m *DEREGREQ) handleMessage(c *ASP) {
+	if e := c.handleCtrlReq(m); e != nil {
+		m.result <- e
+	}
+}
+
+func (m *DEREGREQ) handleResult(msg message) {
+	switch res := msg.(type) {
+	case *ERR:
+		m.result <- fmt.Errorf("error with code %s", res.code)
+	case *DEREGRSP:
+		for _, r := range res.results {
+			if r.status != Deregistered {
+				m.result <- fmt.Errorf(
+					"deregistration of context %d failed: %s", r.ctx, r.status)
+				return
+			}
+		}
+		m.result <- nil
+	default:
+		m.result <- fmt.Errorf("unexpected result")
+	}
+}
+
+func (m *DEREGREQ) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.BigEndian, uint16(0x0006))
+	binary.Write(buf, binary.BigEndian, uint16(4+len(m.ctx)*4))
+	for _, c := range m.ctx {
+		binary.Write(buf, binary.BigEndian, c)
+	}
+	return 0x09, 0x03, buf.Bytes()
+}
+
+func (m *RxDEREGREQ) handleMessage(c *ASP) { c.se.handleDEREGREQ(c, m.ctx) }
+
+func (m *RxDEREGREQ) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0006: // Routing Context
+		if l%4 != 0 {
+			return fmt.Errorf("invalid length of parameter")
+		}
+		m.ctx = make([]uint32, l/4)
+		e = binary.Read(r, binary.BigEndian, m.ctx)
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+/*
+DEREGRSP is Deregistration Response message. (Message type = 0x04)
+Direction is SGP -> ASP.
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0209 / 0x0015     |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|         Tag = 0x0006          |             Length = 8        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                        Routing Context                        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|     Tag = 0x0213 / 0x0017     |             Length = 8        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Deregistration Status                     |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	/                              ...                              /
+*/
+type DEREGRSP struct {
+	sua     bool
+	results []deregResult
+}
+type TxDEREGRSP DEREGRSP
+
+type deregResult struct {
+	ctx    uint32
+	status DeregistrationStatus
+}
+
+func (m *DEREGRSP) handleMessage(c *ASP) { c.handleCtrlAns(m) }
+
+func (m *DEREGRSP) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0209, 0x0015: // Deregistration Result
+		res := deregResult{}
+		e = readParams(r, l, func(t, l uint16, r io.ReadSeeker) (e error) {
+			var v uint32
+			switch t {
+			case 0x0006: // Routing Context
+				res.ctx, e = readUint32(r, l)
+			case 0x0213, 0x0017: // Deregistration Status
+				v, e = readUint32(r, l)
+				res.status = DeregistrationStatus(v)
+			default:
+				_, e = r.Seek(int64(l), io.SeekCurrent)
+			}
+			return
+		})
+		if e == nil {
+			m.results = append(m.results, res)
+		}
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
+func (m *TxDEREGRSP) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDEREGRSP) handleResult(message) {}
+
+func (m *TxDEREGRSP) marshal() (uint8, uint8, []byte) {
+	tags := rkmTagsOf(m.sua)
+	buf := new(bytes.Buffer)
+
+	for _, res := range m.results {
+		b := new(bytes.Buffer)
+		writeUint32(b, 0x0006, res.ctx)
+		writeUint32(b, tags.deregStatus, uint32(res.status))
+		writeParams(buf, tags.deregResult, b.Bytes())
+	}
+	return 0x09, 0x04, buf.Bytes()
+}
@@ -0,0 +1,455 @@
+package xua
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+SCCP connectionless messages carried in M3UA DATA
+
+Unitdata (UDT)
+
+	Message type code     F 1 octet
+	Protocol class        F 1 octet
+	Called party address  V 3- octets
+	Calling party address V 3- octets
+	Data                  V 2- octets
+
+Unitdata Service (UDTS)
+
+	Message type code     F 1 octet
+	Return cause          F 1 octet
+	Called party address  V 3- octets
+	Calling party address V 3- octets
+	Data                  V 2- octets
+
+Extended unitdata (XUDT)
+
+	Message type code     F 1 octet
+	Protocol class        F 1 octet
+	Hop counter           F 1 octet
+	Called party address  V 3- octets
+	Calling party address V 3- octets
+	Data                  V 2- octets
+	Segmentation          O 6 octets
+	Importance            O 3 octets
+	End of optional       O 1 octet
+
+Extended unitdata service (XUDTS)
+
+	Message type code     F 1 octet
+	Return cause          F 1 octet
+	Hop counter           F 1 octet
+	Called party address  V 3- octets
+	Calling party address V 3- octets
+	Data                  V 2- octets
+	Segmentation          O 6 octets
+	Importance            O 3 octets
+	End of optional       O 1 octet
+
+Long unitdata (LUDT) and Long unitdata service (LUDTS) have same
+parameters with XUDT and XUDTS, but pointers and length of Data are 2 octets.
+*/
+
+const (
+	udt   byte = 0x09
+	udts  byte = 0x0a
+	xudt  byte = 0x11
+	xudts byte = 0x12
+	ludt  byte = 0x13
+	ludts byte = 0x14
+)
+
+const (
+	defaultSegmentSize = 220
+	defaultHopCounter  = 15
+	maxSegments        = 16
+	maxLongData        = 3952
+)
+
+/*
+segmentation is Segmentation parameter of XUDT, XUDTS, LUDT and LUDTS.
+
+	  8   7   6   5   4   3   2   1
+	+---+---+---+---+---------------+
+	| F | C | spare | Remaining seg.|
+	+---+---+---+---+---------------+
+	|   Segmentation local reference |
+	|            (3 octets)          |
+	+--------------------------------+
+*/
+type segmentation struct {
+	first  bool
+	class  uint8
+	remain uint8
+	ref    uint32
+}
+
+func (s segmentation) marshal() []byte {
+	b := make([]byte, 4)
+	if s.first {
+		b[0] |= 0x80
+	}
+	b[0] |= (s.class & 0x01) << 6
+	b[0] |= s.remain & 0x0f
+	b[1] = byte(s.ref >> 16)
+	b[2] = byte(s.ref >> 8)
+	b[3] = byte(s.ref)
+	return b
+}
+
+func unmarshalSegmentation(b []byte) (s *segmentation, e error) {
+	if len(b) != 4 {
+		e = errors.New("invalid length of segmentation")
+		return
+	}
+	s = &segmentation{
+		first:  b[0]&0x80 == 0x80,
+		class:  (b[0] >> 6) & 0x01,
+		remain: b[0] & 0x0f,
+		ref:    uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])}
+	return
+}
+
+func (d *userData) isExtended() bool {
+	return d.segment != nil || d.hopCount != 0 || d.importance != nil
+}
+
+// marshalSCCP returns SCCP connectionless message.
+// UDT/UDTS, XUDT/XUDTS or LUDT/LUDTS is selected by parameters of the data.
+func (d *userData) marshalSCCP(long bool, v Variant) []byte {
+	buf := new(bytes.Buffer)
+	cdpa := d.cdpa.marshalSCCP(v)
+	cgpa := d.cgpa.marshalSCCP(v)
+
+	var typ byte
+	switch {
+	case long:
+		typ = ludt
+	case d.isExtended():
+		typ = xudt
+	default:
+		typ = udt
+	}
+	if d.cause != Success {
+		typ++ // UDTS, XUDTS or LUDTS
+		buf.WriteByte(typ)
+		buf.WriteByte(byte(d.cause & 0x00ff))
+	} else {
+		buf.WriteByte(typ)
+		if d.returnOnError {
+			buf.WriteByte((d.protocolClass & 0x0f) | 0x80)
+		} else {
+			buf.WriteByte(d.protocolClass & 0x0f)
+		}
+	}
+
+	if typ == udt || typ == udts {
+		buf.WriteByte(3)
+		buf.WriteByte(byte(3 + len(cdpa)))
+		buf.WriteByte(byte(3 + len(cdpa) + len(cgpa)))
+
+		buf.WriteByte(byte(len(cdpa)))
+		buf.Write(cdpa)
+		buf.WriteByte(byte(len(cgpa)))
+		buf.Write(cgpa)
+		buf.WriteByte(byte(len(d.data)))
+		buf.Write(d.data)
+		return buf.Bytes()
+	}
+
+	if d.hopCount == 0 {
+		buf.WriteByte(defaultHopCounter)
+	} else {
+		buf.WriteByte(d.hopCount)
+	}
+
+	opt := new(bytes.Buffer)
+	if d.segment != nil {
+		opt.WriteByte(0x10)
+		opt.WriteByte(4)
+		opt.Write(d.segment.marshal())
+	}
+	if d.importance != nil {
+		opt.WriteByte(0x12)
+		opt.WriteByte(1)
+		opt.WriteByte(*d.importance & 0x07)
+	}
+	if opt.Len() != 0 {
+		opt.WriteByte(0x00) // End of optional parameters
+	}
+
+	if long {
+		ptr := []uint16{
+			8,
+			uint16(7 + len(cdpa)),
+			uint16(6 + len(cdpa) + len(cgpa)),
+			0}
+		if opt.Len() != 0 {
+			ptr[3] = uint16(6 + len(cdpa) + len(cgpa) + len(d.data))
+		}
+		for _, p := range ptr {
+			binary.Write(buf, binary.LittleEndian, p)
+		}
+		buf.WriteByte(byte(len(cdpa)))
+		buf.Write(cdpa)
+		buf.WriteByte(byte(len(cgpa)))
+		buf.Write(cgpa)
+		binary.Write(buf, binary.LittleEndian, uint16(len(d.data)))
+		buf.Write(d.data)
+	} else {
+		buf.WriteByte(4)
+		buf.WriteByte(byte(4 + len(cdpa)))
+		buf.WriteByte(byte(4 + len(cdpa) + len(cgpa)))
+		if opt.Len() != 0 {
+			buf.WriteByte(byte(4 + len(cdpa) + len(cgpa) + len(d.data)))
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.WriteByte(byte(len(cdpa)))
+		buf.Write(cdpa)
+		buf.WriteByte(byte(len(cgpa)))
+		buf.Write(cgpa)
+		buf.WriteByte(byte(len(d.data)))
+		buf.Write(d.data)
+	}
+	opt.WriteTo(buf)
+	return buf.Bytes()
+}
+
+// unmarshalSCCP decodes SCCP connectionless message.
+func (d *userData) unmarshalSCCP(b []byte, v Variant) (e error) {
+	if len(b) < 2 {
+		return errors.New("too short SCCP message")
+	}
+
+	typ := b[0]
+	switch typ {
+	case udt, xudt, ludt:
+		d.returnOnError = b[1]&0x80 == 0x80
+		d.protocolClass = b[1] & 0x0f
+	case udts, xudts, ludts:
+		d.cause = Cause(b[1]) | 0x0100
+	default:
+		return fmt.Errorf("unknown SCCP message type(%x)", typ)
+	}
+
+	var ptr []int
+	switch typ {
+	case udt, udts:
+		if len(b) < 5 {
+			return errors.New("too short SCCP message")
+		}
+		for i := 2; i < 5; i++ {
+			if b[i] == 0 {
+				return errors.New("invalid pointer")
+			}
+			ptr = append(ptr, i+int(b[i]))
+		}
+	case xudt, xudts:
+		if len(b) < 7 {
+			return errors.New("too short SCCP message")
+		}
+		d.hopCount = b[2]
+		for i := 3; i < 7; i++ {
+			if b[i] == 0 && i < 6 {
+				return errors.New("invalid pointer")
+			} else if b[i] == 0 {
+				ptr = append(ptr, 0)
+			} else {
+				ptr = append(ptr, i+int(b[i]))
+			}
+		}
+	case ludt, ludts:
+		if len(b) < 11 {
+			return errors.New("too short SCCP message")
+		}
+		d.hopCount = b[2]
+		for i := 3; i < 11; i += 2 {
+			if p := int(binary.LittleEndian.Uint16(b[i:])); p == 0 && i < 9 {
+				return errors.New("invalid pointer")
+			} else if p == 0 {
+				ptr = append(ptr, 0)
+			} else {
+				ptr = append(ptr, i+p)
+			}
+		}
+	}
+
+	if _, e = readVariable(b, ptr[0], false); e != nil {
+		return
+	} else if d.cdpa, e = readSCCPAddr(bytes.NewReader(b[ptr[0]:]), v); e != nil {
+		return
+	}
+	if _, e = readVariable(b, ptr[1], false); e != nil {
+		return
+	} else if d.cgpa, e = readSCCPAddr(bytes.NewReader(b[ptr[1]:]), v); e != nil {
+		return
+	}
+	if d.data, e = readVariable(b, ptr[2], typ == ludt || typ == ludts); e != nil {
+		return
+	}
+
+	if len(ptr) < 4 || ptr[3] == 0 {
+		return
+	}
+	for i := ptr[3]; i < len(b) && b[i] != 0x00; {
+		if i+1 >= len(b) || i+2+int(b[i+1]) > len(b) {
+			return errors.New("invalid optional parameter")
+		}
+		v := b[i+2 : i+2+int(b[i+1])]
+		switch b[i] {
+		case 0x10: // Segmentation
+			if d.segment, e = unmarshalSegmentation(v); e != nil {
+				return
+			}
+		case 0x12: // Importance
+			if len(v) != 1 {
+				return errors.New("invalid length of importance")
+			}
+			tmp := v[0] & 0x07
+			d.importance = &tmp
+		}
+		i += 2 + len(v)
+	}
+	return
+}
+
+func readVariable(b []byte, p int, long bool) ([]byte, error) {
+	if long {
+		if p+2 > len(b) {
+			return nil, errors.New("invalid pointer")
+		}
+		l := int(binary.LittleEndian.Uint16(b[p:]))
+		if p+2+l > len(b) {
+			return nil, errors.New("invalid length of parameter")
+		}
+		return b[p+2 : p+2+l], nil
+	}
+	if p >= len(b) {
+		return nil, errors.New("invalid pointer")
+	}
+	l := int(b[p])
+	if p+1+l > len(b) {
+		return nil, errors.New("invalid length of parameter")
+	}
+	return b[p+1 : p+1+l], nil
+}
+
+// maxSCCPData returns maximum length of data in one XUDT with the addresses,
+// so that pointers and length of the XUDT are fit in one octet.
+func (d *userData) maxSCCPData(v Variant) int {
+	return 0xff - 4 - len(d.cdpa.marshalSCCP(v)) - len(d.cgpa.marshalSCCP(v))
+}
+
+// split splits data to XUDT segments which have data less than size.
+func (d userData) split(size int, ref uint32) (r []userData, e error) {
+	n := (len(d.data) + size - 1) / size
+	if n > maxSegments {
+		e = fmt.Errorf("too large data (%d octets) for segmentation", len(d.data))
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		s := d
+		s.protocolClass = 1
+		s.segment = &segmentation{
+			first:  i == 0,
+			class:  d.protocolClass & 0x01,
+			remain: uint8(n - i - 1),
+			ref:    ref & 0x00ffffff}
+		if i == n-1 {
+			s.data = d.data[i*size:]
+		} else {
+			s.data = d.data[i*size : (i+1)*size]
+		}
+		r = append(r, s)
+	}
+	return
+}
+
+type reassembly struct {
+	userData
+	remain uint8
+	timer  *time.Timer
+}
+
+func reassemblyKey(d userData) string {
+	return fmt.Sprintf("%06x:%x:%d:%d",
+		d.segment.ref, d.cgpa.GlobalTitle.Digits,
+		d.cgpa.PointCode, d.cgpa.SubsystemNumber)
+}
+
+// reassemble handles received segment and returns reassembled data
+// if it is the last segment.
+func (se *SignalingEndpoint) reassemble(d userData) (r userData, ok bool) {
+	if d.segment == nil {
+		return d, true
+	}
+	if d.segment.first && d.segment.remain == 0 {
+		d.protocolClass = d.segment.class
+		d.segment = nil
+		return d, true
+	}
+
+	key := reassemblyKey(d)
+	segs := <-se.segments
+	defer func() { se.segments <- segs }()
+
+	buf, found := segs[key]
+	switch {
+	case d.segment.first:
+		if found {
+			buf.timer.Stop()
+			if RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf(
+					"segmentation failure: restarted by new first segment"), buf.data)
+			}
+		}
+		n := &reassembly{userData: d, remain: d.segment.remain}
+		n.data = append([]byte{}, d.data...)
+		n.timer = time.AfterFunc(treass, func() {
+			segs := <-se.segments
+			expired := segs[key] == n
+			if expired {
+				delete(segs, key)
+			}
+			se.segments <- segs
+
+			if expired && RxFailureNotify != nil {
+				RxFailureNotify(fmt.Errorf(
+					"segmentation failure: reassembly timer expired"), n.data)
+			}
+		})
+		segs[key] = n
+		return
+
+	case !found || d.segment.remain != buf.remain-1:
+		if found {
+			buf.timer.Stop()
+			delete(segs, key)
+		}
+		if RxFailureNotify != nil {
+			RxFailureNotify(fmt.Errorf(
+				"segmentation failure: unexpected segment"), d.data)
+		}
+		return
+	}
+
+	buf.remain = d.segment.remain
+	buf.data = append(buf.data, d.data...)
+	if buf.remain != 0 {
+		return
+	}
+
+	buf.timer.Stop()
+	delete(segs, key)
+	r = buf.userData
+	r.protocolClass = r.segment.class
+	r.segment = nil
+	return r, true
+}
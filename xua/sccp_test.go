@@ -0,0 +1,138 @@
+package xua
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+func TestSegmentSize(t *testing.T) {
+	gt, _ := teldata.ParseTBCD("819012345678901234567890123456")
+	ud := userData{data: bytes.Repeat([]byte{0x5a}, 1000)}
+	ud.cdpa = SCCPAddr{
+		RoutingIndicator: RouteOnGT,
+		SubsystemNumber:  6,
+		GlobalTitle: teldata.GlobalTitle{
+			NumberingPlan:   teldata.ISDNTelephony,
+			NatureOfAddress: teldata.International,
+			Digits:          gt}}
+	ud.cgpa = ud.cdpa
+
+	size := ud.maxSCCPData(ITU)
+	uds, e := ud.split(size, 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data := []byte{}
+	for _, s := range uds {
+		b := s.marshalSCCP(false, ITU)
+		r := userData{}
+		if e := r.unmarshalSCCP(b, ITU); e != nil {
+			t.Fatal(e)
+		}
+		if r.segment == nil {
+			t.Fatalf("no segmentation in %x", b)
+		}
+		data = append(data, r.data...)
+	}
+	if !bytes.Equal(data, ud.data) {
+		t.Fatalf("unexpected data %x", data)
+	}
+}
+
+// segmentsOf returns data and its 3 segments.
+func segmentsOf(t *testing.T) (userData, []userData) {
+	ud := userData{
+		data: bytes.Repeat([]byte{0x01, 0x02, 0x03}, 100),
+		cgpa: SCCPAddr{PointCode: 1, SubsystemNumber: 6},
+		cdpa: SCCPAddr{PointCode: 2, SubsystemNumber: 7}}
+	segs, e := ud.split(120, 0x123456)
+	if e != nil || len(segs) != 3 {
+		t.Fatalf("unexpected segments %v, %v", segs, e)
+	}
+	return ud, segs
+}
+
+func TestReassemble(t *testing.T) {
+	var failures []string
+	RxFailureNotify = func(e error, _ []byte) { failures = append(failures, e.Error()) }
+	t.Cleanup(func() { RxFailureNotify = nil })
+
+	ud, segs := segmentsOf(t)
+	for _, tc := range []struct {
+		name    string
+		order   []int
+		ok      bool
+		failure string
+	}{
+		{"in order", []int{0, 1, 2}, true, ""},
+		{"out of order", []int{0, 2, 1}, false, "unexpected segment"},
+		{"missing middle", []int{0, 2}, false, "unexpected segment"},
+		{"missing first", []int{1, 2}, false, "unexpected segment"},
+		{"restarted", []int{0, 1, 0, 1, 2}, true, "restarted by new first segment"},
+	} {
+		failures = nil
+		se := &SignalingEndpoint{segments: make(chan map[string]*reassembly, 1)}
+		se.segments <- map[string]*reassembly{}
+
+		var r userData
+		ok := false
+		for _, i := range tc.order {
+			if r, ok = se.reassemble(segs[i]); ok {
+				break
+			}
+		}
+		if ok != tc.ok {
+			t.Errorf("%s: reassembled=%t", tc.name, ok)
+		} else if ok && (!bytes.Equal(r.data, ud.data) ||
+			r.segment != nil || r.protocolClass != ud.protocolClass) {
+			t.Errorf("%s: unexpected data %+v", tc.name, r)
+		}
+		if tc.failure == "" && len(failures) != 0 ||
+			tc.failure != "" && (len(failures) == 0 ||
+				!strings.Contains(failures[0], tc.failure)) {
+			t.Errorf("%s: unexpected failures %v", tc.name, failures)
+		}
+		if segs := <-se.segments; len(segs) != 0 {
+			t.Errorf("%s: segments remain %v", tc.name, segs)
+		}
+	}
+}
+
+func TestReassembleExpired(t *testing.T) {
+	failure := make(chan error, 1)
+	RxFailureNotify = func(e error, _ []byte) { failure <- e }
+	d := treass
+	treass = time.Millisecond * 50
+	t.Cleanup(func() {
+		RxFailureNotify = nil
+		treass = d
+	})
+
+	se := &SignalingEndpoint{segments: make(chan map[string]*reassembly, 1)}
+	se.segments <- map[string]*reassembly{}
+	_, segs := segmentsOf(t)
+	se.reassemble(segs[0])
+	se.reassemble(segs[1])
+
+	select {
+	case e := <-failure:
+		if !strings.Contains(e.Error(), "reassembly timer expired") {
+			t.Fatalf("unexpected failure %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reassembly timer is not expired")
+	}
+	if m := <-se.segments; len(m) != 0 {
+		t.Fatalf("segments remain %v", m)
+	} else {
+		se.segments <- m
+	}
+	// last segment after expiry is not reassembled
+	if _, ok := se.reassemble(segs[2]); ok {
+		t.Fatal("expired segments are reassembled")
+	}
+}
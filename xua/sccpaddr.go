@@ -3,6 +3,7 @@ package xua
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -68,46 +69,165 @@ Translation type
 	255            Reserved
 */
 type SCCPAddr struct {
-	// RoutingIndicator
+	RoutingIndicator RoutingIndicator `json:"ri,omitempty"`
 	// GlobalTitleIndicator
 
 	GlobalTitle     teldata.GlobalTitle     `json:"gt,omitempty"`
-	PointCode       uint32                  `json:"pc,omitempty"`
+	PointCode       PointCode               `json:"pc,omitempty"`
 	SubsystemNumber teldata.SubsystemNumber `json:"ssn,omitempty"`
 }
 
-func (a *SCCPAddr) marshalSCCP() []byte {
+/*
+RoutingIndicator is routing indicator of SCCP address.
+If RouteAuto, route on SSN is used when both point code and SSN exist,
+otherwise route on GT is used.
+*/
+type RoutingIndicator uint8
+
+const (
+	RouteAuto RoutingIndicator = iota
+	RouteOnGT
+	RouteOnSSN
+)
+
+func (r RoutingIndicator) String() string {
+	switch r {
+	case RouteOnGT:
+		return "gt"
+	case RouteOnSSN:
+		return "ssn"
+	}
+	return ""
+}
+
+func (r *RoutingIndicator) UnmarshalJSON(b []byte) (e error) {
+	var s string
+	if e = json.Unmarshal(b, &s); e != nil {
+		return
+	}
+	switch s {
+	case "gt":
+		*r = RouteOnGT
+	case "ssn":
+		*r = RouteOnSSN
+	case "":
+		*r = RouteAuto
+	default:
+		e = fmt.Errorf("invalid routing indicator %s", s)
+	}
+	return
+}
+
+func (r RoutingIndicator) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// routeOnSSN returns true if the address is routed on SSN.
+func (a *SCCPAddr) routeOnSSN() bool {
+	switch a.RoutingIndicator {
+	case RouteOnGT:
+		return false
+	case RouteOnSSN:
+		return true
+	}
+	return a.PointCode != 0 && a.SubsystemNumber != 0
+}
+
+/*
+Variant is variant of SCCP address format in M3UA.
+
+	          | AI: PC / SSN bit | order   | point code | GTI
+	----------+------------------+---------+------------+-------------
+	ITU       | 0x01 / 0x02      | PC, SSN | 14 bits    | 1, 2, 3, 4
+	ANSI      | 0x02 / 0x01      | SSN, PC | 24 bits    | 1, 2
+	TTC (NTT) | 0x01 / 0x02      | SSN, PC | 16 bits    | 1, 2, 3, 4
+
+National indicator bit of address indicator is set for ANSI and TTC.
+GTI 1 of ANSI has translation type, numbering plan and encoding scheme,
+and GTI 2 of ANSI has translation type only.
+*/
+type Variant uint8
+
+const (
+	ITU Variant = iota
+	ANSI
+	TTC
+)
+
+func (v Variant) String() string {
+	switch v {
+	case ITU:
+		return "ITU"
+	case ANSI:
+		return "ANSI"
+	case TTC:
+		return "TTC"
+	}
+	return ""
+}
+
+func (a *SCCPAddr) marshalSCCP(v Variant) []byte {
 	buf := new(bytes.Buffer)
 
 	var ai byte = 0x00
+	pci, ssni := byte(0x01), byte(0x02)
+	if v == ANSI {
+		pci, ssni = 0x02, 0x01
+	}
+	if v != ITU {
+		ai |= 0x80 // national
+	}
 	buf.WriteByte(ai)
-	if a.PointCode != 0 {
-		binary.Write(buf, binary.LittleEndian, uint16(a.PointCode))
-		ai |= 0x01
+
+	writePC := func() {
+		if a.PointCode == 0 {
+			return
+		}
+		switch v {
+		case ANSI:
+			buf.Write([]byte{
+				byte(a.PointCode), byte(a.PointCode >> 8), byte(a.PointCode >> 16)})
+		default:
+			binary.Write(buf, binary.LittleEndian, uint16(a.PointCode))
+		}
+		ai |= pci
 	}
-	if a.SubsystemNumber != 0 {
-		buf.WriteByte(a.SubsystemNumber.Uint())
-		ai |= 0x02
+	writeSSN := func() {
+		if a.SubsystemNumber != 0 {
+			buf.WriteByte(a.SubsystemNumber.Uint())
+			ai |= ssni
+		}
 	}
-	if a.PointCode != 0 && a.SubsystemNumber != 0 {
+	if v == ITU {
+		writePC()
+		writeSSN()
+	} else {
+		writeSSN()
+		writePC()
+	}
+	if a.routeOnSSN() {
 		ai |= 0x40
 	}
 
 	if !a.GlobalTitle.IsEmpty() {
 		isOdd := a.GlobalTitle.Digits[len(a.GlobalTitle.Digits)-1]&0xf0 == 0xf0
-		var nai byte = 0x00
-		switch a.GlobalTitle.NatureOfAddress {
-		case teldata.International:
-			nai = 0x04
-		case teldata.NationalSignificant:
-			nai = 0x03
-		case teldata.NetworkSpecific:
-			nai = 0x02
-		case teldata.Subscriber:
-			nai = 0x01
+		nai := naiToByte(a.GlobalTitle.NatureOfAddress)
+		es := byte(0x02)
+		if isOdd {
+			es = 0x01
 		}
 
-		if a.GlobalTitle.TranslationType == 0 &&
+		if v == ANSI {
+			if a.GlobalTitle.NumberingPlan == teldata.UnknownNP {
+				ai |= 0x08 // TT only --0010--
+				buf.WriteByte(a.GlobalTitle.TranslationType)
+			} else {
+				ai |= 0x04 // TT, NP and ES --0001--
+				buf.WriteByte(a.GlobalTitle.TranslationType)
+				buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4) | es)
+			}
+
+		} else if a.GlobalTitle.TranslationType == 0 &&
 			a.GlobalTitle.NumberingPlan == teldata.UnknownNP {
 			ai |= 0x04 // NAI only --0001--
 			if isOdd {
@@ -124,24 +244,16 @@ func (a *SCCPAddr) marshalSCCP() []byte {
 		} else if a.GlobalTitle.NatureOfAddress == teldata.UnknownNA {
 			ai |= 0x0c // TT and NPI --0011--
 			buf.WriteByte(a.GlobalTitle.TranslationType)
-			if isOdd {
-				buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4 | 0x01))
-			} else {
-				buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4 | 0x02))
-			}
+			buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4) | es)
 
 		} else {
 			ai |= 0x10 // TT, NPI and NAI --0100--
 			buf.WriteByte(a.GlobalTitle.TranslationType)
-			if isOdd {
-				buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4 | 0x01))
-			} else {
-				buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4 | 0x02))
-			}
+			buf.WriteByte(byte(a.GlobalTitle.NumberingPlan<<4) | es)
 			buf.WriteByte(nai)
 		}
 
-		dig := a.GlobalTitle.Digits.Bytes()
+		dig := append([]byte{}, a.GlobalTitle.Digits.Bytes()...)
 		for i := range dig {
 			if 0xf0&dig[i] == 0xf0 {
 				dig[i] = 0x0f & dig[i]
@@ -158,61 +270,113 @@ func (a *SCCPAddr) marshalSCCP() []byte {
 	return b
 }
 
-func readSCCPAddr(buf *bytes.Reader) (a SCCPAddr, e error) {
+func readSCCPAddr(buf *bytes.Reader, v Variant) (a SCCPAddr, e error) {
 	var t byte
 	if t, e = buf.ReadByte(); e != nil {
 		return
+	} else if t == 0 {
+		e = fmt.Errorf("empty SCCP address")
+		return
 	}
 	d := make([]byte, t)
-	if _, e = buf.Read(d); e != nil {
+	if _, e = io.ReadFull(buf, d); e != nil {
 		return
 	}
 
 	ai := d[0]
 	buf = bytes.NewReader(d[1:])
 
-	if ai&0x01 == 0x01 {
+	if ai&0x40 == 0x40 {
+		a.RoutingIndicator = RouteOnSSN
+	} else {
+		a.RoutingIndicator = RouteOnGT
+	}
+
+	pci, ssni := byte(0x01), byte(0x02)
+	if v == ANSI {
+		pci, ssni = 0x02, 0x01
+	}
+	readPC := func() error {
+		if ai&pci != pci {
+			return nil
+		}
+		if v == ANSI {
+			pc := make([]byte, 3)
+			if _, e := io.ReadFull(buf, pc); e != nil {
+				return e
+			}
+			a.PointCode = PointCode(pc[2])<<16 | PointCode(pc[1])<<8 | PointCode(pc[0])
+			return nil
+		}
 		var pc uint16
-		if e = binary.Read(buf, binary.LittleEndian, &pc); e != nil {
-			return
+		if e := binary.Read(buf, binary.LittleEndian, &pc); e != nil {
+			return e
 		}
-		a.PointCode = uint32(pc)
+		a.PointCode = PointCode(pc)
+		return nil
 	}
-	if ai&0x02 == 0x02 {
-		var sn byte
-		if sn, e = buf.ReadByte(); e != nil {
-			return
+	readSSN := func() error {
+		if ai&ssni != ssni {
+			return nil
+		}
+		sn, e := buf.ReadByte()
+		if e == nil {
+			a.SubsystemNumber = teldata.ParseSSN(sn)
+		}
+		return e
+	}
+	if v == ANSI || (v == TTC && ai&0x80 == 0x80) {
+		if e = readSSN(); e == nil {
+			e = readPC()
+		}
+	} else {
+		if e = readPC(); e == nil {
+			e = readSSN()
 		}
-		a.SubsystemNumber = teldata.ParseSSN(sn)
 	}
+	if e != nil {
+		return
+	}
+
 	if ai&0x3c != 0 {
 		isOdd := false
 		var nai byte = 0x00
-		switch ai & 0x3c {
-		case 0x04:
+		switch gti := ai & 0x3c; {
+		case v == ANSI && gti == 0x04:
+			var t byte
+			if a.GlobalTitle.TranslationType, e = buf.ReadByte(); e != nil {
+			} else if t, e = buf.ReadByte(); e == nil {
+				a.GlobalTitle.NumberingPlan = teldata.NumberingPlan(t >> 4)
+				isOdd = t&0x0f == 0x01
+			}
+		case v == ANSI && gti == 0x08:
+			a.GlobalTitle.TranslationType, e = buf.ReadByte()
+		case v == ANSI:
+			e = fmt.Errorf("invalid GT Indicator value %x", gti)
+		case gti == 0x04:
 			if nai, e = buf.ReadByte(); e == nil {
 				isOdd = nai&0x80 == 0x80
 				nai &= 0x7f
 			}
-		case 0x08:
+		case gti == 0x08:
 			a.GlobalTitle.TranslationType, e = buf.ReadByte()
-		case 0x0c:
+		case gti == 0x0c:
 			var t byte
 			if a.GlobalTitle.TranslationType, e = buf.ReadByte(); e != nil {
 			} else if t, e = buf.ReadByte(); e == nil {
 				a.GlobalTitle.NumberingPlan = teldata.NumberingPlan(t >> 4)
-				isOdd = t&0x01 == 0x01
+				isOdd = t&0x0f == 0x01
 			}
-		case 0x10:
+		case gti == 0x10:
 			var t byte
 			if a.GlobalTitle.TranslationType, e = buf.ReadByte(); e != nil {
 			} else if t, e = buf.ReadByte(); e == nil {
 				a.GlobalTitle.NumberingPlan = teldata.NumberingPlan(t >> 4)
-				isOdd = t&0x01 == 0x01
+				isOdd = t&0x0f == 0x01
 				nai, e = buf.ReadByte()
 			}
 		default:
-			e = fmt.Errorf("invalid GT Indicator value %x", ai&0x3c)
+			e = fmt.Errorf("invalid GT Indicator value %x", gti)
 		}
 		if e != nil {
 			return
@@ -221,19 +385,191 @@ func readSCCPAddr(buf *bytes.Reader) (a SCCPAddr, e error) {
 			return
 		}
 
-		if isOdd {
+		if isOdd && len(a.GlobalTitle.Digits) != 0 {
 			a.GlobalTitle.Digits[len(a.GlobalTitle.Digits)-1] = a.GlobalTitle.Digits[len(a.GlobalTitle.Digits)-1] | 0xf0
 		}
-		switch nai {
-		case 0x01:
-			a.GlobalTitle.NatureOfAddress = teldata.Subscriber
-		case 0x02:
-			a.GlobalTitle.NatureOfAddress = teldata.NetworkSpecific
-		case 0x03:
-			a.GlobalTitle.NatureOfAddress = teldata.NationalSignificant
-		case 0x04:
-			a.GlobalTitle.NatureOfAddress = teldata.International
+		if nai != 0 {
+			a.GlobalTitle.NatureOfAddress = byteToNai(nai)
+		}
+	}
+	return
+}
+
+func (a *SCCPAddr) marshalSUA() []byte {
+	buf := new(bytes.Buffer)
+
+	var ri uint16 = 0x0002 // route on SSN+PC
+	var ai uint16 = 0x0000
+	if !a.GlobalTitle.IsEmpty() {
+		ri = 0x0001 // route on GT
+		ai |= 0x0004
+	}
+	switch a.RoutingIndicator {
+	case RouteOnGT:
+		ri = 0x0001
+	case RouteOnSSN:
+		ri = 0x0002
+	}
+	if a.PointCode != 0 {
+		ai |= 0x0002
+	}
+	if a.SubsystemNumber != 0 {
+		ai |= 0x0001
+	}
+	binary.Write(buf, binary.BigEndian, ri)
+	binary.Write(buf, binary.BigEndian, ai)
+
+	// Global Title
+	if !a.GlobalTitle.IsEmpty() {
+		dig := append([]byte{}, a.GlobalTitle.Digits.Bytes()...)
+		n := len(dig) * 2
+		if dig[len(dig)-1]&0xf0 == 0xf0 {
+			n--
+		}
+		for i := range dig {
+			if 0xf0&dig[i] == 0xf0 {
+				dig[i] = 0x0f & dig[i]
+			}
+			if 0x0f&dig[i] == 0x0f {
+				dig[i] = 0xf0 & dig[i]
+			}
+		}
+
+		var gti byte = 0x04 // TT, NPI and NAI
+		if a.GlobalTitle.TranslationType == 0 &&
+			a.GlobalTitle.NumberingPlan == teldata.UnknownNP {
+			gti = 0x01 // NAI only
+		} else if a.GlobalTitle.NatureOfAddress == teldata.UnknownNA &&
+			a.GlobalTitle.NumberingPlan == teldata.UnknownNP {
+			gti = 0x02 // TT only
+		} else if a.GlobalTitle.NatureOfAddress == teldata.UnknownNA {
+			gti = 0x03 // TT and NPI
+		}
+
+		binary.Write(buf, binary.BigEndian, uint16(0x8001))
+		binary.Write(buf, binary.BigEndian, uint16(12+len(dig)))
+		buf.Write([]byte{0, 0, 0, gti})
+		buf.WriteByte(byte(n))
+		buf.WriteByte(a.GlobalTitle.TranslationType)
+		buf.WriteByte(byte(a.GlobalTitle.NumberingPlan))
+		buf.WriteByte(naiToByte(a.GlobalTitle.NatureOfAddress))
+		buf.Write(dig)
+		if len(dig)%4 != 0 {
+			buf.Write(make([]byte, 4-len(dig)%4))
+		}
+	}
+
+	// Point Code
+	if a.PointCode != 0 {
+		writeUint32(buf, 0x8002, uint32(a.PointCode))
+	}
+
+	// Subsystem Number
+	if a.SubsystemNumber != 0 {
+		writeUint32(buf, 0x8003, uint32(a.SubsystemNumber.Uint()))
+	}
+	return buf.Bytes()
+}
+
+func writeSUAAddr(w io.Writer, t uint16, a SCCPAddr) {
+	d := a.marshalSUA()
+	binary.Write(w, binary.BigEndian, t)
+	binary.Write(w, binary.BigEndian, uint16(4+len(d)))
+	w.Write(d)
+}
+
+func readSUAAddr(r io.ReadSeeker, l uint16) (a SCCPAddr, e error) {
+	d := make([]byte, l)
+	if _, e = r.Read(d); e != nil {
+		return
+	}
+	if len(d) < 4 {
+		e = fmt.Errorf("too short address")
+		return
+	}
+
+	// Address Indicator is ignored,
+	// address is decoded from included parameters
+	switch binary.BigEndian.Uint16(d[0:2]) {
+	case 0x0001:
+		a.RoutingIndicator = RouteOnGT
+	case 0x0002:
+		a.RoutingIndicator = RouteOnSSN
+	}
+	for buf := bytes.NewReader(d[4:]); buf.Len() > 4; {
+		var t, l uint16
+		binary.Read(buf, binary.BigEndian, &t)
+		binary.Read(buf, binary.BigEndian, &l)
+		l -= 4
+
+		switch t {
+		case 0x8001: // Global Title
+			v := make([]byte, l)
+			if _, e = buf.Read(v); e != nil {
+				return
+			} else if len(v) < 8 {
+				e = fmt.Errorf("too short global title")
+				return
+			}
+			n := int(v[4])
+			a.GlobalTitle.TranslationType = v[5]
+			a.GlobalTitle.NumberingPlan = teldata.NumberingPlan(v[6])
+			a.GlobalTitle.NatureOfAddress = byteToNai(v[7])
+			if len(v) < 8+(n+1)/2 {
+				e = fmt.Errorf("too short global title digits")
+				return
+			}
+			a.GlobalTitle.Digits = v[8 : 8+(n+1)/2]
+			if n%2 == 1 {
+				a.GlobalTitle.Digits[len(a.GlobalTitle.Digits)-1] |= 0xf0
+			}
+		case 0x8002: // Point Code
+			var pc uint32
+			if pc, e = readUint32(buf, l); e == nil {
+				a.PointCode = PointCode(pc)
+			}
+		case 0x8003: // Subsystem Number
+			var sn uint8
+			if sn, e = readUint8(buf, l); e == nil {
+				a.SubsystemNumber = teldata.ParseSSN(sn)
+			}
+		default:
+			_, e = buf.Seek(int64(l), io.SeekCurrent)
+		}
+		if e != nil {
+			return
+		}
+		if l%4 != 0 {
+			buf.Seek(int64(4-l%4), io.SeekCurrent)
 		}
 	}
 	return
 }
+
+func naiToByte(na teldata.NatureOfAddress) byte {
+	switch na {
+	case teldata.International:
+		return 0x04
+	case teldata.NationalSignificant:
+		return 0x03
+	case teldata.NetworkSpecific:
+		return 0x02
+	case teldata.Subscriber:
+		return 0x01
+	}
+	return 0x00
+}
+
+func byteToNai(b byte) teldata.NatureOfAddress {
+	switch b {
+	case 0x01:
+		return teldata.Subscriber
+	case 0x02:
+		return teldata.NetworkSpecific
+	case 0x03:
+		return teldata.NationalSignificant
+	case 0x04:
+		return teldata.International
+	}
+	return teldata.UnknownNA
+}
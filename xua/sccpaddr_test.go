@@ -0,0 +1,159 @@
+package xua
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/fkgi/teldata"
+)
+
+// gtiSamples returns addresses with each GTI value of variant v,
+// and expected GTI in address indicator.
+func gtiSamples(v Variant) map[byte]SCCPAddr {
+	odd := teldata.TBCD{0x21, 0x43, 0xf5}
+	even := teldata.TBCD{0x21, 0x43, 0x65}
+	if v == ANSI {
+		return map[byte]SCCPAddr{
+			0x04: {
+				RoutingIndicator: RouteOnGT,
+				GlobalTitle: teldata.GlobalTitle{
+					TranslationType: 10,
+					NumberingPlan:   teldata.ISDNTelephony,
+					Digits:          odd}},
+			0x08: {
+				RoutingIndicator: RouteOnGT,
+				GlobalTitle: teldata.GlobalTitle{
+					TranslationType: 10,
+					Digits:          even}}}
+	}
+	return map[byte]SCCPAddr{
+		0x04: {
+			RoutingIndicator: RouteOnGT,
+			GlobalTitle: teldata.GlobalTitle{
+				NatureOfAddress: teldata.International,
+				Digits:          odd}},
+		0x08: {
+			RoutingIndicator: RouteOnGT,
+			GlobalTitle: teldata.GlobalTitle{
+				TranslationType: 10,
+				Digits:          even}},
+		0x0c: {
+			RoutingIndicator: RouteOnGT,
+			GlobalTitle: teldata.GlobalTitle{
+				TranslationType: 10,
+				NumberingPlan:   teldata.ISDNTelephony,
+				Digits:          odd}},
+		0x10: {
+			RoutingIndicator: RouteOnGT,
+			GlobalTitle: teldata.GlobalTitle{
+				NumberingPlan:   teldata.ISDNTelephony,
+				NatureOfAddress: teldata.International,
+				Digits:          even}}}
+}
+
+func sccpRoundTrip(t *testing.T, a SCCPAddr, v Variant) ([]byte, SCCPAddr) {
+	b := a.marshalSCCP(v)
+	r, e := readSCCPAddr(bytes.NewReader(append([]byte{byte(len(b))}, b...)), v)
+	if e != nil {
+		t.Fatalf("%s: failed to read %x: %v", v, b, e)
+	}
+	return b, r
+}
+
+func TestSCCPAddrGTI(t *testing.T) {
+	for _, v := range []Variant{ITU, ANSI, TTC} {
+		for gti, a := range gtiSamples(v) {
+			for _, ssn := range []bool{false, true} {
+				if ssn {
+					a.PointCode = 0x1234
+					a.SubsystemNumber = teldata.SsnHLR
+				}
+				b, r := sccpRoundTrip(t, a, v)
+				if b[0]&0x3c != gti {
+					t.Errorf("%s: GTI of %x is not %x", v, b, gti)
+				}
+				if !reflect.DeepEqual(a, r) {
+					t.Errorf("%s: GTI %x: %+v != %+v", v, gti, a, r)
+				}
+			}
+		}
+	}
+}
+
+func TestSCCPAddrVariant(t *testing.T) {
+	a := SCCPAddr{
+		RoutingIndicator: RouteOnSSN,
+		PointCode:        0x123456,
+		SubsystemNumber:  teldata.SsnHLR}
+
+	testcases := []struct {
+		v   Variant
+		pc  PointCode
+		exp []byte
+	}{
+		{ITU, 0x1456, []byte{0x43, 0x56, 0x14, 0x06}},
+		{ANSI, 0x123456, []byte{0xc3, 0x06, 0x56, 0x34, 0x12}},
+		{TTC, 0x3456, []byte{0xc3, 0x06, 0x56, 0x34}},
+	}
+	for _, tc := range testcases {
+		a.PointCode = tc.pc
+		b, r := sccpRoundTrip(t, a, tc.v)
+		if !bytes.Equal(b, tc.exp) {
+			t.Errorf("%s: %x != %x", tc.v, b, tc.exp)
+		}
+		if !reflect.DeepEqual(a, r) {
+			t.Errorf("%s: %+v != %+v", tc.v, a, r)
+		}
+	}
+}
+
+func TestSCCPAddrRoutingIndicator(t *testing.T) {
+	a := SCCPAddr{
+		GlobalTitle: teldata.GlobalTitle{
+			NatureOfAddress: teldata.International,
+			Digits:          teldata.TBCD{0x21, 0x43}},
+		PointCode:       100,
+		SubsystemNumber: teldata.SsnHLR}
+
+	for ri, exp := range map[RoutingIndicator]RoutingIndicator{
+		RouteAuto:  RouteOnSSN,
+		RouteOnGT:  RouteOnGT,
+		RouteOnSSN: RouteOnSSN,
+	} {
+		a.RoutingIndicator = ri
+		if _, r := sccpRoundTrip(t, a, ITU); r.RoutingIndicator != exp {
+			t.Errorf("SCCP %s: %s != %s", ri, r.RoutingIndicator, exp)
+		}
+
+		b := new(bytes.Buffer)
+		writeSUAAddr(b, 0x0103, a)
+		r, e := readSUAAddr(bytes.NewReader(b.Bytes()[4:]), uint16(b.Len()-4))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if ri == RouteAuto {
+			exp = RouteOnGT
+		}
+		if r.RoutingIndicator != exp {
+			t.Errorf("SUA %s: %s != %s", ri, r.RoutingIndicator, exp)
+		}
+	}
+}
+
+func TestSUAAddrGTI(t *testing.T) {
+	for _, a := range gtiSamples(ITU) {
+		a.PointCode = 100
+		a.SubsystemNumber = teldata.SsnHLR
+
+		b := new(bytes.Buffer)
+		writeSUAAddr(b, 0x0103, a)
+		r, e := readSUAAddr(bytes.NewReader(b.Bytes()[4:]), uint16(b.Len()-4))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !reflect.DeepEqual(a, r) {
+			t.Errorf("%+v != %+v", a, r)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package xua
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fkgi/teldata"
+)
+
+var tstat = time.Second * 30 // Subsystem status test interval
+
+// SsnSCMG is subsystem number of SCCP management.
+const SsnSCMG teldata.SubsystemNumber = 1
+
+const (
+	ssa byte = 0x01 // Subsystem allowed
+	ssp byte = 0x02 // Subsystem prohibited
+	sst byte = 0x03 // Subsystem status test
+	sor byte = 0x04 // Subsystem out of service request
+	sog byte = 0x05 // Subsystem out of service grant
+)
+
+/*
+scmg is SCCP management message.
+Affected PC is 14 bits in 2 octets, 16 bits in 2 octets for TTC,
+or 24 bits in 3 octets for ANSI.
+
+	+-+-+-+-+-+-+-+-+
+	| Format ID     |
+	+-+-+-+-+-+-+-+-+
+	| Affected SSN  |
+	+-+-+-+-+-+-+-+-+
+	| Affected PC   |
+	+               +
+	|               |
+	+-+-+-+-+-+-+-+-+
+	| SMI           |
+	+-+-+-+-+-+-+-+-+
+*/
+type scmg struct {
+	format byte
+	ssn    teldata.SubsystemNumber
+	pc     PointCode
+	smi    uint8
+}
+
+func (m scmg) marshal(v Variant) []byte {
+	switch v {
+	case ANSI:
+		return []byte{
+			m.format, m.ssn.Uint(),
+			byte(m.pc), byte(m.pc >> 8), byte(m.pc >> 16),
+			m.smi & 0x03}
+	case TTC:
+		return []byte{
+			m.format, m.ssn.Uint(),
+			byte(m.pc), byte(m.pc >> 8),
+			m.smi & 0x03}
+	}
+	return []byte{
+		m.format, m.ssn.Uint(),
+		byte(m.pc), byte(m.pc>>8) & 0x3f,
+		m.smi & 0x03}
+}
+
+func (m *scmg) unmarshal(b []byte, v Variant) error {
+	l := 5
+	if v == ANSI {
+		l = 6
+	}
+	if len(b) < l {
+		return fmt.Errorf("too short SCMG message")
+	}
+	m.format = b[0]
+	m.ssn = teldata.ParseSSN(b[1])
+	switch v {
+	case ANSI:
+		m.pc = PointCode(b[2]) | PointCode(b[3])<<8 | PointCode(b[4])<<16
+	case TTC:
+		m.pc = PointCode(b[2]) | PointCode(b[3])<<8
+	default:
+		m.pc = PointCode(b[2]) | PointCode(b[3]&0x3f)<<8
+	}
+	m.smi = b[l-1] & 0x03
+	return nil
+}
+
+// Subsystem is remote subsystem identified by point code and SSN.
+type Subsystem struct {
+	PointCode       PointCode
+	SubsystemNumber teldata.SubsystemNumber
+}
+
+func (s Subsystem) String() string {
+	return fmt.Sprintf("%s/%d", s.PointCode, s.SubsystemNumber)
+}
+
+// ProhibitedSubsystems returns remote subsystems that are prohibited by SSP.
+func (se *SignalingEndpoint) ProhibitedSubsystems() []Subsystem {
+	ss := <-se.prohibited
+	se.prohibited <- ss
+	ret := make([]Subsystem, 0, len(ss))
+	for s := range ss {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// IsSubsystemAllowed returns false if the remote subsystem is prohibited
+// by SSP or the point code is unavailable by DUNA.
+func (se *SignalingEndpoint) IsSubsystemAllowed(
+	pc PointCode, ssn teldata.SubsystemNumber) bool {
+	return se.isAvailable(pc, ssn)
+}
+
+func (se *SignalingEndpoint) setSubsystemState(s Subsystem, allowed bool) {
+	ss := <-se.prohibited
+	_, prohibited := ss[s]
+	if allowed {
+		delete(ss, s)
+	} else {
+		ss[s] = struct{}{}
+	}
+	se.prohibited <- ss
+
+	if prohibited == !allowed {
+		return
+	}
+	if SubsystemNotify != nil {
+		SubsystemNotify(s, allowed)
+	}
+	if !allowed {
+		go se.testSubsystem(s)
+	}
+}
+
+// testSubsystem sends SST to prohibited subsystem periodically
+// until the subsystem is allowed.
+func (se *SignalingEndpoint) testSubsystem(s Subsystem) {
+	for {
+		select {
+		case <-se.block:
+			return
+		case <-time.After(tstat):
+		}
+
+		ss := <-se.prohibited
+		_, prohibited := ss[s]
+		se.prohibited <- ss
+		if !prohibited {
+			return
+		}
+		se.sendSCMG(se.Context, s.PointCode,
+			scmg{format: sst, ssn: s.SubsystemNumber, pc: s.PointCode})
+	}
+}
+
+func (se *SignalingEndpoint) sendSCMG(ctx uint32, dpc PointCode, m scmg) {
+	se.send(dpc, userData{
+		rc:   ctx,
+		cgpa: SCCPAddr{PointCode: se.PointCode, SubsystemNumber: SsnSCMG},
+		cdpa: SCCPAddr{PointCode: dpc, SubsystemNumber: SsnSCMG},
+		data: m.marshal(se.Variant)})
+}
+
+// isLocalSubsystem returns true if ssn is served by the endpoint.
+func (se *SignalingEndpoint) isLocalSubsystem(ssn teldata.SubsystemNumber) bool {
+	if ssn == SsnSCMG {
+		return true
+	}
+	for _, as := range se.listAS() {
+		if (as.Handler != nil || se.PayloadHandler != nil) &&
+			len(as.SubsystemNumbers) != 0 && servesSSN(as.SubsystemNumbers, ssn) {
+			return true
+		}
+	}
+	return ssn == se.SubsystemNumber && se.PayloadHandler != nil
+}
+
+// handleSCMG handles SCMG message received on SSN 1.
+func (se *SignalingEndpoint) handleSCMG(req userData) {
+	m := scmg{}
+	if e := m.unmarshal(req.data, se.Variant); e != nil {
+		if RxFailureNotify != nil {
+			RxFailureNotify(e, req.data)
+		}
+		return
+	}
+	opc := req.opc
+	if opc == 0 {
+		opc = req.cgpa.PointCode
+	}
+	s := Subsystem{PointCode: m.pc, SubsystemNumber: m.ssn}
+	if s.PointCode == 0 {
+		s.PointCode = opc
+	}
+
+	switch m.format {
+	case ssa:
+		se.setSubsystemState(s, true)
+	case ssp:
+		se.setSubsystemState(s, false)
+	case sst:
+		if se.isLocalSubsystem(m.ssn) {
+			m.format = ssa
+			se.sendSCMG(req.rc, opc, m)
+		}
+	case sor:
+		m.format = sog
+		se.sendSCMG(req.rc, opc, m)
+	case sog:
+	default:
+		if RxFailureNotify != nil {
+			RxFailureNotify(fmt.Errorf("unknown SCMG format %d", m.format), req.data)
+		}
+	}
+}
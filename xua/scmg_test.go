@@ -0,0 +1,20 @@
+package xua
+
+import (
+	"testing"
+
+	"github.com/fkgi/teldata"
+)
+
+func TestSCMGPointCode(t *testing.T) {
+	for v, pc := range map[Variant]PointCode{ITU: 0x3fff, ANSI: 0xfedcba, TTC: 0xfedc} {
+		m := scmg{format: ssp, ssn: teldata.SsnHLR, pc: pc, smi: 1}
+		r := scmg{}
+		if e := r.unmarshal(m.marshal(v), v); e != nil {
+			t.Fatalf("%s: %v", v, e)
+		}
+		if r != m {
+			t.Errorf("%s: %+v != %+v", v, r, m)
+		}
+	}
+}
@@ -10,7 +10,13 @@ import (
 	"unsafe"
 )
 
-func sockOpen() (int, error) {
+// sockOpen opens one-to-many style SCTP socket.
+// AF_INET6 socket is used for IPv6 address,
+// and it also accepts IPv4 address for dual-stack multihoming.
+func sockOpen(v6 bool) (int, error) {
+	if v6 {
+		return syscall.Socket(syscall.AF_INET6, syscall.SOCK_SEQPACKET, syscall.IPPROTO_SCTP)
+	}
 	return syscall.Socket(syscall.AF_INET, syscall.SOCK_SEQPACKET, syscall.IPPROTO_SCTP)
 }
 
@@ -19,39 +25,128 @@ func sockClose(fd int) {
 	syscall.Close(fd)
 }
 
-/*
-func sockListen(fd int) error {
+func sockListen(fd int, o SCTPOptions) error {
+	if e := sctpSetOptions(fd, o); e != nil {
+		return e
+	}
+
+	var ev [14]uint8 // sctp_event_subscribe
+	ev[1] = 1        // sctp_association_event
+	if _, _, e := syscall.Syscall6(syscall.SYS_SETSOCKOPT,
+		uintptr(fd),
+		syscall.IPPROTO_SCTP,
+		11, // SCTP_EVENTS
+		uintptr(unsafe.Pointer(&ev[0])),
+		uintptr(len(ev)),
+		0); e != 0 {
+		return e
+	}
 	return syscall.Listen(fd, syscall.SOMAXCONN)
 }
-*/
 
-func sctpBindx(fd int, addr []byte) error {
+func setsockopt(fd int, opt uintptr, p unsafe.Pointer, l uintptr) error {
 	if _, _, e := syscall.Syscall6(syscall.SYS_SETSOCKOPT,
 		uintptr(fd),
 		syscall.IPPROTO_SCTP,
-		100, // SCTP_SOCKOPT_BINDX_ADD
-		uintptr(unsafe.Pointer(&addr[0])),
-		uintptr(len(addr)),
+		opt,
+		uintptr(p),
+		l,
 		0); e != 0 {
 		return e
 	}
 	return nil
 }
 
-func sctpConnectx(fd int, addr []byte) (int, error) {
-	opt := struct {
+// sctpSetOptions sets o to future associations of one-to-many style socket.
+func sctpSetOptions(fd int, o SCTPOptions) error {
+	initmsg := struct {
 		numOstreams  uint16
 		maxIstreams  uint16
 		maxAttemts   uint16
 		maxInitTimeo uint16
-	}{numOstreams: 17}
+	}{numOstreams: o.OutStreams, maxIstreams: o.InStreams}
+	if e := setsockopt(fd,
+		2, // SCTP_INITMSG
+		unsafe.Pointer(&initmsg), unsafe.Sizeof(initmsg)); e != nil {
+		return e
+	}
+
+	if o.RTOInitial != 0 || o.RTOMin != 0 || o.RTOMax != 0 {
+		rto := struct {
+			assoc   int32
+			initial uint32
+			max     uint32
+			min     uint32
+		}{
+			initial: uint32(o.RTOInitial.Milliseconds()),
+			max:     uint32(o.RTOMax.Milliseconds()),
+			min:     uint32(o.RTOMin.Milliseconds())}
+		if e := setsockopt(fd,
+			0, // SCTP_RTOINFO
+			unsafe.Pointer(&rto), unsafe.Sizeof(rto)); e != nil {
+			return e
+		}
+	}
+
+	if o.HeartbeatInterval != 0 || o.PathMaxRetrans != 0 || o.SackDelay != 0 {
+		// sctp_paddrparams without spp_ipv6_flowlabel and spp_dscp
+		var param [152]byte
+		var flags uint32
+		if o.HeartbeatInterval > 0 {
+			binary.LittleEndian.PutUint32(param[132:136],
+				uint32(o.HeartbeatInterval.Milliseconds()))
+			flags |= 0x0001 // SPP_HB_ENABLE
+		} else if o.HeartbeatInterval < 0 {
+			flags |= 0x0002 // SPP_HB_DISABLE
+		}
+		binary.LittleEndian.PutUint16(param[136:138], o.PathMaxRetrans)
+		if o.SackDelay > 0 {
+			binary.LittleEndian.PutUint32(param[142:146],
+				uint32(o.SackDelay.Milliseconds()))
+			flags |= 0x0020 // SPP_SACKDELAY_ENABLE
+		} else if o.SackDelay < 0 {
+			flags |= 0x0040 // SPP_SACKDELAY_DISABLE
+		}
+		binary.LittleEndian.PutUint32(param[146:150], flags)
+		if e := setsockopt(fd,
+			9, // SCTP_PEER_ADDR_PARAMS
+			unsafe.Pointer(&param[0]), uintptr(len(param))); e != nil {
+			return e
+		}
+	}
+
+	// stream ID of received message
+	rcvinfo := int32(1)
+	if e := setsockopt(fd,
+		32, // SCTP_RECVRCVINFO
+		unsafe.Pointer(&rcvinfo), unsafe.Sizeof(rcvinfo)); e != nil {
+		return e
+	}
+
+	var nodelay int32
+	if o.NoDelay {
+		nodelay = 1
+	}
+	return setsockopt(fd,
+		3, // SCTP_NODELAY
+		unsafe.Pointer(&nodelay), unsafe.Sizeof(nodelay))
+}
+
+func sctpBindx(fd int, addr []byte) error {
 	if _, _, e := syscall.Syscall6(syscall.SYS_SETSOCKOPT,
 		uintptr(fd),
 		syscall.IPPROTO_SCTP,
-		2, // SCTP_INITMSG
-		uintptr(unsafe.Pointer(&opt)),
-		unsafe.Sizeof(opt),
+		100, // SCTP_SOCKOPT_BINDX_ADD
+		uintptr(unsafe.Pointer(&addr[0])),
+		uintptr(len(addr)),
 		0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+func sctpConnectx(fd int, addr []byte, o SCTPOptions) (int, error) {
+	if e := sctpSetOptions(fd, o); e != nil {
 		return 0, e
 	}
 
@@ -65,11 +160,14 @@ func sctpConnectx(fd int, addr []byte) (int, error) {
 	if e != 0 {
 		return 0, e
 	}
+	return sctpPeeloff(fd, int32(t))
+}
 
+func sctpPeeloff(fd int, aid int32) (int, error) {
 	peel := struct {
 		aid int32
 		sd  int32
-	}{aid: int32(t)}
+	}{aid: aid}
 	l := unsafe.Sizeof(peel)
 	if _, _, e := syscall.Syscall6(syscall.SYS_GETSOCKOPT,
 		uintptr(fd),
@@ -83,14 +181,73 @@ func sctpConnectx(fd int, addr []byte) (int, error) {
 	return int(peel.sd), nil
 }
 
-/*
-	func sctpAccept(fd int) (nfd int, e error) {
-		nfd, _, e = syscall.Accept(fd)
-		return
+// sctpOutStreams returns number of outbound streams of the association.
+func sctpOutStreams(fd int) (uint16, error) {
+	var status [256]byte // sctp_status
+	l := uintptr(len(status))
+	if _, _, e := syscall.Syscall6(syscall.SYS_GETSOCKOPT,
+		uintptr(fd),
+		syscall.IPPROTO_SCTP,
+		14, // SCTP_STATUS
+		uintptr(unsafe.Pointer(&status[0])),
+		uintptr(unsafe.Pointer(&l)),
+		0); e != 0 {
+		return 0, e
+	}
+	return binary.LittleEndian.Uint16(status[18:20]), nil // sstat_outstrms
+}
+
+// sctpAccept waits new association on one-to-many style socket
+// and returns peeled off socket of the association
+// and number of outbound streams of it.
+func sctpAccept(fd int) (int, uint16, error) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, flags, _, e := syscall.Recvmsg(fd, buf, nil, 0)
+		if eno, ok := e.(syscall.Errno); ok && eno.Temporary() {
+			continue
+		} else if e != nil {
+			return 0, 0, e
+		} else if n <= 0 {
+			return 0, 0, io.EOF
+		}
+
+		// sctp_assoc_change notification with SCTP_COMM_UP state
+		if flags&0x8000 == 0 || n < 20 || // MSG_NOTIFICATION
+			binary.LittleEndian.Uint16(buf[0:2]) != 0x8001 || // SCTP_ASSOC_CHANGE
+			binary.LittleEndian.Uint16(buf[8:10]) != 0 { // SCTP_COMM_UP
+			continue
+		}
+		s, e := sctpPeeloff(fd, int32(binary.LittleEndian.Uint32(buf[16:20])))
+		return s, binary.LittleEndian.Uint16(buf[12:14]), e // sac_outbound_streams
+	}
+}
+
+// sctpSend sends b on stream sid with payload protocol identifier ppid.
+func sctpSend(fd int, b []byte, sid uint16, ppid uint32, unordered bool) (int, error) {
+	hdr := syscall.Cmsghdr{
+		Level: syscall.IPPROTO_SCTP,
+		Type:  2, //SCTP_SNDINFO
+	}
+	hdr.SetLen(syscall.CmsgSpace(16))
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, hdr)
+	var flags uint16
+	if unordered {
+		flags |= 0x0001 // SCTP_UNORDERED
 	}
-*/
+	binary.Write(buf, binary.LittleEndian, sid)       // stream ID(2 byte)
+	binary.Write(buf, binary.LittleEndian, flags)     // flag(2 byte)
+	binary.Write(buf, binary.BigEndian, ppid)         // PPID(4 byte)
+	binary.Write(buf, binary.LittleEndian, uint32(0)) // context(4 byte) = empty
+	binary.Write(buf, binary.LittleEndian, uint32(0)) // assoc ID(4 byte)
 
-func sctpSend(fd int, b []byte, sid uint16) (int, error) {
+	return syscall.SendmsgN(fd, b, buf.Bytes(), nil, 0)
+}
+
+// sctpAbort aborts the association of fd with ABORT chunk.
+func sctpAbort(fd int) error {
 	hdr := syscall.Cmsghdr{
 		Level: syscall.IPPROTO_SCTP,
 		Type:  2, //SCTP_SNDINFO
@@ -99,28 +256,51 @@ func sctpSend(fd int, b []byte, sid uint16) (int, error) {
 
 	buf := new(bytes.Buffer)
 	binary.Write(buf, binary.LittleEndian, hdr)
-	binary.Write(buf, binary.LittleEndian, sid)            // stream ID(2 byte)
-	binary.Write(buf, binary.LittleEndian, uint16(0x0001)) // flag(2 byte) = SCTP_UNORDERED
-	binary.Write(buf, binary.BigEndian, uint32(3))         // PPID(4 byte) = M3UA(50331648)
+	binary.Write(buf, binary.LittleEndian, uint16(0))      // stream ID(2 byte)
+	binary.Write(buf, binary.LittleEndian, uint16(0x0004)) // flag(2 byte) = SCTP_ABORT
+	binary.Write(buf, binary.LittleEndian, uint32(0))      // PPID(4 byte)
 	binary.Write(buf, binary.LittleEndian, uint32(0))      // context(4 byte) = empty
 	binary.Write(buf, binary.LittleEndian, uint32(0))      // assoc ID(4 byte)
 
-	return syscall.SendmsgN(fd, b, buf.Bytes(), nil, 0)
+	_, e := syscall.SendmsgN(fd, nil, buf.Bytes(), nil, 0)
+	return e
 }
 
-func sctpRecvmsg(fd int) (data []byte, e error) {
-	info := make([]byte, syscall.CmsgSpace(32))
-	data = make([]byte, 1500)
-	n, on, _, _, e := syscall.Recvmsg(fd, data, info, 0)
-	if e != nil {
-		return
+// sctpRecvmsg receives one message and its stream ID.
+// Message that is larger than buffer is received with partial delivery
+// until MSG_EOR, and notification is discarded.
+// rb is reused and received data is copied out of it.
+func sctpRecvmsg(fd int, rb *recvBuffer) (data []byte, sid uint16, e error) {
+	if rb.data == nil {
+		rb.data = make([]byte, maxMessageLength)
+		rb.info = make([]byte, syscall.CmsgSpace(32))
 	}
-	if n <= 0 && on <= 0 {
-		e = io.EOF
-		return
+	buf, info := rb.data, rb.info
+	for {
+		n, on, flags, _, e := syscall.Recvmsg(fd, buf, info, 0)
+		if e != nil {
+			return nil, 0, e
+		}
+		if n <= 0 && on <= 0 {
+			return nil, 0, io.EOF
+		}
+		if flags&0x8000 != 0 { // MSG_NOTIFICATION
+			continue
+		}
+		if cmsgs, e := syscall.ParseSocketControlMessage(info[:on]); e == nil {
+			for _, m := range cmsgs {
+				if m.Header.Level == syscall.IPPROTO_SCTP &&
+					m.Header.Type == 3 && // SCTP_RCVINFO
+					len(m.Data) >= 2 {
+					sid = binary.LittleEndian.Uint16(m.Data[0:2])
+				}
+			}
+		}
+		data = append(data, buf[:n]...)
+		if flags&syscall.MSG_EOR != 0 {
+			return data, sid, nil
+		}
 	}
-	data = data[:n]
-	return
 }
 
 func sctpGetladdrs(fd int) (unsafe.Pointer, int, error) {
@@ -4,38 +4,42 @@ package xua
 
 import "unsafe"
 
-func sockOpen() (int, error) {
+func sockOpen(bool) (int, error) {
 	return 0, nil
 }
 
 func sockClose(int) {}
 
-/*
-func sockListen(int) error {
+func sockListen(int, SCTPOptions) error {
 	return nil
 }
-*/
 
 func sctpBindx(int, []byte) error {
 	return nil
 }
 
-func sctpConnectx(int, []byte) (int, error) {
+func sctpConnectx(int, []byte, SCTPOptions) (int, error) {
 	return 0, nil
 }
 
-/*
-func sctpAccept(int) (int, error) {
+func sctpAccept(int) (int, uint16, error) {
+	return 0, 0, nil
+}
+
+func sctpOutStreams(int) (uint16, error) {
 	return 0, nil
 }
-*/
 
-func sctpSend(int, []byte, uint16) (int, error) {
+func sctpSend(int, []byte, uint16, uint32, bool) (int, error) {
 	return 0, nil
 }
 
-func sctpRecvmsg(int) ([]byte, error) {
-	return nil, nil
+func sctpAbort(int) error {
+	return nil
+}
+
+func sctpRecvmsg(int, *recvBuffer) ([]byte, uint16, error) {
+	return nil, 0, nil
 }
 
 func sctpGetladdrs(int) (unsafe.Pointer, int, error) {
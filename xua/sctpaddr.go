@@ -17,6 +17,19 @@ type SCTPAddr struct {
 	Port int
 }
 
+// isIPv6 returns true if any IPv6 address is included.
+func (a *SCTPAddr) isIPv6() bool {
+	for _, i := range a.IP {
+		if i.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rawBytes returns packed array of sockaddr_in and sockaddr_in6
+// for sctp_bindx and sctp_connectx.
+// IPv4 and IPv6 addresses can be mixed in dual-stack multihoming.
 func (a *SCTPAddr) rawBytes() []byte {
 	var buf bytes.Buffer
 
@@ -30,71 +43,50 @@ func (a *SCTPAddr) rawBytes() []byte {
 		}
 		copy(raw.Addr[:], net.IPv4zero)
 		binary.Write(&buf, binary.LittleEndian, raw)
-	} else if a.IP[0].To4() != nil {
-		for _, i := range a.IP {
-			i = i.To4()
-			if i == nil {
-				continue
-			}
+	}
+	for _, i := range a.IP {
+		if v4 := i.To4(); v4 != nil {
 			raw := syscall.RawSockaddrInet4{
 				Family: syscall.AF_INET,
 				Port:   p}
-			copy(raw.Addr[:], i)
+			copy(raw.Addr[:], v4)
 			binary.Write(&buf, binary.LittleEndian, raw)
-		}
-	} else if a.IP[0].To16() != nil {
-		for _, i := range a.IP {
-			if i.To4() != nil {
-				continue
-			}
-			i = i.To16()
+		} else if v6 := i.To16(); v6 != nil {
 			raw := syscall.RawSockaddrInet6{
 				Family: syscall.AF_INET6,
-				Port:   p,
-				// Flowinfo:
-				// Scope_id:
-			}
-			copy(raw.Addr[:], i)
-			binary.Write(&buf, binary.BigEndian, raw)
-		}
-	} else {
-		raw := syscall.RawSockaddrInet4{
-			Family: syscall.AF_INET,
-			Port:   p,
+				Port:   p}
+			copy(raw.Addr[:], v6)
+			binary.Write(&buf, binary.LittleEndian, raw)
 		}
-		copy(raw.Addr[:], net.IPv4zero)
-		binary.Write(&buf, binary.BigEndian, raw)
 	}
 	return buf.Bytes()
 }
 
+// resolveFromRawAddr decodes n addresses in packed array
+// of sockaddr_in and sockaddr_in6.
 func resolveFromRawAddr(ptr unsafe.Pointer, n int) *SCTPAddr {
 	addr := &SCTPAddr{}
 	p := 0
-	addr.IP = make([]net.IP, n)
+	addr.IP = make([]net.IP, 0, n)
 
-	switch (*(*syscall.RawSockaddrAny)(ptr)).Addr.Family {
-	case syscall.AF_INET:
-		p = int((*(*syscall.RawSockaddrInet4)(ptr)).Port)
-
-		for i := 0; i < n; i++ {
-			a := *(*syscall.RawSockaddrInet4)(
-				unsafe.Pointer(uintptr(ptr) + uintptr(16*i)))
-			addr.IP[i] = net.IPv4(a.Addr[0], a.Addr[1], a.Addr[2], a.Addr[3])
+	for i := 0; i < n; i++ {
+		switch (*(*syscall.RawSockaddrAny)(ptr)).Addr.Family {
+		case syscall.AF_INET:
+			a := *(*syscall.RawSockaddrInet4)(ptr)
+			p = int(a.Port)
+			addr.IP = append(addr.IP,
+				net.IPv4(a.Addr[0], a.Addr[1], a.Addr[2], a.Addr[3]))
+			ptr = unsafe.Add(ptr, syscall.SizeofSockaddrInet4)
+		case syscall.AF_INET6:
+			a := *(*syscall.RawSockaddrInet6)(ptr)
+			p = int(a.Port)
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, a.Addr[:])
+			addr.IP = append(addr.IP, ip)
+			ptr = unsafe.Add(ptr, syscall.SizeofSockaddrInet6)
+		default:
+			panic("invalid family of address")
 		}
-	case syscall.AF_INET6:
-		p = int((*(*syscall.RawSockaddrInet6)(ptr)).Port)
-
-		for i := 0; i < n; i++ {
-			a := *(*syscall.RawSockaddrInet6)(
-				unsafe.Pointer(uintptr(ptr) + uintptr(28*i)))
-			addr.IP[i] = make([]byte, net.IPv6len)
-			for j := 0; j < net.IPv6len; j++ {
-				addr.IP[i][j] = a.Addr[j]
-			}
-		}
-	default:
-		panic("invalid family of address")
 	}
 
 	addr.Port = (p & 0x00ff) << 8
@@ -124,16 +116,21 @@ func (a *SCTPAddr) String() string {
 
 func (*SCTPAddr) Network() string { return "sctp" }
 
+// ParseSCTPAddr parses multihomed address such as "192.168.1.1/192.168.2.1:2905".
+// IPv6 address is enclosed in square brackets,
+// such as "[2001:db8::1]/192.168.1.1:2905".
 func ParseSCTPAddr(s string) (a *SCTPAddr, e error) {
 	a = &SCTPAddr{}
-	if part := strings.Split(s, ":"); len(part) != 2 {
+	if i := strings.LastIndex(s, ":"); i < 0 {
 		e = errors.New("invalid address")
-	} else if a.Port, e = strconv.Atoi(part[1]); e != nil {
+	} else if a.Port, e = strconv.Atoi(s[i+1:]); e != nil {
 	} else if a.Port < 0 || a.Port > 65535 {
 		e = errors.New("invalid port number")
 	} else {
-		part = strings.Split(part[0], "/")
-		for _, ip := range part {
+		for _, ip := range strings.Split(s[:i], "/") {
+			if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+				ip = ip[1 : len(ip)-1]
+			}
 			i := net.ParseIP(ip)
 			if i == nil {
 				e = errors.New("invalid IP address")
@@ -0,0 +1,304 @@
+package xua
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Listen starts SGP mode and accepts connection from ASPs.
+// Registered AS is served, or AS with Context is served
+// if no AS is registered.
+func (se *SignalingEndpoint) Listen() (e error) {
+	if e = se.tp.listen(se.sctpOptions()); e != nil {
+		return
+	}
+
+	se.sgp = true
+	se.defaultAS()
+
+	go func() {
+		for s, e := se.tp.accept(); e == nil; s, e = se.tp.accept() {
+			go func(s association) {
+				s = newCapturedAssociation(s, se.sctpOptions().PPID)
+				i := nextID()
+				c := &ASP{id: i, conn: s}
+				if SctpNotify != nil {
+					SctpNotify(i, fmt.Sprintf("accepted from %v", c.RemoteAddr()))
+				}
+				notifyAssociation(c.event(AssociationEstablished, nil))
+
+				asps := <-se.asps
+				asps[s] = c
+				se.asps <- asps
+
+				c.acceptAndServe(se)
+				se.release(c)
+			}(s)
+		}
+	}()
+	return
+}
+
+// handleASPUP handles ASPUP from ASP and answers ASPUP Ack.
+func (se *SignalingEndpoint) handleASPUP(c *ASP) {
+	if !c.sgp {
+		c.write(&TxERR{code: UnexpectedMessage})
+		return
+	}
+	if c.State() == Active {
+		se.deactivate(c, nil)
+	}
+	c.setState(Inactive)
+	c.write(&TxASPUPAck{})
+
+	servers := <-se.servers
+	for _, as := range servers {
+		if as.state == Down {
+			as.state = Inactive
+			se.notifyAS(as)
+		} else {
+			c.write(&TxNTFY{status: as.state, ctx: as.Context})
+		}
+	}
+	se.servers <- servers
+}
+
+// handleASPDN handles ASPDN from ASP and answers ASPDN Ack.
+func (se *SignalingEndpoint) handleASPDN(c *ASP) {
+	if !c.sgp {
+		c.write(&TxERR{code: UnexpectedMessage})
+		return
+	}
+	se.deactivate(c, nil)
+	c.setState(Down)
+	c.write(&TxASPDNAck{})
+}
+
+// handleASPAC handles ASPAC from ASP and answers ASPAC Ack.
+func (se *SignalingEndpoint) handleASPAC(c *ASP, mode, ctx uint32) {
+	if !c.sgp || c.State() == Down {
+		c.write(&TxERR{code: UnexpectedMessage, ctx: ctx})
+		return
+	}
+	switch mode {
+	case 0, Override, Loadshare, Broadcast:
+	default:
+		c.write(&TxERR{code: UnsupportedTrafficHandlingMode, ctx: ctx})
+		return
+	}
+
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	as, ok := serverOf(servers, ctx)
+	if !ok {
+		c.write(&TxERR{code: InvalidRoutingContext, ctx: ctx})
+		return
+	}
+	if mode != 0 && as.Mode != 0 && mode != as.Mode {
+		c.write(&TxERR{code: UnsupportedTrafficHandlingMode, ctx: ctx})
+		return
+	}
+	if as.Mode == 0 {
+		as.Mode = mode
+	}
+	c.write(&TxASPACAck{mode: mode, ctx: ctx})
+
+	for _, a := range as.active {
+		if a == c {
+			return
+		}
+	}
+	if as.Mode == Override {
+		for _, a := range as.active {
+			a.write(&TxNTFY{status: AlternateASPActive, ctx: as.Context})
+			a.setState(Inactive)
+		}
+		as.active = as.active[:0]
+	}
+	as.active = append(as.active, c)
+	c.setState(Active)
+
+	if as.state != Active {
+		if as.recovery != nil {
+			as.recovery.Stop()
+			as.recovery = nil
+			close(as.ready)
+		}
+		as.state = Active
+		se.notifyAS(as)
+	}
+	as.wakeup()
+}
+
+// handleASPIA handles ASPIA from ASP and answers ASPIA Ack.
+func (se *SignalingEndpoint) handleASPIA(c *ASP, ctx uint32) {
+	if !c.sgp || c.State() == Down {
+		c.write(&TxERR{code: UnexpectedMessage, ctx: ctx})
+		return
+	}
+
+	servers := <-se.servers
+	as, ok := serverOf(servers, ctx)
+	se.servers <- servers
+	if !ok {
+		c.write(&TxERR{code: InvalidRoutingContext, ctx: ctx})
+		return
+	}
+
+	se.deactivate(c, as)
+	c.setState(Inactive)
+	c.write(&TxASPIAAck{ctx: ctx})
+}
+
+// recover is called when T(r) is expired.
+func (se *SignalingEndpoint) recover(as *AS) {
+	servers := <-se.servers
+	defer func() { se.servers <- servers }()
+
+	if as.state != Pending {
+		return
+	}
+	as.recovery = nil
+	close(as.ready)
+
+	as.state = Down
+	asps := <-se.asps
+	for _, c := range asps {
+		if c.sgp && c.State() != Down {
+			as.state = Inactive
+			break
+		}
+	}
+	se.asps <- asps
+	se.notifyAS(as)
+}
+
+// notifyAS sends NTFY with state of as to all ASPs that are not down,
+// and SSNM for point code of as to other active ASPs.
+func (se *SignalingEndpoint) notifyAS(as *AS) {
+	asps := <-se.asps
+	for _, c := range asps {
+		if c.sgp && c.State() != Down {
+			c.write(&TxNTFY{status: as.state, ctx: as.Context})
+		}
+	}
+	se.asps <- asps
+	se.notifyDestination(as)
+}
+
+// handleREGREQ registers routing keys from ASP and answers REG RSP.
+// Existing AS with same routing key is used, or new AS is added.
+func (se *SignalingEndpoint) handleREGREQ(c *ASP, keys []routingKey) {
+	if !c.sgp || c.State() == Down {
+		c.write(&TxERR{code: UnexpectedMessage})
+		return
+	}
+
+	servers := <-se.servers
+	res := make([]regResult, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, se.registerKey(servers, k))
+	}
+	se.servers <- servers
+
+	c.write(&TxREGRSP{sua: se.Protocol == SUA, results: res})
+}
+
+func (se *SignalingEndpoint) registerKey(servers map[uint32]*AS, k routingKey) regResult {
+	res := regResult{id: k.id}
+	for _, as := range servers {
+		if !se.routingKey(as).equal(k) || (k.ctx != 0 && k.ctx != as.Context) {
+			continue
+		}
+		if k.mode != 0 && as.Mode != 0 && k.mode != as.Mode {
+			res.status = RegInvalidTrafficMode
+		}
+		res.ctx = as.Context
+		return res
+	}
+
+	switch k.mode {
+	case 0, Override, Loadshare, Broadcast:
+	default:
+		res.status = RegInvalidTrafficMode
+		return res
+	}
+	if k.dpc == 0 && len(k.addr) == 0 {
+		res.status = RegInvalidRoutingKey
+		return res
+	}
+	if se.Protocol == M3UA && len(k.si) != 0 && bytes.IndexByte(k.si, 0x03) < 0 {
+		res.status = RegUnsupportedParameter
+		return res
+	}
+
+	res.ctx = k.ctx
+	if _, ok := servers[res.ctx]; ok {
+		res.status = RegChangeRefused
+		return res
+	}
+	for res.ctx == 0 {
+		res.ctx = uint32(len(servers)) + 1
+		for _, ok := servers[res.ctx]; ok; _, ok = servers[res.ctx] {
+			res.ctx++
+		}
+	}
+
+	as := &AS{
+		Context:       res.ctx,
+		Mode:          k.mode,
+		NetAppearance: k.na,
+		PointCode:     k.dpc,
+		Dynamic:       true,
+		state:         Inactive,
+		localID:       k.id,
+		registered:    true}
+	for _, a := range k.addr {
+		if !a.GlobalTitle.IsEmpty() {
+			as.GlobalTitles = append(as.GlobalTitles, a.GlobalTitle.Digits.String())
+		} else if a.SubsystemNumber != 0 {
+			as.SubsystemNumbers = append(as.SubsystemNumbers, a.SubsystemNumber)
+		}
+		if as.PointCode == 0 {
+			as.PointCode = a.PointCode
+		}
+	}
+	servers[res.ctx] = as
+	return res
+}
+
+// handleDEREGREQ deregisters routing keys from ASP and answers DEREG RSP.
+// Registered AS is removed if no ASP is active for the AS.
+func (se *SignalingEndpoint) handleDEREGREQ(c *ASP, ctx []uint32) {
+	if !c.sgp || c.State() == Down {
+		c.write(&TxERR{code: UnexpectedMessage})
+		return
+	}
+
+	servers := <-se.servers
+	res := make([]deregResult, 0, len(ctx))
+	for _, rc := range ctx {
+		r := deregResult{ctx: rc}
+		as, ok := servers[rc]
+		switch {
+		case !ok:
+			r.status = DeregInvalidRoutingContext
+		case !as.registered:
+			r.status = DeregNotRegistered
+		default:
+			for _, a := range as.active {
+				if a == c {
+					r.status = DeregASPCurrentlyActive
+				}
+			}
+			if r.status == Deregistered && len(as.active) == 0 {
+				delete(servers, rc)
+			}
+		}
+		res = append(res, r)
+	}
+	se.servers <- servers
+
+	c.write(&TxDEREGRSP{sua: se.Protocol == SUA, results: res})
+}
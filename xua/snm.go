@@ -9,8 +9,46 @@ import (
 /*
 SNM/SSNM: Signalling Network Management Messages
 Message class = 0x02
+
+Figures are SUA format. In M3UA, tag of Congestion Indications is 0x0205
+and tag of User/Cause is 0x0204, and SSN and SMI are not included.
 */
 
+// userCauseTag returns tag of User/Cause of M3UA or SUA.
+func userCauseTag(sua bool) uint16 {
+	if sua {
+		return 0x010c
+	}
+	return 0x0204
+}
+
+// congestionTag returns tag of Congestion Indications of M3UA,
+// or Congestion Level of SUA.
+func congestionTag(sua bool) uint16 {
+	if sua {
+		return 0x0118
+	}
+	return 0x0205
+}
+
+// setSSNMProtocol sets protocol of received SSNM message m.
+func setSSNMProtocol(m rxMessage, sua bool) {
+	switch m := m.(type) {
+	case *DUNA:
+		m.sua = sua
+	case *DAVA:
+		m.sua = sua
+	case *RxDAUD:
+		m.sua = sua
+	case *SCON:
+		m.sua = sua
+	case *DUPU:
+		m.sua = sua
+	case *DRST:
+		m.sua = sua
+	}
+}
+
 /*
 DUNA is Destination Unavailable message. (Message type = 0x01)
 
@@ -45,13 +83,20 @@ DUNA is Destination Unavailable message. (Message type = 0x01)
 */
 type DUNA struct {
 	ctx uint32
-	apc []PointCode
+	apc []AffectedPointCode
 	ssn uint8
 	smi uint8
 	// info    string
+
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
 
-func (m *DUNA) handleMessage(*ASP) {
+func (m *DUNA) handleMessage(c *ASP) {
+	c.se.updateDestination(m.apc, func(d *Destination) {
+		d.State = DestinationUnavailable
+		d.Congestion = 0
+	})
 	if DunaNotify != nil {
 		DunaNotify(m.apc)
 	}
@@ -63,9 +108,9 @@ func (m *DUNA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.ctx, e = readUint32(r, l)
 	case 0x0012: // Affeccted Point Code
 		m.apc, e = readAPC(r, l)
-	case 0x8003: // SSN (Optional)
+	case 0x8003: // SSN (Optional, SUA only)
 		m.ssn, e = readUint8(r, l)
-	case 0x0112: // SMI (Optional)
+	case 0x0112: // SMI (Optional, SUA only)
 		m.smi, e = readUint8(r, l)
 	// case 0x0004:	// Info String (Optional)
 	// 	m.info, e = readInfo(r, l)
@@ -75,6 +120,31 @@ func (m *DUNA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+type TxDUNA DUNA
+
+func (m *TxDUNA) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDUNA) handleResult(message) {}
+
+func (m *TxDUNA) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+
+	writeAPC(buf, m.apc)
+
+	if m.sua && m.ssn != 0 {
+		writeUint8(buf, 0x8003, m.ssn)
+	}
+
+	if m.sua && m.smi != 0 {
+		writeUint8(buf, 0x0112, m.smi)
+	}
+
+	return 0x02, 0x01, buf.Bytes()
+}
+
 /*
 DAVA is Destination Available message. (Message type = 0x02)
 
@@ -109,13 +179,20 @@ DAVA is Destination Available message. (Message type = 0x02)
 */
 type DAVA struct {
 	ctx uint32
-	apc []PointCode
+	apc []AffectedPointCode
 	ssn uint8
 	smi uint8
 	// info    string
+
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
 
-func (m *DAVA) handleMessage(*ASP) {
+func (m *DAVA) handleMessage(c *ASP) {
+	c.se.updateDestination(m.apc, func(d *Destination) {
+		d.State = DestinationAvailable
+		d.Congestion = 0
+	})
 	if DavaNotify != nil {
 		DavaNotify(m.apc)
 	}
@@ -127,9 +204,9 @@ func (m *DAVA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.ctx, e = readUint32(r, l)
 	case 0x0012: // Affected Point Code
 		m.apc, e = readAPC(r, l)
-	case 0x8003: // SSN (Optional)
+	case 0x8003: // SSN (Optional, SUA only)
 		m.ssn, e = readUint8(r, l)
-	case 0x0112: // SMI (Optional)
+	case 0x0112: // SMI (Optional, SUA only)
 		m.smi, e = readUint8(r, l)
 	// case 0x0004:	// Info String (Optional)
 	// 	m.info, e = readInfo(r, l)
@@ -139,6 +216,31 @@ func (m *DAVA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+type TxDAVA DAVA
+
+func (m *TxDAVA) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDAVA) handleResult(message) {}
+
+func (m *TxDAVA) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+
+	writeAPC(buf, m.apc)
+
+	if m.sua && m.ssn != 0 {
+		writeUint8(buf, 0x8003, m.ssn)
+	}
+
+	if m.sua && m.smi != 0 {
+		writeUint8(buf, 0x0112, m.smi)
+	}
+
+	return 0x02, 0x02, buf.Bytes()
+}
+
 /*
 DAUD is Destination State Audit message. (Message type = 0x03)
 
@@ -173,21 +275,22 @@ DAUD is Destination State Audit message. (Message type = 0x03)
 */
 type DAUD struct {
 	ctx   uint32
-	apc   []PointCode
+	apc   []AffectedPointCode
 	ssn   uint8
 	cause uint16
 	user  uint16
 	// info    string
-}
 
-func (m *DAUD) handleMessage(*ASP) {
-	if DaudNotify != nil {
-		DaudNotify(m.apc)
-	}
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
-func (m *DAUD) handleResult(message) {}
 
-func (m *DAUD) marshal() (uint8, uint8, []byte) {
+type TxDAUD DAUD
+
+func (m *TxDAUD) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDAUD) handleResult(message) {}
+
+func (m *TxDAUD) marshal() (uint8, uint8, []byte) {
 	buf := new(bytes.Buffer)
 
 	// Routing Context (Optional)
@@ -197,13 +300,13 @@ func (m *DAUD) marshal() (uint8, uint8, []byte) {
 	writeAPC(buf, m.apc)
 
 	// SSN (Optional)
-	if m.ssn != 0 {
-		writeUint32(buf, 0x8003, uint32(m.ssn))
+	if m.sua && m.ssn != 0 {
+		writeUint8(buf, 0x8003, m.ssn)
 	}
 
 	// User/Cause (Optional)
 	if m.user == 3 {
-		binary.Write(buf, binary.BigEndian, uint16(0x010C))
+		binary.Write(buf, binary.BigEndian, userCauseTag(m.sua))
 		binary.Write(buf, binary.BigEndian, uint16(8))
 		binary.Write(buf, binary.BigEndian, m.cause)
 		binary.Write(buf, binary.BigEndian, m.user)
@@ -216,6 +319,28 @@ func (m *DAUD) marshal() (uint8, uint8, []byte) {
 	return 0x02, 0x03, buf.Bytes()
 }
 
+type RxDAUD DAUD
+
+func (m *RxDAUD) handleMessage(c *ASP) { c.se.handleDAUD(c, m) }
+
+func (m *RxDAUD) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
+	switch t {
+	case 0x0006: // Routing Context (Optional)
+		m.ctx, e = readUint32(r, l)
+	case 0x0012: // Affected Point Code
+		m.apc, e = readAPC(r, l)
+	case 0x8003: // SSN (Optional, SUA only)
+		m.ssn, e = readUint8(r, l)
+	case userCauseTag(m.sua): // User/Cause (Optional)
+		if e = binary.Read(r, binary.BigEndian, &m.cause); e == nil {
+			e = binary.Read(r, binary.BigEndian, &m.user)
+		}
+	default:
+		_, e = r.Seek(int64(l), io.SeekCurrent)
+	}
+	return
+}
+
 /*
 SCON is  Signalling Congestion message. (Message type = 0x04)
 
@@ -254,14 +379,20 @@ SCON is  Signalling Congestion message. (Message type = 0x04)
 */
 type SCON struct {
 	ctx        uint32
-	apc        []PointCode
+	apc        []AffectedPointCode
 	ssn        uint8
 	congestion uint32
 	smi        uint8
 	// info       string
+
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
 
-func (m *SCON) handleMessage(*ASP) {
+func (m *SCON) handleMessage(c *ASP) {
+	c.se.updateDestination(m.apc, func(d *Destination) {
+		d.Congestion = m.congestion
+	})
 	if SconNotify != nil {
 		SconNotify(m.apc, m.congestion)
 	}
@@ -273,11 +404,11 @@ func (m *SCON) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.ctx, e = readUint32(r, l)
 	case 0x0012: // Affected Point Code
 		m.apc, e = readAPC(r, l)
-	case 0x8003: // SSN (Optional)
+	case 0x8003: // SSN (Optional, SUA only)
 		m.ssn, e = readUint8(r, l)
-	case 0x0118: // Congestion Level
+	case congestionTag(m.sua): // Congestion Level
 		m.congestion, e = readUint32(r, l)
-	case 0x0112: // SMI (Optional)
+	case 0x0112: // SMI (Optional, SUA only)
 		m.smi, e = readUint8(r, l)
 	// case 0x0004:	// Info String (Optional)
 	// 	m.info, e = readInfo(r, l)
@@ -287,6 +418,29 @@ func (m *SCON) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+type TxSCON SCON
+
+func (m *TxSCON) handleMessage(c *ASP) { c.write(m) }
+func (m *TxSCON) handleResult(message) {}
+
+func (m *TxSCON) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+
+	writeAPC(buf, m.apc)
+
+	if m.sua && m.ssn != 0 {
+		writeUint8(buf, 0x8003, m.ssn)
+	}
+
+	writeUint32(buf, congestionTag(m.sua), m.congestion)
+
+	return 0x02, 0x04, buf.Bytes()
+}
+
 /*
 DUPU is Destination User Part Unavailable. (Message type = 0x05)
 
@@ -318,13 +472,22 @@ DUPU is Destination User Part Unavailable. (Message type = 0x05)
 */
 type DUPU struct {
 	ctx   uint32
-	apc   []PointCode
+	apc   []AffectedPointCode
 	cause uint16
 	user  uint16
 	// info    string
+
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
 
-func (m *DUPU) handleMessage(*ASP) {
+func (m *DUPU) handleMessage(c *ASP) {
+	if m.user == 3 {
+		c.se.updateDestination(m.apc, func(d *Destination) {
+			d.State = DestinationUserPartUnavailable
+			d.Congestion = 0
+		})
+	}
 	if DupuNotify != nil {
 		DupuNotify(m.apc, m.cause)
 	}
@@ -336,7 +499,7 @@ func (m *DUPU) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.ctx, e = readUint32(r, l)
 	case 0x0012: // Affected Point Code
 		m.apc, e = readAPC(r, l)
-	case 0x010C: // Cause/User
+	case userCauseTag(m.sua): // Cause/User
 		if e = binary.Read(r, binary.BigEndian, &m.cause); e == nil {
 			e = binary.Read(r, binary.BigEndian, &m.user)
 		}
@@ -348,6 +511,28 @@ func (m *DUPU) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	return
 }
 
+type TxDUPU DUPU
+
+func (m *TxDUPU) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDUPU) handleResult(message) {}
+
+func (m *TxDUPU) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+
+	writeAPC(buf, m.apc)
+
+	binary.Write(buf, binary.BigEndian, userCauseTag(m.sua))
+	binary.Write(buf, binary.BigEndian, uint16(8))
+	binary.Write(buf, binary.BigEndian, m.cause)
+	binary.Write(buf, binary.BigEndian, m.user)
+
+	return 0x02, 0x05, buf.Bytes()
+}
+
 /*
 DRST is Destination Restricted message. (Message type = 0x06)
 
@@ -382,13 +567,19 @@ DRST is Destination Restricted message. (Message type = 0x06)
 */
 type DRST struct {
 	ctx uint32
-	apc []PointCode
+	apc []AffectedPointCode
 	ssn uint8
 	smi uint8
 	// info    string
+
+	// sua is true for SUA. Tags of some parameters are different.
+	sua bool
 }
 
-func (m *DRST) handleMessage(*ASP) {
+func (m *DRST) handleMessage(c *ASP) {
+	c.se.updateDestination(m.apc, func(d *Destination) {
+		d.State = DestinationRestricted
+	})
 	if DrstNotify != nil {
 		DrstNotify(m.apc)
 	}
@@ -400,9 +591,9 @@ func (m *DRST) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 		m.ctx, e = readUint32(r, l)
 	case 0x0012: // Affected Point Code
 		m.apc, e = readAPC(r, l)
-	case 0x8003: // SSN (Optional)
+	case 0x8003: // SSN (Optional, SUA only)
 		m.ssn, e = readUint8(r, l)
-	case 0x0112: // SMI (Optional)
+	case 0x0112: // SMI (Optional, SUA only)
 		m.smi, e = readUint8(r, l)
 	// case 0x0004:	// Info String (Optional)
 	// 	m.info, e = readInfo(r, l)
@@ -411,3 +602,28 @@ func (m *DRST) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 	}
 	return
 }
+
+type TxDRST DRST
+
+func (m *TxDRST) handleMessage(c *ASP) { c.write(m) }
+func (m *TxDRST) handleResult(message) {}
+
+func (m *TxDRST) marshal() (uint8, uint8, []byte) {
+	buf := new(bytes.Buffer)
+
+	if m.ctx != 0 {
+		writeUint32(buf, 0x0006, m.ctx)
+	}
+
+	writeAPC(buf, m.apc)
+
+	if m.sua && m.ssn != 0 {
+		writeUint8(buf, 0x8003, m.ssn)
+	}
+
+	if m.sua && m.smi != 0 {
+		writeUint8(buf, 0x0112, m.smi)
+	}
+
+	return 0x02, 0x06, buf.Bytes()
+}
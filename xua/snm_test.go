@@ -0,0 +1,45 @@
+package xua
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// decodeSSNM decodes body of tx message into rx message m,
+// and returns tags in the body.
+func decodeSSNM(t *testing.T, tx txMessage, m rxMessage) (tags []uint16) {
+	_, _, b := tx.marshal()
+	for r := bytes.NewReader(b); r.Len() > 4; {
+		var tag, l uint16
+		binary.Read(r, binary.BigEndian, &tag)
+		binary.Read(r, binary.BigEndian, &l)
+		if e := m.unmarshal(tag, l-4, r); e != nil {
+			t.Fatalf("tag %x: %v", tag, e)
+		}
+		tags = append(tags, tag)
+	}
+	return
+}
+
+func TestSSNMProtocol(t *testing.T) {
+	apc := []AffectedPointCode{{pc: 100}}
+	for _, sua := range []bool{false, true} {
+		scon := &SCON{congestion: 1, sua: sua}
+		tags := decodeSSNM(t, &TxSCON{apc: apc, ssn: 6, congestion: 3, sua: sua}, scon)
+		if scon.congestion != 3 {
+			t.Errorf("sua=%v: congestion level %d is decoded", sua, scon.congestion)
+		}
+		for _, tag := range tags {
+			if !sua && tag&0x8000 != 0 {
+				t.Errorf("SUA tag %x in M3UA message", tag)
+			}
+		}
+
+		dupu := &DUPU{sua: sua}
+		decodeSSNM(t, &TxDUPU{apc: apc, cause: 1, user: 3, sua: sua}, dupu)
+		if dupu.user != 3 || dupu.cause != 1 {
+			t.Errorf("sua=%v: user/cause %d/%d is decoded", sua, dupu.user, dupu.cause)
+		}
+	}
+}
@@ -54,16 +54,36 @@ func readRoutingContext(r io.ReadSeeker, l uint16) (v []uint32, e error) {
 }
 */
 
-type PointCode struct {
+// AffectedPointCode is point code with mask in SSNM.
+type AffectedPointCode struct {
 	mask byte
-	pc   uint32
+	pc   PointCode
 }
 
-func (p PointCode) String() string {
-	return fmt.Sprintf("%d/%d", p.pc, p.mask)
+func (p AffectedPointCode) String() string {
+	return fmt.Sprintf("%s/%d", p.pc, p.mask)
 }
 
-func writeAPC(w io.Writer, v []PointCode) {
+// PointCode returns point code of p.
+func (p AffectedPointCode) PointCode() PointCode {
+	return p.pc
+}
+
+// Mask returns number of wildcarded low order bits of p.
+func (p AffectedPointCode) Mask() uint8 {
+	return p.mask
+}
+
+// covers returns true if pc is included in p.
+// Mask is number of wildcarded low order bits.
+func (p AffectedPointCode) covers(pc PointCode) bool {
+	if p.mask >= 32 {
+		return true
+	}
+	return p.pc>>p.mask == pc>>p.mask
+}
+
+func writeAPC(w io.Writer, v []AffectedPointCode) {
 	binary.Write(w, binary.BigEndian, uint16(0x0012))
 	binary.Write(w, binary.BigEndian, uint16(4+4*len(v)))
 	for _, a := range v {
@@ -71,17 +91,17 @@ func writeAPC(w io.Writer, v []PointCode) {
 	}
 }
 
-func readAPC(r io.ReadSeeker, l uint16) (v []PointCode, e error) {
+func readAPC(r io.ReadSeeker, l uint16) (v []AffectedPointCode, e error) {
 	if l%4 != 0 {
 		e = errors.New("invalid length of parameter")
 	} else {
-		v = make([]PointCode, l/4)
+		v = make([]AffectedPointCode, l/4)
 		for i := range v {
 			if e = binary.Read(r, binary.BigEndian, &(v[i].pc)); e != nil {
 				break
 			}
 			v[i].mask = byte(v[i].pc >> 24)
-			v[i].pc = v[i].pc & 0x0fff
+			v[i].pc = v[i].pc & 0x00ffffff
 		}
 	}
 	return
@@ -102,13 +122,11 @@ func readUint32(r io.ReadSeeker, l uint16) (v uint32, e error) {
 	return
 }
 
-/*
 func writeUint8(w io.Writer, t uint16, v uint8) {
 	binary.Write(w, binary.BigEndian, t)
 	binary.Write(w, binary.BigEndian, uint16(8))
 	binary.Write(w, binary.BigEndian, uint32(v))
 }
-*/
 
 func readUint8(r io.ReadSeeker, l uint16) (v uint8, e error) {
 	if l != 4 {
@@ -119,7 +137,6 @@ func readUint8(r io.ReadSeeker, l uint16) (v uint8, e error) {
 	return
 }
 
-/*
 func writeData(w io.Writer, d []byte) {
 	binary.Write(w, binary.BigEndian, uint16(0x010B))
 	binary.Write(w, binary.BigEndian, uint16(4+len(d)))
@@ -134,4 +151,3 @@ func readData(r io.ReadSeeker, l uint16) (d []byte, e error) {
 	_, e = r.Read(d)
 	return
 }
-*/
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sync/atomic"
 )
 
 /*
@@ -33,6 +34,94 @@ const (
 	SegmentationFailure                   Cause = 0x010e
 )
 
+// Refusal, release, reset and error cause of connection-oriented messages.
+const (
+	RefusalEndUserOriginated    Cause = 0x0200
+	RefusalQOSNotAvailable      Cause = 0x0206
+	RefusalSubsystemCongestion  Cause = 0x020b
+	RefusalUnequippedUser       Cause = 0x0213
+	ReleaseEndUserOriginated    Cause = 0x0300
+	ReleaseEndUserCongestion    Cause = 0x0301
+	ReleaseSCCPUserOriginated   Cause = 0x0303
+	ReleaseRemoteProcedureError Cause = 0x0304
+	ReleaseInconsistentData     Cause = 0x0305
+	ReleaseResetTimer           Cause = 0x030c
+	ReleaseInactivityTimer      Cause = 0x030d
+	ResetEndUserOriginated      Cause = 0x0400
+	ResetIncorrectPS            Cause = 0x0402
+	ResetIncorrectPR            Cause = 0x0403
+	ErrorUnassignedReference    Cause = 0x0500
+)
+
+func (c Cause) String() string {
+	switch c {
+	case Success:
+		return "success"
+	case NoTranslationForAnAddressOfSuchNature:
+		return "no_translation_for_an_address_of_such_nature(0x00)"
+	case NoTranslationForThisSpecificAddress:
+		return "no_translation_for_this_specific_address(0x01)"
+	case SubsystemCongestion:
+		return "subsystem_congestion(0x02)"
+	case SubsystemFailure:
+		return "subsystem_failure(0x03)"
+	case UnequippedUser:
+		return "unequipped_user(0x04)"
+	case MtpFailure:
+		return "MTP_failure(0x05)"
+	case NetworkCongestion:
+		return "network_congestion(0x06)"
+	case Unqualified:
+		return "unqualified(0x07)"
+	case ErrorInMessageTransport:
+		return "error_in_message_transport(0x08)"
+	case ErrorInLocalProcessing:
+		return "error_in_local_processing(0x09)"
+	case DestinationCannotPerformReassembly:
+		return "destination_cannot_perform_reassembly(0x0a)"
+	case SccpFailure:
+		return "SCCP_failure(0x0b)"
+	case HopCounterViolation:
+		return "hop_counter_violation(0x0c)"
+	case SegmentationNotSupported:
+		return "segmentation_not_supported(0x0d)"
+	case SegmentationFailure:
+		return "segmentation_failure(0x0e)"
+	case RefusalEndUserOriginated:
+		return "refusal:end_user_originated(0x00)"
+	case RefusalQOSNotAvailable:
+		return "refusal:QOS_not_available_non_transient(0x06)"
+	case RefusalSubsystemCongestion:
+		return "refusal:subsystem_congestion(0x0b)"
+	case RefusalUnequippedUser:
+		return "refusal:unequipped_user(0x13)"
+	case ReleaseEndUserOriginated:
+		return "release:end_user_originated(0x00)"
+	case ReleaseEndUserCongestion:
+		return "release:end_user_congestion(0x01)"
+	case ReleaseSCCPUserOriginated:
+		return "release:SCCP_user_originated(0x03)"
+	case ReleaseRemoteProcedureError:
+		return "release:remote_procedure_error(0x04)"
+	case ReleaseInconsistentData:
+		return "release:inconsistent_connection_data(0x05)"
+	case ReleaseResetTimer:
+		return "release:expiration_of_reset_timer(0x0c)"
+	case ReleaseInactivityTimer:
+		return "release:expiration_of_receive_inactivity_timer(0x0d)"
+	case ResetEndUserOriginated:
+		return "reset:end_user_originated(0x00)"
+	case ResetIncorrectPS:
+		return "reset:message_out_of_order_incorrect_P(S)(0x02)"
+	case ResetIncorrectPR:
+		return "reset:message_out_of_order_incorrect_P(R)(0x03)"
+	case ErrorUnassignedReference:
+		return "error:local_reference_number_mismatch_unassigned(0x00)"
+	default:
+		return fmt.Sprintf("unknown_cause(%x)", uint32(c))
+	}
+}
+
 /*
 DATA is Payload Data message. (Message type = 0x01)
 
@@ -94,8 +183,8 @@ type DATA struct {
 	na  *uint32
 	ctx uint32
 
-	opc uint32
-	dpc uint32
+	opc PointCode
+	dpc PointCode
 	// si uint8 = 0x03
 	ni uint8
 	// mp uint8 = 0x00
@@ -103,6 +192,8 @@ type DATA struct {
 
 	// SCCP data
 	userData
+	long    bool
+	variant Variant
 
 	// correlation *uint32
 }
@@ -111,7 +202,7 @@ type TxDATA DATA
 type RxDATA DATA
 
 func (m *TxDATA) handleMessage(c *ASP) {
-	c.TxTransfer++
+	atomic.AddUint64(&c.TxTransfer, 1)
 
 	cls, typ, b := m.marshal()
 	buf := new(bytes.Buffer)
@@ -129,7 +220,10 @@ func (m *TxDATA) handleMessage(c *ASP) {
 	// Message Data
 	buf.Write(b)
 
-	i, e := sctpSend(c.sock, buf.Bytes(), uint16(m.sls)+1)
+	i, e := c.conn.send(buf.Bytes(), c.streamOf(uint32(m.sls)))
+	if e != nil && c.se.redirect(c, m.ctx, uint32(m.sls), m) {
+		return
+	}
 	if TxFailureNotify != nil {
 		if e != nil {
 			TxFailureNotify(e, buf.Bytes())
@@ -153,31 +247,7 @@ func (m *TxDATA) marshal() (uint8, uint8, []byte) {
 	writeUint32(buf, 0x0006, m.ctx)
 
 	// Protocol Data
-	ud := new(bytes.Buffer)
-	if m.cause == Success {
-		ud.WriteByte(0x09)
-		if m.returnOnError {
-			ud.WriteByte((m.protocolClass & 0x0f) | 0x80)
-		} else {
-			ud.WriteByte(m.protocolClass & 0x0f)
-		}
-	} else {
-		ud.WriteByte(0x0a)
-		ud.WriteByte(byte(m.cause & 0x00ff))
-	}
-
-	ud.WriteByte(3)
-	cdpa := m.cdpa.marshalSCCP()
-	ud.WriteByte(byte(3 + len(cdpa)))
-	cgpa := m.cgpa.marshalSCCP()
-	ud.WriteByte(byte(3 + len(cdpa) + len(cgpa)))
-
-	ud.WriteByte(byte(len(cdpa)))
-	ud.Write(cdpa)
-	ud.WriteByte(byte(len(cgpa)))
-	ud.Write(cgpa)
-	ud.WriteByte(byte(len(m.data)))
-	ud.Write(m.data)
+	ud := bytes.NewBuffer(m.marshalSCCP(m.long, m.variant))
 	l := ud.Len()
 
 	binary.Write(buf, binary.BigEndian, uint16(0x0210))
@@ -203,7 +273,7 @@ func (m *TxDATA) marshal() (uint8, uint8, []byte) {
 
 func (m *RxDATA) handleMessage(c *ASP) {
 	if m.cause == Success {
-		c.RxTransfer++
+		atomic.AddUint64(&c.RxTransfer, 1)
 		if c.handler != nil {
 			c.handler(m.cgpa, m.cdpa, m.data)
 			/*
@@ -221,7 +291,7 @@ func (m *RxDATA) handleMessage(c *ASP) {
 			TxFailureNotify(
 				fmt.Errorf("error response(cause=%x) from peer", m.cause), m.data)
 		}
-		c.RxResponse++
+		atomic.AddUint64(&c.RxResponse, 1)
 	}
 }
 
@@ -250,56 +320,9 @@ func (m *RxDATA) unmarshal(t, l uint16, r io.ReadSeeker) (e error) {
 			return
 		}
 
-		var t byte
-		if t, e = buf.ReadByte(); e != nil {
-			return
-		}
-		switch t {
-		case 0x09:
-			t, e = buf.ReadByte()
-			m.returnOnError = t&0x80 == 0x80
-			m.protocolClass = t & 0x0f
-		case 0x0a:
-			t, e = buf.ReadByte()
-			m.cause = Cause(t) | 0x0100
-		default:
-			e = fmt.Errorf("unknown SCCP message type(%x)", t)
-			return
-		}
-		if e != nil {
-			return
-		}
-
-		pos := make([]byte, 3)
-		if _, e = buf.Read(pos); e != nil {
-			return
-		}
 		d = make([]byte, buf.Len())
 		buf.Read(d)
-		buf.Reset(d)
-
-		if _, e = buf.Seek(int64(pos[0]-3), io.SeekStart); e != nil {
-			return
-		}
-		if m.cdpa, e = readSCCPAddr(buf); e != nil {
-			return
-		}
-		if _, e = buf.Seek(int64(pos[1]-2), io.SeekStart); e != nil {
-			return
-		}
-		if m.cgpa, e = readSCCPAddr(buf); e != nil {
-			return
-		}
-		if _, e = buf.Seek(int64(pos[2]-1), io.SeekStart); e != nil {
-			return
-		}
-		if t, e = buf.ReadByte(); e != nil {
-			return
-		}
-		m.data = make([]byte, t)
-		if _, e = buf.Read(m.data); e != nil {
-			return
-		}
+		e = m.unmarshalSCCP(d, m.variant)
 	default:
 		_, e = r.Seek(int64(l), io.SeekCurrent)
 	}
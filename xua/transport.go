@@ -0,0 +1,424 @@
+package xua
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transport is transport of SignalingEndpoint that makes associations.
+// SCTPOptions is ignored by transport other than kernel SCTP.
+type transport interface {
+	// listen starts accepting associations.
+	listen(SCTPOptions) error
+	// accept waits and returns new association.
+	accept() (association, error)
+	// dial makes new association to the address.
+	dial(*SCTPAddr, SCTPOptions) (association, error)
+	close()
+}
+
+// association is transport of ASP that sends and receives xUA messages
+// with message boundary and stream ID.
+type association interface {
+	send([]byte, uint16) (int, error)
+	// recv returns received message and its stream ID.
+	recv() ([]byte, uint16, error)
+	// abort terminates the association immediately.
+	abort() error
+	close()
+	// streams returns number of outbound streams.
+	streams() uint16
+	localAddr() net.Addr
+	remoteAddr() net.Addr
+}
+
+/*
+SCTPOptions is parameters of SCTP association.
+Zero value of each parameter uses default value of the system.
+*/
+type SCTPOptions struct {
+	// OutStreams is number of outbound streams, and InStreams is
+	// maximum number of inbound streams. Default value 17 is used
+	// for OutStreams if 0.
+	OutStreams uint16
+	InStreams  uint16
+
+	// RTOInitial, RTOMin and RTOMax is retransmission timeout.
+	RTOInitial time.Duration
+	RTOMin     time.Duration
+	RTOMax     time.Duration
+
+	// HeartbeatInterval is interval of SCTP HEARTBEAT for each path.
+	// HEARTBEAT is disabled if negative.
+	HeartbeatInterval time.Duration
+	// PathMaxRetrans is maximum number of retransmission for each path.
+	PathMaxRetrans uint16
+	// SackDelay is delay of SACK up to 500ms.
+	// Delayed SACK is disabled if negative.
+	SackDelay time.Duration
+	// NoDelay disables bundling of small messages.
+	NoDelay bool
+
+	// PPID is payload protocol identifier.
+	// 3 for M3UA or 4 for SUA is used if 0.
+	PPID uint32
+	// Unordered is list of message classes that are sent
+	// with unordered delivery. Other messages are sent in order.
+	Unordered []uint8
+}
+
+const defaultOutStreams = 17
+
+// maxMessageLength is length of the largest xUA message that is received.
+const maxMessageLength = 65536
+
+/*
+sctpTransport is kernel SCTP transport on one-to-many style socket.
+Each association is peeled off to one-to-one style socket.
+*/
+type sctpTransport struct {
+	sock int
+	opt  SCTPOptions
+}
+
+func newSCTPTransport(a *SCTPAddr) (*sctpTransport, error) {
+	s, e := sockOpen(a.isIPv6())
+	if e != nil {
+		return nil, e
+	}
+	if e = sctpBindx(s, a.rawBytes()); e != nil {
+		sockClose(s)
+		return nil, e
+	}
+	return &sctpTransport{sock: s}, nil
+}
+
+func (t *sctpTransport) listen(o SCTPOptions) error {
+	t.opt = o
+	return sockListen(t.sock, o)
+}
+
+func (t *sctpTransport) accept() (association, error) {
+	s, n, e := sctpAccept(t.sock)
+	if e != nil {
+		return nil, e
+	}
+	return newSCTPAssociation(s, n, t.opt), nil
+}
+
+func (t *sctpTransport) dial(a *SCTPAddr, o SCTPOptions) (association, error) {
+	s, e := sctpConnectx(t.sock, a.rawBytes(), o)
+	if e != nil {
+		return nil, e
+	}
+	n, _ := sctpOutStreams(s)
+	return newSCTPAssociation(s, n, o), nil
+}
+
+func (t *sctpTransport) close() {
+	sockClose(t.sock)
+}
+
+type sctpAssociation struct {
+	sock int
+	once sync.Once
+
+	ppid      uint32
+	unordered [256]bool
+	ostreams  uint16
+
+	rx recvBuffer
+}
+
+// recvBuffer is buffer of data and ancillary data for receiving,
+// which is reused for each message of the association.
+type recvBuffer struct {
+	data []byte
+	info []byte
+}
+
+// newSCTPAssociation returns association of socket s
+// with n outbound streams that is agreed with the peer.
+// OutStreams of o is used if n is 0.
+func newSCTPAssociation(s int, n uint16, o SCTPOptions) *sctpAssociation {
+	if n == 0 {
+		n = o.OutStreams
+	}
+	c := &sctpAssociation{sock: s, ppid: o.PPID, ostreams: n}
+	for _, cls := range o.Unordered {
+		c.unordered[cls] = true
+	}
+	return c
+}
+
+// send sends xUA message b.
+// Delivery order is decided by Message Class in the header of b.
+func (c *sctpAssociation) send(b []byte, sid uint16) (int, error) {
+	return sctpSend(c.sock, b, sid, c.ppid, len(b) > 2 && c.unordered[b[2]])
+}
+
+func (c *sctpAssociation) recv() ([]byte, uint16, error) {
+	return sctpRecvmsg(c.sock, &c.rx)
+}
+
+func (c *sctpAssociation) abort() error {
+	return sctpAbort(c.sock)
+}
+
+func (c *sctpAssociation) close() {
+	c.once.Do(func() { sockClose(c.sock) })
+}
+
+func (c *sctpAssociation) streams() uint16 { return c.ostreams }
+
+func (c *sctpAssociation) localAddr() net.Addr {
+	ptr, n, e := sctpGetladdrs(c.sock)
+	if e != nil {
+		return nil
+	}
+	return resolveFromRawAddr(ptr, n)
+}
+
+func (c *sctpAssociation) remoteAddr() net.Addr {
+	ptr, n, e := sctpGetpaddrs(c.sock)
+	if e != nil {
+		return nil
+	}
+	return resolveFromRawAddr(ptr, n)
+}
+
+/*
+pipeTransport is in-process transport for testing without kernel SCTP.
+Listening pipeTransport is registered with the address,
+and pipeTransport in same process can dial the address.
+Message boundary and stream ID is kept in the pipe.
+*/
+type pipeTransport struct {
+	addr    *SCTPAddr
+	backlog chan *pipeAssociation
+	done    chan any
+}
+
+var pipeListeners = make(chan map[string]*pipeTransport, 1)
+
+func init() {
+	pipeListeners <- map[string]*pipeTransport{}
+}
+
+func (t *pipeTransport) listen(SCTPOptions) error {
+	l := <-pipeListeners
+	defer func() { pipeListeners <- l }()
+
+	if _, ok := l[t.addr.String()]; ok {
+		return fmt.Errorf("address %s is already in use", t.addr)
+	}
+	t.backlog = make(chan *pipeAssociation, 16)
+	l[t.addr.String()] = t
+	return nil
+}
+
+func (t *pipeTransport) accept() (association, error) {
+	select {
+	case c := <-t.backlog:
+		return c, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *pipeTransport) dial(a *SCTPAddr, _ SCTPOptions) (association, error) {
+	l := <-pipeListeners
+	peer, ok := l[a.String()]
+	pipeListeners <- l
+	if !ok {
+		return nil, fmt.Errorf("connection refused by %s", a)
+	}
+
+	done := make(chan any)
+	once := new(sync.Once)
+	local := &pipeAssociation{
+		rx: make(chan pipeMessage, 1024), done: done, once: once,
+		laddr: t.addr, raddr: peer.addr}
+	remote := &pipeAssociation{
+		rx: make(chan pipeMessage, 1024), done: done, once: once,
+		laddr: peer.addr, raddr: t.addr}
+	local.peer, remote.peer = remote, local
+
+	select {
+	case peer.backlog <- remote:
+		return local, nil
+	case <-peer.done:
+		return nil, fmt.Errorf("connection refused by %s", a)
+	}
+}
+
+func (t *pipeTransport) close() {
+	l := <-pipeListeners
+	if l[t.addr.String()] == t {
+		delete(l, t.addr.String())
+	}
+	pipeListeners <- l
+	close(t.done)
+}
+
+type pipeMessage struct {
+	data []byte
+	sid  uint16
+}
+
+type pipeAssociation struct {
+	rx   chan pipeMessage
+	peer *pipeAssociation
+	done chan any
+	once *sync.Once
+
+	laddr, raddr *SCTPAddr
+}
+
+func (c *pipeAssociation) send(b []byte, sid uint16) (int, error) {
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	select {
+	case c.peer.rx <- pipeMessage{data: append([]byte{}, b...), sid: sid}:
+		return len(b), nil
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (c *pipeAssociation) recv() ([]byte, uint16, error) {
+	select {
+	case m := <-c.rx:
+		return m.data, m.sid, nil
+	case <-c.done:
+		return nil, 0, io.EOF
+	}
+}
+
+func (c *pipeAssociation) abort() error {
+	c.close()
+	return nil
+}
+
+func (c *pipeAssociation) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *pipeAssociation) streams() uint16      { return defaultOutStreams }
+func (c *pipeAssociation) localAddr() net.Addr  { return c.laddr }
+func (c *pipeAssociation) remoteAddr() net.Addr { return c.raddr }
+
+/*
+tcpTransport is TCP transport for lab use where SCTP is not available.
+Each xUA message is framed with stream ID as following.
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|          Stream ID            |           Reserved            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                          xUA message                          |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+Length of the frame is decided by Message Length of xUA message.
+Only the first IP address is used.
+*/
+type tcpTransport struct {
+	addr *SCTPAddr
+	ln   net.Listener
+}
+
+func tcpAddrOf(a *SCTPAddr) string {
+	if len(a.IP) == 0 {
+		return ":" + strconv.Itoa(a.Port)
+	}
+	return net.JoinHostPort(a.IP[0].String(), strconv.Itoa(a.Port))
+}
+
+func (t *tcpTransport) listen(SCTPOptions) (e error) {
+	t.ln, e = net.Listen("tcp", tcpAddrOf(t.addr))
+	return
+}
+
+func (t *tcpTransport) accept() (association, error) {
+	if t.ln == nil {
+		return nil, errors.New("not listening")
+	}
+	c, e := t.ln.Accept()
+	if e != nil {
+		return nil, e
+	}
+	return &tcpAssociation{conn: c.(*net.TCPConn)}, nil
+}
+
+func (t *tcpTransport) dial(a *SCTPAddr, _ SCTPOptions) (association, error) {
+	d := net.Dialer{Timeout: time.Second * 10}
+	if len(t.addr.IP) != 0 {
+		d.LocalAddr = &net.TCPAddr{IP: t.addr.IP[0]}
+	}
+	c, e := d.Dial("tcp", tcpAddrOf(a))
+	if e != nil {
+		return nil, e
+	}
+	return &tcpAssociation{conn: c.(*net.TCPConn)}, nil
+}
+
+func (t *tcpTransport) close() {
+	if t.ln != nil {
+		t.ln.Close()
+	}
+}
+
+type tcpAssociation struct {
+	conn *net.TCPConn
+}
+
+func (c *tcpAssociation) send(b []byte, sid uint16) (int, error) {
+	buf := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint16(buf, sid)
+	n, e := c.conn.Write(append(buf, b...))
+	if n -= 4; n < 0 {
+		n = 0
+	}
+	return n, e
+}
+
+func (c *tcpAssociation) recv() ([]byte, uint16, error) {
+	hdr := make([]byte, 12)
+	if _, e := io.ReadFull(c.conn, hdr); e != nil {
+		return nil, 0, e
+	}
+	sid := binary.BigEndian.Uint16(hdr[0:2])
+	l := binary.BigEndian.Uint32(hdr[8:12])
+	if l < 8 || l > maxMessageLength {
+		return nil, 0, fmt.Errorf("invalid message length %d", l)
+	}
+	data := make([]byte, l)
+	copy(data, hdr[4:])
+	if _, e := io.ReadFull(c.conn, data[8:]); e != nil {
+		return nil, 0, e
+	}
+	return data, sid, nil
+}
+
+func (c *tcpAssociation) abort() error {
+	c.conn.SetLinger(0)
+	return c.conn.Close()
+}
+
+func (c *tcpAssociation) close() {
+	c.conn.Close()
+}
+
+func (c *tcpAssociation) streams() uint16      { return defaultOutStreams }
+func (c *tcpAssociation) localAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *tcpAssociation) remoteAddr() net.Addr { return c.conn.RemoteAddr() }
@@ -0,0 +1,49 @@
+package xua
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestTCPRecvLength(t *testing.T) {
+	ln, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ln.Close()
+
+	for _, tc := range []struct {
+		l  uint32
+		ok bool
+	}{
+		{8, true}, {maxMessageLength, true},
+		{7, false}, {maxMessageLength + 1, false}, {0xffffffff, false},
+	} {
+		go func() {
+			c, e := net.Dial("tcp", ln.Addr().String())
+			if e != nil {
+				return
+			}
+			defer c.Close()
+			// stream ID, then xUA common header with message length
+			b := []byte{0, 1, 0, 0, 1, 0, 3, 1, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[8:], tc.l)
+			if tc.l >= 8 && tc.l <= maxMessageLength+1 {
+				// send whole body so that only length decides result
+				b = append(b, make([]byte, tc.l-8)...)
+			}
+			c.Write(b)
+		}()
+
+		c, e := ln.Accept()
+		if e != nil {
+			t.Fatal(e)
+		}
+		a := &tcpAssociation{conn: c.(*net.TCPConn)}
+		if _, _, e = a.recv(); (e == nil) != tc.ok {
+			t.Errorf("length %d: unexpected result %v", tc.l, e)
+		}
+		a.close()
+	}
+}